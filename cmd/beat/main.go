@@ -4,24 +4,134 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/lienkolabs/breeze/consensus/poa"
+	"github.com/lienkolabs/breeze/consensus/swell"
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/trusted"
+	"github.com/lienkolabs/breeze/protocol/genesis"
 	"github.com/lienkolabs/breeze/util"
 )
 
+type AuthorityConfig struct {
+	Token   string `json:"token"`
+	Address string `json:"address"`
+	Peer    string `json:"peer"`
+}
+
 type Configuration struct {
-	GatewayPort        int    `json:"gatewayPort"`
-	BlockBroadcastPort int    `json:"blockBroadcastPort"`
-	WalletDataPath     string `json:"walletDataPath"`
-	SecureVaultPath    string `json:"secureVaultPath"`
-	NodeToken          string `json:"nodeToken"`
-	//GenesisToken       string `json:"genesisToken"`
+	GatewayPort        int               `json:"gatewayPort"`
+	BlockBroadcastPort int               `json:"blockBroadcastPort"`
+	Peer2PeerPort      int               `json:"peer2peerPort"`
+	WalletDataPath     string            `json:"walletDataPath"`
+	SecureVaultPath    string            `json:"secureVaultPath"`
+	NodeToken          string            `json:"nodeToken"`
+	GenesisToken       string            `json:"genesisToken"`
+	GenesisFile        string            `json:"genesisFile"`
+	ConsensusEngine    string            `json:"consensusEngine"`
+	Authorities        []AuthorityConfig `json:"authorities"`
+	Candidates         []AuthorityConfig `json:"candidates"`
+}
+
+// genesisSpec reads the genesis file of the configuration. Without a genesis
+// file the genesis credits genesisToken, or the node token if there is none,
+// and the validator set is that of the configuration, or the node alone if
+// there is none.
+func genesisSpec(config Configuration, node crypto.Token) *genesis.Spec {
+	if config.GenesisFile != "" {
+		spec, err := genesis.Load(config.GenesisFile)
+		if err != nil {
+			log.Fatalf("invalid genesis: %v\n", err)
+		}
+		return spec
+	}
+	token := node
+	if config.GenesisToken != "" {
+		token = crypto.TokenFromString(config.GenesisToken)
+		if token.Equal(crypto.ZeroToken) {
+			log.Fatalf("invalid genesis token in configuration\n")
+		}
+	}
+	spec := genesis.Default(token)
+	spec.Validators = []genesis.Validator{{Token: node.String()}}
+	validators := config.Authorities
+	if config.ConsensusEngine == "swell" {
+		validators = config.Candidates
+	}
+	if len(validators) > 0 {
+		if config.GenesisToken == "" {
+			log.Fatalf("no genesis file or genesis token in configuration\n")
+		}
+		spec.Validators = make([]genesis.Validator, 0, len(validators))
+		for _, validator := range validators {
+			spec.Validators = append(spec.Validators, genesis.Validator(validator))
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		log.Fatalf("invalid genesis: %v\n", err)
+	}
+	return spec
+}
+
+func swellConfig(config Configuration, credentials crypto.PrivateKey, spec *genesis.Spec) *swell.Config {
+	candidates := make([]swell.Candidate, 0, len(spec.Validators))
+	for _, candidate := range spec.Validators {
+		token := crypto.TokenFromString(candidate.Token)
+		candidates = append(candidates, swell.Candidate{Token: token, Address: candidate.Address, PeerAddress: candidate.Peer})
+	}
+	return &swell.Config{
+		Credentials:   credentials,
+		GatewayPort:   config.GatewayPort,
+		BroadcastPort: config.BlockBroadcastPort,
+		WalletPath:    config.WalletDataPath,
+		Genesis:       spec,
+		Candidates:    candidates,
+		PeerPort:      config.Peer2PeerPort,
+	}
+}
+
+func roundRobinConfig(config Configuration, credentials crypto.PrivateKey, spec *genesis.Spec) *poa.RoundRobinConfig {
+	authorities := make([]poa.Authority, 0, len(spec.Validators))
+	for _, authority := range spec.Validators {
+		token := crypto.TokenFromString(authority.Token)
+		authorities = append(authorities, poa.Authority{Token: token, Address: authority.Address, PeerAddress: authority.Peer})
+	}
+	return &poa.RoundRobinConfig{
+		Credentials:   credentials,
+		GatewayPort:   config.GatewayPort,
+		BroadcastPort: config.BlockBroadcastPort,
+		WalletPath:    config.WalletDataPath,
+		Genesis:       spec,
+		Authorities:   authorities,
+		PeerPort:      config.Peer2PeerPort,
+	}
+}
+
+type recoverable interface {
+	Recover() error
+}
+
+// recoverOnHangup requests disaster recovery of the engine to its last
+// checkpoint whenever the process receives a SIGHUP.
+func recoverOnHangup(engine recoverable) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			log.Print("requesting recovery to last checkpoint")
+			if err := engine.Recover(); err != nil {
+				log.Printf("could not request recovery: %v", err)
+			}
+		}
+	}()
 }
 
 func main() {
 	var config Configuration
 	if len(os.Args) < 2 {
-		log.Fatalln("usage: breeze path-to-config-file.json")
+		log.Fatalln("usage: breeze path-to-config-file.json [test|status|export file [address token]|import file [validators]]")
 	}
 	util.ReadConfigFile(os.Args[1], &config)
 	if config.GatewayPort == 0 || config.BlockBroadcastPort == 0 {
@@ -35,12 +145,56 @@ func main() {
 		fmt.Println(isNew)
 		return
 	}
-	if err := poa.NewProofOfAuthorityValidator(credentials, config.GatewayPort, config.BlockBroadcastPort, config.WalletDataPath); err != nil {
+	spec := genesisSpec(config, credentials.PublicKey())
+	trusted.SetGenesis(spec.Hash())
+	if len(os.Args) >= 3 && os.Args[2] == "status" {
+		Status(credentials.PublicKey(), config.BlockBroadcastPort)
+		return
+	}
+	if len(os.Args) >= 4 && os.Args[2] == "export" {
+		address, node := fmt.Sprintf("localhost:%v", config.BlockBroadcastPort), credentials.PublicKey()
+		if len(os.Args) >= 6 {
+			address, node = os.Args[4], crypto.TokenFromString(os.Args[5])
+		}
+		committee, err := snapshotCommittee(spec, fmt.Sprintf("%vvalidators.dat", config.WalletDataPath))
+		if err != nil {
+			log.Fatalf("could not verify snapshot: %v\n", err)
+		}
+		Export(committee, address, node, os.Args[3])
+		return
+	}
+	if len(os.Args) >= 4 && os.Args[2] == "import" {
+		if config.ConsensusEngine == "swell" {
+			log.Fatalf("swell nodes cannot be imported from a snapshot\n")
+		}
+		setsFile := ""
+		if len(os.Args) >= 5 {
+			setsFile = os.Args[4]
+		}
+		committee, err := snapshotCommittee(spec, setsFile)
+		if err != nil {
+			log.Fatalf("could not verify snapshot: %v\n", err)
+		}
+		Import(committee, config.WalletDataPath, os.Args[3])
+		return
+	}
+	var err error
+	var engine recoverable
+	switch config.ConsensusEngine {
+	case "", "poa":
+		engine, err = poa.NewRoundRobinValidator(roundRobinConfig(config, credentials, spec))
+	case "swell":
+		engine, err = swell.NewSwellValidator(swellConfig(config, credentials, spec))
+	default:
+		log.Fatalf("unknown consensus engine: %v\n", config.ConsensusEngine)
+	}
+	if err != nil {
 		log.Fatalf("could not initiate node: %v\n", err)
 	}
-	fmt.Printf("\nnode started\ntoken:%v", credentials.PublicKey())
+	fmt.Printf("\nnode started\ntoken:%v\ngenesis:%v", credentials.PublicKey(), crypto.EncodeHash(spec.Hash()))
 
 	done := util.ShutdownEvents()
+	recoverOnHangup(engine)
 
 	if len(os.Args) >= 3 && os.Args[2] == "test" {
 		go Simulation(credentials, config.GatewayPort)
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/genesis"
+	"github.com/lienkolabs/breeze/protocol/state"
+)
+
+// Export requests the snapshot of the state at the last certified checkpoint
+// from the block broadcast service at address and writes it to file. The
+// snapshot is only written if it is certified by a quorum of the committee in
+// charge of its checkpoint.
+func Export(committee chain.Committee, address string, node crypto.Token, file string) {
+	_, key := crypto.RandomAsymetricKey()
+	certified, err := echo.SyncSnapshot(key, address, node, committee)
+	if err != nil {
+		log.Fatalf("could not sync snapshot: %v", err)
+	}
+	if err := state.WriteSnapshotFile(file, certified); err != nil {
+		log.Fatal(err)
+	}
+	snapshot := certified.Snapshot
+	fmt.Printf("snapshot at epoch %v with %v accounts written to %v\n", snapshot.Epoch, len(snapshot.Accounts), file)
+}
+
+// Import creates the state and the chain of the node on walletPath out of a
+// snapshot file certified by a quorum of the committee in charge of its
+// checkpoint, so that the node joins the network at the checkpoint of the
+// snapshot instead of genesis.
+func Import(committee chain.Committee, walletPath, file string) {
+	if walletPath == "" {
+		log.Fatalf("no wallet data path to import the snapshot to")
+	}
+	certified, err := state.ReadSnapshotFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	imported, err := state.ImportSnapshot(certified, committee, walletPath)
+	if err != nil {
+		log.Fatalf("could not import snapshot: %v", err)
+	}
+	imported.Shutdown()
+	if err := chain.ImportCheckpoint(certified.Certificate.Checkpoints[0], walletPath); err != nil {
+		log.Fatalf("could not import snapshot: %v", err)
+	}
+	fmt.Printf("state at epoch %v imported to %v\n", certified.Snapshot.Epoch, walletPath)
+}
+
+// snapshotCommittee returns the committee snapshots are verified against: the
+// genesis validators, or for a rotating validator set the sets persisted on
+// setsFile by a trusted validator.
+func snapshotCommittee(spec *genesis.Spec, setsFile string) (chain.Committee, error) {
+	if committee := spec.Committee(); committee != nil {
+		return committee, nil
+	}
+	if setsFile == "" {
+		return nil, errors.New("rotating validator set: a validator set file is required")
+	}
+	data, err := os.ReadFile(setsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read validator sets: %v", err)
+	}
+	rotation := chain.ParseRotation(data)
+	if rotation == nil {
+		return nil, errors.New("corrupted validator set file")
+	}
+	return rotation, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/network/trusted"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+// statusTimeout bounds the wait for the liveness reports of the node.
+const statusTimeout = 2 * time.Second
+
+// Status connects to the block broadcast port of the running node and prints
+// the liveness of validators on the current and the previous checkpoint
+// windows.
+func Status(node crypto.Token, port int) {
+	_, key := crypto.RandomAsymetricKey()
+	conn, err := trusted.Dial(fmt.Sprintf("localhost:%v", port), key, node)
+	if err != nil {
+		log.Fatalf("could not connect to node: %v", err)
+	}
+	defer conn.Shutdown()
+	if err := conn.Send(echo.NewLivenessRequest()); err != nil {
+		log.Fatalf("could not request liveness: %v", err)
+	}
+	reports := make(chan *chain.LivenessReport)
+	go func() {
+		for {
+			data, err := conn.Read()
+			if err != nil {
+				close(reports)
+				return
+			}
+			if report := echo.ParseLivenessMessage(data); report != nil {
+				reports <- report
+			}
+		}
+	}()
+	timeout := time.After(statusTimeout)
+	for count := 0; count < 2; count++ {
+		select {
+		case report, ok := <-reports:
+			if !ok {
+				return
+			}
+			printLiveness(report)
+		case <-timeout:
+			if count == 0 {
+				fmt.Println("no liveness reported by the node")
+			}
+			return
+		}
+	}
+}
+
+func printLiveness(report *chain.LivenessReport) {
+	first := report.Window*chain.CheckpointInterval + 1
+	last := (report.Window + 1) * chain.CheckpointInterval
+	fmt.Printf("\nwindow %v (epochs %v to %v)\n", report.Window, first, last)
+	fmt.Printf("%-64s %10s %10s %10s %12s\n", "validator", "proposed", "sealed", "missed", "invalidated")
+	for n, token := range report.Validators {
+		liveness := report.Liveness[n]
+		fmt.Printf("%-64s %10d %10d %10d %12d\n", token, liveness.Proposed, liveness.Sealed, liveness.Missed, liveness.Invalidated)
+	}
+}
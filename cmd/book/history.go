@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/genesis"
+	"github.com/lienkolabs/breeze/protocol/state"
+)
+
+// openGenesis reads the genesis file of the configuration, which must match
+// the genesis hash of the network.
+func openGenesis(config Config) (*genesis.Spec, error) {
+	spec, err := genesis.Load(config.GenesisFile)
+	if err != nil {
+		return nil, err
+	}
+	if !spec.Hash().Equal(crypto.DecodeHash(config.GenesisHash)) {
+		return nil, errors.New("genesis file does not match genesis hash")
+	}
+	chain.MaxProtocolEpoch = spec.MaxProtocolEpoch
+	return spec, nil
+}
+
+// validatorCommittee returns the committee blocks and snapshots are verified
+// against: the genesis validators, or for a rotating validator set the sets
+// persisted on setsFile by a trusted validator.
+func validatorCommittee(spec *genesis.Spec, setsFile string) (chain.Committee, error) {
+	if committee := spec.Committee(); committee != nil {
+		return committee, nil
+	}
+	if setsFile == "" {
+		return nil, errors.New("rotating validator set: a validator set file is required")
+	}
+	data, err := os.ReadFile(setsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read validator sets: %v", err)
+	}
+	rotation := chain.ParseRotation(data)
+	if rotation == nil {
+		return nil, errors.New("corrupted validator set file")
+	}
+	return rotation, nil
+}
+
+// openState opens the state book replays commited blocks on, with the balance
+// history of every epoch since genesis or since the snapshot of the
+// configuration, if any, for a new state.
+func openState(config Config, spec *genesis.Spec, committee chain.Committee) (*state.State, error) {
+	historyPath := ""
+	if config.StatePath != "" {
+		historyPath = fmt.Sprintf("%vhistory.dat", config.StatePath)
+		if _, err := os.Stat(fmt.Sprintf("%vstate.dat", config.StatePath)); os.IsNotExist(err) && config.SnapshotFile != "" {
+			if err := importSnapshot(committee, config.SnapshotFile, config.StatePath); err != nil {
+				return nil, err
+			}
+		}
+	}
+	commitState, err := state.OpenState(spec.StateAllocations(), config.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	commitState.UnbondingPeriod = spec.Unbonding()
+	if err := commitState.OpenHistory(historyPath); err != nil {
+		commitState.Shutdown()
+		return nil, err
+	}
+	return commitState, nil
+}
+
+// importSnapshot starts the state on statePath out of a snapshot certified by
+// a quorum of the committee in charge of its checkpoint.
+func importSnapshot(committee chain.Committee, file, statePath string) error {
+	certified, err := state.ReadSnapshotFile(file)
+	if err != nil {
+		return err
+	}
+	imported, err := state.ImportSnapshot(certified, committee, statePath)
+	if err != nil {
+		return err
+	}
+	imported.Shutdown()
+	return nil
+}
+
+// replay incorporates a commited block into the state. Blocks up to the epoch
+// of the state are skipped. It returns false if the state cannot follow the
+// chain any longer.
+func replay(commitState *state.State, block *chain.Block) bool {
+	if block.Epoch <= commitState.Epoch {
+		return true
+	}
+	if err := commitState.Replay(block); err != nil {
+		log.Printf("book: balance history stopped: %v", err)
+		return false
+	}
+	return true
+}
+
+// answerHistory sends the balance requested by the job on its connection.
+func answerHistory(history *state.History, job *echo.HistoryJob) {
+	answer := echo.HistoricalBalance{Epoch: job.Request.Epoch, Token: job.Request.Token}
+	wallet, deposit, err := history.Balance(crypto.HashToken(job.Request.Token), job.Request.Epoch)
+	if err == nil {
+		answer.Known, answer.Wallet, answer.Deposit = true, wallet, deposit
+	}
+	go job.Connection.Send(answer.Serialize())
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/lienkolabs/breeze/crypto"
 	"github.com/lienkolabs/breeze/network"
 	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/network/trusted"
 	"github.com/lienkolabs/breeze/protocol/actions"
 	"github.com/lienkolabs/breeze/store"
 	"github.com/lienkolabs/breeze/util"
@@ -19,6 +20,11 @@ type Config struct {
 	FileNameTemplate    string
 	NodeToken           string
 	SecureVaultPath     string
+	GenesisHash         string
+	GenesisFile         string // committee of the chain and genesis of the balance history
+	StatePath           string
+	SnapshotFile        string // optional: starts a new state at the snapshot
+	ValidatorsFile      string // validator sets of a rotating chain to verify blocks and the snapshot
 }
 
 func main() {
@@ -40,13 +46,35 @@ func main() {
 		log.Fatalf("credentials on security vault does not match config node token\n")
 	}
 
+	trusted.SetGenesis(crypto.DecodeHash(config.GenesisHash))
+
+	if config.GenesisFile == "" {
+		log.Fatalf("no genesis file specified in the configuration file\n")
+	}
+	spec, err := openGenesis(config)
+	if err != nil {
+		log.Fatalf("could not open genesis: %v\n", err)
+	}
+	committee, err := validatorCommittee(spec, config.ValidatorsFile)
+	if err != nil {
+		log.Fatalf("could not set committee: %v\n", err)
+	}
+
 	jobs := make(chan *echo.NewIndexJob)
+	proofs := make(chan *echo.ProofJob)
 	configDB := echo.DBPoolConfig{
 		Credentials: credentials,
 		Validator:   network.AcceptAllConnections,
 		ServePort:   config.ServePort,
 		Job:         jobs,
+		Proof:       proofs,
+	}
+	commitState, err := openState(config, spec, committee)
+	if err != nil {
+		log.Fatalf("could not open balance history: %v\n", err)
 	}
+	history := make(chan *echo.HistoryJob)
+	configDB.History = history
 
 	server, err := echo.NewDBPool(&configDB)
 	if err != nil {
@@ -57,6 +85,7 @@ func main() {
 		Credentials:         credentials,
 		BlockServiceAddress: config.BlockServiceAddress,
 		BlockServiveToken:   crypto.TokenFromString(config.BlockServiveToken),
+		Committee:           committee,
 	}
 
 	listener, err := echo.NewBlockListener(&configBlock)
@@ -70,20 +99,38 @@ func main() {
 		server.Shutdown()
 		log.Fatalf("could not launch block db instance: %v", err)
 	}
+	db.SetCommittee(committee)
 
 	shutdown := make(chan chan struct{})
+	replaying := true
 
 	go func() {
 		for {
 			select {
 			case block := <-listener.Block:
 				db.IncorporateBlock(block)
+				if replaying {
+					replaying = replay(commitState, block)
+				}
+			case epoch := <-listener.Recovery:
+				db.Truncate(epoch)
+				if replaying && epoch < commitState.Epoch {
+					if err := commitState.Rollback(epoch); err != nil {
+						log.Printf("book: balance history stopped: %v", err)
+						replaying = false
+					}
+				}
+			case job := <-history:
+				answerHistory(commitState.History, job)
 			case job := <-jobs:
 				db.AppendJob(job)
+			case job := <-proofs:
+				db.AnswerProof(job)
 			case confirm := <-shutdown:
 				server.Shutdown()
 				listener.Shutdown()
 				db.Close()
+				commitState.Shutdown()
 				confirm <- struct{}{}
 				return
 			}
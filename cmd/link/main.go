@@ -12,6 +12,7 @@ import (
 	"github.com/lienkolabs/breeze/crypto"
 	"github.com/lienkolabs/breeze/network"
 	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/network/trusted"
 	"github.com/lienkolabs/breeze/protocol/actions"
 	"github.com/lienkolabs/breeze/util"
 )
@@ -31,6 +32,7 @@ type Config struct {
 	BreezeNodeToken   string
 	SecureVaultPath   string
 	NodeToken         string
+	GenesisHash       string
 }
 
 type Gateway struct {
@@ -108,6 +110,7 @@ func main() {
 	if !token.Equal(credentials.PublicKey()) {
 		log.Fatalln("vault credentials does not match node token")
 	}
+	trusted.SetGenesis(crypto.DecodeHash(config.GenesisHash))
 	gateway.Credentials = credentials
 	gateway.GatewayPort = config.GatewayPort
 
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 
 	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/trusted"
 	"github.com/lienkolabs/breeze/util"
 )
 
@@ -16,6 +17,7 @@ type Config struct {
 	GatewayToken  string
 	Provider      string
 	ProviderToken string
+	Genesis       string
 }
 
 func GetNewConfig() Config {
@@ -65,6 +67,8 @@ func GetConfig() Config {
 	}
 	var config Config
 	json.Unmarshal(bytes, &config)
+	// connections are refused by nodes of a network with another genesis
+	trusted.SetGenesis(crypto.DecodeHash(config.Genesis))
 	return config
 }
 
@@ -105,7 +109,24 @@ func configureGateway(help util.Help) {
 	fmt.Printf("\nConfiguration:\nBreeze gateway address: %v %v\nBreeze data provider address: %v %v\n\n", config.Gateway, config.GatewayToken, config.Provider, config.ProviderToken)
 }
 
+func configureGenesis(help util.Help) {
+	config := GetConfig()
+	if len(os.Args) < 3 {
+		help.Command("config-genesis")
+		return
+	}
+	if crypto.DecodeHash(os.Args[2]).Equal(crypto.Hash{}) {
+		fmt.Println("cannot parse genesis hash")
+		help.Command("config-genesis")
+		return
+	}
+	config.Genesis = os.Args[2]
+	SaveConfig(config)
+	fmt.Printf("\nGenesis: %v\n\n", config.Genesis)
+}
+
 func showConfig(help util.Help) {
 	config := GetConfig()
 	fmt.Printf("\nConfiguration:\nBreeze gateway address: %v %v\nBreeze data provider address: %v %v\n\n", config.Gateway, config.GatewayToken, config.Provider, config.ProviderToken)
+	fmt.Printf("Genesis: %v\n\n", config.Genesis)
 }
@@ -42,6 +42,13 @@ var help = util.Help{
 			Execute:     configureProvider,
 		},
 
+		"config-genesis": {
+			Usage:       "safe config-genesis genesis-hash",
+			Short:       "define the genesis hash of the breeze network",
+			Description: "",
+			Execute:     configureGenesis,
+		},
+
 		"show-config": {
 			Usage:       "safe show-config",
 			Short:       "show configurations",
@@ -94,7 +101,8 @@ var help = util.Help{
 }
 
 const helpDeposit = `Deposited tokens will remain frozen and cannot be used for transfers until 
-withdrawn.
+withdrawn. Withdrawn tokens are credited back to the wallet after an unbonding
+period set by the genesis of the network.
 
 In order to candidate for participation within validator network the holder of
 secrets associated with the token must run a validating node with annoucing the
@@ -1,14 +1,51 @@
+// Package consensus implements the engine shared by breeze validators. Engines
+// differ only by their Schedule: proof-of-authority validators follow a round
+// robin over an authority set, see package poa, and swell validators a stake
+// weighted draw, see package swell.
 package consensus
 
 import (
+	"time"
+
 	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
 )
 
+// Network is implemented by consensus engines. Block formation events relayed
+// by the proposer of a block are delivered through its methods, and actions
+// submitted to the node by clients are received on the Gateway channel.
+// Commits must carry a quorum certificate of the votes of validators on the
+// sealed block.
 type Network interface {
-	CommitBlock(uint64)
+	CommitBlock(epoch uint64, hash, parent crypto.Hash, invalidated []crypto.Hash, root crypto.Hash, certificate *chain.QuorumCertificate)
 	RolloverBlock(uint64)
-	NextBlock(epoch, checkpoint uint64, parent crypto.Hash)
-	SealBlock()
+	NextBlock(epoch, checkpoint uint64, parent crypto.Hash, proposer crypto.Token)
+	SealBlock(timestamp time.Time, hash crypto.Hash, signature crypto.Signature)
 	Validated([]byte)
 	Gateway() chan []byte
 }
+
+// Broadcaster relays the events of an engine to the listeners of the node and,
+// if the node is on a gossip network, to other validators. It is implemented
+// by echo.BroadcastPool.
+type Broadcaster interface {
+	BroadcastAction(data []byte)
+	BrodcastNextBlock(epoch, checkpoint uint64, checkpointHash crypto.Hash, publisher crypto.Token)
+	BrodcastSealBlock(timestamp time.Time, actionsRoot, hash crypto.Hash, signature crypto.Signature)
+	BrodcastCommitBlock(epoch uint64, hash, parent crypto.Hash, invalidated []crypto.Hash, certificate *chain.QuorumCertificate, root crypto.Hash)
+	BroadcastRollover(epoch uint64)
+	BroadcastVote(vote *chain.Vote)
+	BroadcastCheckpoint(checkpoint *chain.Checkpoint)
+	BroadcastCheckpointCertificate(certificate *chain.CheckpointCertificate)
+	BroadcastRecoveryRequest(request *chain.RecoveryRequest)
+	BroadcastRecovery(certificate *chain.RecoveryCertificate)
+	BroadcastValidatorSet(certificate *chain.SetCertificate)
+	BroadcastSetEndorsement(endorsement *chain.SetEndorsement)
+	BroadcastViewChange(change *chain.ViewChange)
+	BroadcastNewView(certificate *chain.ViewCertificate)
+	UpdateLiveness(report *chain.LivenessReport)
+	BroadcastLiveness(report *chain.LivenessReport)
+	UpdateSnapshot(certified *state.CertifiedSnapshot)
+	Append(block *chain.Block)
+}
@@ -0,0 +1,626 @@
+package consensus
+
+import (
+	"log"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/network/trusted"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
+)
+
+// ViewTimeout is the number of block intervals without a commit after which a
+// validator requests the replacement of the proposer of the stalled epoch.
+const ViewTimeout = 3
+
+// Schedule is the rule by which an engine picks the proposer of each block and
+// the committee voting on it. Engines differ only by their schedule.
+type Schedule interface {
+	// Proposer returns the token entitled to propose the block of the given
+	// epoch at the given view. The proposer of view n replaces the proposer of
+	// view n-1 once a quorum of the committee requested it.
+	Proposer(epoch, view uint64) crypto.Token
+	// Committee returns the validators voting on blocks.
+	Committee() chain.Committee
+	// Commited updates the schedule after the commit of the block of the given
+	// epoch and hash. It returns the validator set to be endorsed and
+	// announced to listeners, if the commit changed it, or nil.
+	Commited(epoch uint64, hash crypto.Hash) *chain.ValidatorSet
+}
+
+var _ Network = &Engine{}
+
+var _ Broadcaster = &echo.BroadcastPool{}
+
+// Engine is a validator working along the other validators of its schedule.
+// The proposer of each epoch forms, seals and commits its block broadcasting
+// every step to its listeners. The remaining validators follow the proposer
+// messages, vote on its sealed block and relay its messages to their own
+// listeners. Actions received on the gateway by a node that is not proposing
+// are kept until its turn comes. If the proposer of an epoch stalls,
+// validators agree on a view change that hands the epoch over to the proposer
+// of the next view.
+type Engine struct {
+	credentials crypto.PrivateKey
+	token       crypto.Token
+	schedule    Schedule
+	chain       *chain.Chain
+	pool        Broadcaster
+	actions     chan []byte
+	messages    chan trusted.Message
+	pending     [][]byte
+	certificate *chain.QuorumCertificate // votes on own sealed block
+	// signatures of other nodes on the own last checkpoint
+	certifying *chain.CheckpointCertificate
+	// snapshot of the state at the own last checkpoint, until certified
+	snapshot *state.CertifiedSnapshot
+	// blocks competing with those the chain follows, by proposer
+	forming map[crypto.Token]*chain.Block
+	// checkpoints of other nodes ahead of the own chain
+	peerCheckpoints map[uint64][]*chain.Checkpoint
+	// endorsements of the validator set computed at the last checkpoint
+	endorsing *chain.SetCertificate
+	// last validator set certified by the outgoing set
+	validators *chain.SetCertificate
+	// endorsements of other nodes ahead of the own chain
+	endorsements map[uint64][]*chain.SetEndorsement
+	recovery     chan chan error
+	// requests to recover to the own last checkpoint
+	recovering *chain.RecoveryCertificate
+	// view changes requested for the epoch subsequent to the last commit
+	views     map[uint64]*chain.ViewCertificate
+	requested uint64 // last view requested by the node
+	stalled   int    // block intervals since the last commit or view change
+}
+
+// NewEngine returns an engine on the given chain relaying its events to pool.
+// The committee of the chain is set to the committee of the schedule, and
+// evidence of double signs on its state is checked against the schedule. The
+// engine runs no event loop: it is driven by its caller through Resume, Tick,
+// Receive and Deliver, none of which may be called concurrently, or by Start.
+func NewEngine(credentials crypto.PrivateKey, schedule Schedule, blockchain *chain.Chain, pool Broadcaster) *Engine {
+	blockchain.Committee = schedule.Committee()
+	engine := &Engine{
+		credentials:     credentials,
+		token:           credentials.PublicKey(),
+		schedule:        schedule,
+		chain:           blockchain,
+		pool:            pool,
+		messages:        make(chan trusted.Message),
+		pending:         make([][]byte, 0),
+		peerCheckpoints: make(map[uint64][]*chain.Checkpoint),
+		endorsements:    make(map[uint64][]*chain.SetEndorsement),
+		recovery:        make(chan chan error),
+		views:           make(map[uint64]*chain.ViewCertificate),
+		forming:         make(map[crypto.Token]*chain.Block),
+	}
+	if commitState, ok := blockchain.CommitState.(*state.State); ok {
+		commitState.Scheduled = engine.scheduled
+	}
+	return engine
+}
+
+// Start resumes the engine and runs its event loop: the block interval is
+// ticked, actions of the gateway received, messages of other validators
+// delivered and balance requests of listeners answered.
+func (e *Engine) Start(interval time.Duration, actions chan []byte, balances chan *echo.BalanceJob) {
+	e.actions = actions
+	ticker := time.NewTicker(interval)
+	e.Resume()
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				e.Tick()
+			case action := <-actions:
+				e.Receive(action)
+			case msg := <-e.messages:
+				e.Deliver(msg)
+			case done := <-e.recovery:
+				done <- e.requestRecovery()
+			case job := <-balances:
+				e.balance(job)
+			}
+		}
+	}()
+}
+
+// Resume announces the last validator set certified since the engine started,
+// if any, and proposes the block subsequent to the last commit if the node is
+// scheduled to propose it. Votes gathered on an own block not yet commited are
+// discarded.
+func (e *Engine) Resume() {
+	e.certificate = nil
+	if e.validators != nil {
+		e.pool.BroadcastValidatorSet(e.validators)
+	}
+	e.proposeNext(e.chain.LastCommitEpoch)
+}
+
+// Tick marks the end of the block interval: the live block is sealed and
+// commited if the node is its proposer. After ViewTimeout intervals without a
+// commit the node requests a view change.
+func (e *Engine) Tick() {
+	e.sealOwnBlock()
+	e.stalled += 1
+	if e.stalled < ViewTimeout {
+		return
+	}
+	e.stalled = 0
+	view := e.chain.View
+	if e.requested > view {
+		view = e.requested
+	}
+	e.requestView(view + 1)
+}
+
+// Receive incorporates an action from the gateway into the live block if the
+// node is its proposer, otherwise keeps it pending.
+func (e *Engine) Receive(action []byte) {
+	if e.isProposing() {
+		e.Validated(action)
+		return
+	}
+	e.pending = append(e.pending, action)
+}
+
+func (e *Engine) isProposing() bool {
+	return e.chain.LiveBlock != nil && e.chain.LiveBlock.Proposer.Equal(e.token)
+}
+
+// Deliver routes a message received from another validator to the engine
+// if the validator is the proposer the message refers to.
+func (e *Engine) Deliver(msg trusted.Message) {
+	if header := echo.ParseBlockHeader(msg.Data); header != nil {
+		if !e.proposer(header.Epoch).Equal(msg.Token) || !header.Publisher.Equal(msg.Token) {
+			return
+		}
+		if e.competing(header) {
+			e.compete(header)
+		} else {
+			e.NextBlock(header.Epoch, header.Checkpoint, header.CheckpointHash, header.Publisher)
+		}
+		return
+	}
+	if request := echo.ParseRecoveryRequestMessage(msg.Data); request != nil {
+		if request.Token.Equal(msg.Token) {
+			e.recoveryRequest(request)
+		}
+		return
+	}
+	if decision := echo.ParseRecoveryMessage(msg.Data); decision != nil {
+		if decision.Epoch > e.chain.Recovered {
+			e.recover(decision)
+		}
+		return
+	}
+	if change := echo.ParseViewChangeMessage(msg.Data); change != nil {
+		if change.Token.Equal(msg.Token) {
+			e.viewChange(change)
+		}
+		return
+	}
+	if certificate := echo.ParseNewViewMessage(msg.Data); certificate != nil {
+		if certificate.Epoch == e.chain.LastCommitEpoch+1 && certificate.View > e.chain.View && certificate.Verify(e.chain.Committee) {
+			e.newView(certificate)
+		}
+		return
+	}
+	if endorsement := echo.ParseSetEndorsementMessage(msg.Data); endorsement != nil {
+		if endorsement.Token.Equal(msg.Token) {
+			e.endorsement(endorsement)
+		}
+		return
+	}
+	if checkpoint := echo.ParseCheckpointMessage(msg.Data); checkpoint != nil {
+		if checkpoint.Signer.Equal(msg.Token) {
+			e.compare(checkpoint)
+		}
+		return
+	}
+	if vote := echo.ParseVoteMessage(msg.Data); vote != nil {
+		if vote.Token.Equal(msg.Token) {
+			e.vote(vote)
+		}
+		return
+	}
+	if commit := echo.ParseCommitBlock(msg.Data); commit != nil {
+		if e.proposer(commit.Epoch).Equal(msg.Token) {
+			e.CommitBlock(commit.Epoch, commit.Hash, commit.ParentHash, commit.Invalidate, commit.StateRoot, commit.Certificate)
+		}
+		return
+	}
+	if rollover := echo.ParseRolloverBlock(msg.Data); rollover != nil {
+		if rollover.Token.Equal(msg.Token) && e.proposer(rollover.Epoch).Equal(msg.Token) && rollover.Verify() {
+			e.RolloverBlock(rollover.Epoch)
+		}
+		return
+	}
+	if block, ok := e.forming[msg.Token]; ok {
+		e.form(msg.Data, block)
+		return
+	}
+	if e.chain.LiveBlock == nil || !e.chain.LiveBlock.Proposer.Equal(msg.Token) {
+		return
+	}
+	if action := echo.ParseAction(msg.Data); action != nil {
+		e.Validated(action)
+	} else if seal := echo.ParseBlockTail(msg.Data); seal != nil {
+		e.SealBlock(seal.Timestamp, seal.Hash, seal.Signature)
+	}
+}
+
+// sealOwnBlock seals and commits the live block if the node is its proposer.
+func (e *Engine) sealOwnBlock() {
+	if !e.isProposing() {
+		return
+	}
+	block := e.chain.SealOwnBlock()
+	e.pool.BrodcastSealBlock(block.ProposedAt, block.ActionsRoot, block.Hash, block.SealSignature)
+	if !e.voting() {
+		return
+	}
+	if _, err := e.chain.PrepareCommit(block.Epoch, block.Hash); err != nil {
+		log.Printf("consensus: could not prepare commit of own block %v: %v", block.Epoch, err)
+		return
+	}
+	vote := chain.NewVote(block.Epoch, block.Hash, block.CommitHash(), e.credentials)
+	e.pool.BroadcastVote(vote)
+	e.certificate = chain.NewQuorumCertificate(block.Epoch, block.Hash, block.CommitHash())
+	e.certificate.Append(vote)
+	e.commitOwnBlock()
+}
+
+// vote incorporates the vote of a validator on the own sealed block.
+func (e *Engine) vote(vote *chain.Vote) {
+	if e.certificate != nil && e.certificate.Append(vote) {
+		e.commitOwnBlock()
+	}
+}
+
+// commitOwnBlock commits the own sealed block once votes of a quorum of the
+// committee are gathered.
+func (e *Engine) commitOwnBlock() {
+	certificate := e.certificate
+	if certificate == nil || !certificate.Verify(e.chain.Committee) {
+		return
+	}
+	e.certificate = nil
+	if err := e.chain.CommitOwnBlock(certificate); err != nil {
+		log.Printf("consensus: could not commit own block %v: %v", certificate.Epoch, err)
+		return
+	}
+	block := e.chain.SealedBlocks[certificate.Epoch]
+	e.pool.BrodcastCommitBlock(block.Epoch, block.Hash, block.PreviousHash, block.Invalidate, certificate, block.StateRoot)
+	e.commited(block)
+}
+
+// commited hands a commited block over to the pool and to the schedule and
+// proposes the next block if the node is scheduled to.
+func (e *Engine) commited(block *chain.Block) {
+	e.forming = make(map[crypto.Token]*chain.Block)
+	e.pool.Append(block)
+	e.checkpoint(block)
+	if set := e.schedule.Commited(block.Epoch, block.Hash); set != nil {
+		e.endorse(set)
+	}
+	e.liveness(block.Epoch)
+	e.resetView()
+	e.proposeNext(block.Epoch)
+}
+
+// proposer returns the token entitled to propose the block of the given epoch
+// at the view of the chain. Views only apply to the epoch subsequent to the
+// last commit.
+func (e *Engine) proposer(epoch uint64) crypto.Token {
+	view := uint64(0)
+	if epoch == e.chain.LastCommitEpoch+1 {
+		view = e.chain.View
+	}
+	return e.schedule.Proposer(epoch, view)
+}
+
+// scheduled returns true if token proposes the block of the given epoch at
+// some view. Views cycle through the committee of the epoch, so every member
+// of the committee is scheduled for views up to the committee size.
+func (e *Engine) scheduled(epoch uint64, token crypto.Token) bool {
+	members := e.chain.Committee.Members(epoch)
+	for view := range members {
+		if e.schedule.Proposer(epoch, uint64(view)).Equal(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// proposeNext starts the block subsequent to the commited epoch if the node is
+// scheduled to propose it. Pending actions are incorporated into the new block.
+func (e *Engine) proposeNext(commited uint64) {
+	epoch := commited + 1
+	if !e.proposer(epoch).Equal(e.token) {
+		return
+	}
+	if err := e.chain.NextBlock(epoch, commited, e.chain.LastCommitHash, e.token); err != nil {
+		log.Printf("consensus: could not propose block %v: %v", epoch, err)
+		return
+	}
+	e.pool.BrodcastNextBlock(epoch, commited, e.chain.LastCommitHash, e.token)
+	pending := e.pending
+	e.pending = make([][]byte, 0)
+	for _, action := range pending {
+		e.Validated(action)
+	}
+}
+
+// checkpoint broadcasts the checkpoint produced by the commit of the given
+// block, if any, and keeps the snapshot of the state at the checkpoint to hand
+// it over to the pool once the checkpoint is certified.
+func (e *Engine) checkpoint(block *chain.Block) {
+	epoch := block.Epoch
+	checkpoint := e.chain.LastCheckpoint
+	if checkpoint == nil || checkpoint.Epoch != epoch {
+		return
+	}
+	e.pool.BroadcastCheckpoint(checkpoint)
+	if commitState, ok := e.chain.CommitState.(*state.State); ok {
+		e.snapshot = &state.CertifiedSnapshot{
+			Commit:   chain.NewCertifiedCommit(block),
+			Snapshot: commitState.Snapshot(checkpoint.BlockHash, checkpoint.ChainHash),
+		}
+	}
+	e.certifying = chain.NewCheckpointCertificate(checkpoint)
+	e.certify()
+	peers := e.peerCheckpoints[epoch]
+	delete(e.peerCheckpoints, epoch)
+	for _, peer := range peers {
+		e.compare(peer)
+	}
+}
+
+// endorse signs the validator set computed at a checkpoint if the node is a
+// member of the outgoing set, the set in charge of the checkpoint epoch.
+// Endorsements of the outgoing set are gathered until a quorum of it certifies
+// the new set, which is then announced to listeners.
+func (e *Engine) endorse(set *chain.ValidatorSet) {
+	e.endorsing = chain.NewSetCertificate(set)
+	for _, member := range e.chain.Committee.Members(set.Epoch) {
+		if member.Equal(e.token) {
+			endorsement := chain.NewSetEndorsement(set, e.credentials)
+			e.pool.BroadcastSetEndorsement(endorsement)
+			e.endorsing.Append(endorsement)
+			break
+		}
+	}
+	e.announce()
+	peers := e.endorsements[set.Epoch]
+	delete(e.endorsements, set.Epoch)
+	for _, peer := range peers {
+		e.endorsement(peer)
+	}
+}
+
+// endorsement incorporates the endorsement of another node on the validator
+// set computed at the last checkpoint. Endorsements ahead of the own chain are
+// kept until the own set is computed.
+func (e *Engine) endorsement(peer *chain.SetEndorsement) {
+	if e.endorsing == nil || e.endorsing.Set.Epoch < peer.Epoch {
+		if peer.Epoch > e.chain.LastCommitEpoch {
+			e.endorsements[peer.Epoch] = append(e.endorsements[peer.Epoch], peer)
+		}
+		return
+	}
+	if e.endorsing.Append(peer) {
+		e.announce()
+	}
+}
+
+// announce broadcasts the set under endorsement once certified by a quorum of
+// the outgoing set.
+func (e *Engine) announce() {
+	if e.validators == e.endorsing || !e.endorsing.Verify(e.chain.Committee) {
+		return
+	}
+	e.validators = e.endorsing
+	e.pool.BroadcastValidatorSet(e.validators)
+}
+
+// liveness hands the liveness of validators on the window of the commited
+// epoch over to the pool. The report of the window closed by a checkpoint is
+// broadcast to listeners.
+func (e *Engine) liveness(epoch uint64) {
+	if chain.IsCheckpoint(epoch) {
+		if closed := e.chain.LivenessReport(chain.CheckpointWindow(epoch - 1)); closed != nil {
+			e.pool.BroadcastLiveness(closed)
+		}
+	}
+	if report := e.chain.LivenessReport(chain.CheckpointWindow(epoch)); report != nil {
+		e.pool.UpdateLiveness(report)
+	}
+}
+
+// balance answers a listener with the proof of the balances of an account
+// against the state root of the last commited block.
+func (e *Engine) balance(job *echo.BalanceJob) {
+	commitState, ok := e.chain.CommitState.(*state.State)
+	if !ok {
+		return
+	}
+	proof := echo.BalanceProof{Epoch: e.chain.LastCommitEpoch, Root: commitState.Root(), Proof: commitState.Proof(job.Account)}
+	job.Connection.Send(proof.Serialize())
+}
+
+// compare checks the checkpoint of another node against the own checkpoint
+// for the same epoch, logging any divergence. Matching checkpoints are gathered
+// until a quorum of the committee certifies the own checkpoint. Checkpoints
+// ahead of the own chain are kept until the own checkpoint is produced.
+func (e *Engine) compare(peer *chain.Checkpoint) {
+	if !chain.IsCheckpoint(peer.Epoch) {
+		return
+	}
+	own := e.chain.LastCheckpoint
+	if own == nil || own.Epoch < peer.Epoch {
+		if peer.Epoch > e.chain.LastCommitEpoch {
+			e.peerCheckpoints[peer.Epoch] = append(e.peerCheckpoints[peer.Epoch], peer)
+		}
+		return
+	}
+	if own.Epoch != peer.Epoch {
+		return
+	}
+	if own.Matches(peer) {
+		if e.certifying == nil || e.certifying.Epoch != own.Epoch {
+			e.certifying = chain.NewCheckpointCertificate(own)
+		}
+		if e.certifying.Append(peer) {
+			e.certify()
+		}
+	} else {
+		log.Printf("consensus: checkpoint %v diverges from %v: chain %v state %v, expected chain %v state %v", peer.Epoch, peer.Signer, crypto.EncodeHash(peer.ChainHash), crypto.EncodeHash(peer.StateHash), crypto.EncodeHash(own.ChainHash), crypto.EncodeHash(own.StateHash))
+	}
+}
+
+// certify records the certificate of the own last checkpoint once it gathers
+// a quorum of the committee, and hands the snapshot of the state at the
+// checkpoint over to the pool.
+func (e *Engine) certify() {
+	certificate := e.certifying
+	if !certificate.Verify(e.chain.Committee) || e.chain.Certified == certificate {
+		return
+	}
+	if err := e.chain.Certify(certificate); err != nil {
+		log.Printf("consensus: could not certify checkpoint %v: %v", certificate.Epoch, err)
+		return
+	}
+	e.pool.BroadcastCheckpointCertificate(certificate)
+	if e.snapshot == nil || e.snapshot.Commit == nil || e.snapshot.Snapshot.Epoch != certificate.Epoch {
+		return
+	}
+	e.snapshot.Certificate = certificate
+	e.pool.UpdateSnapshot(e.snapshot)
+	e.snapshot = nil
+}
+
+func (e *Engine) NextBlock(epoch, checkpoint uint64, parent crypto.Hash, proposer crypto.Token) {
+	if !e.proposer(epoch).Equal(proposer) {
+		return
+	}
+	if err := e.chain.NextBlock(epoch, checkpoint, parent, proposer); err != nil {
+		log.Printf("consensus: could not follow block %v: %v", epoch, err)
+		return
+	}
+	e.pool.BrodcastNextBlock(epoch, checkpoint, parent, proposer)
+}
+
+func (e *Engine) Validated(action []byte) {
+	if e.chain.Validate(action) {
+		e.pool.BroadcastAction(action)
+	}
+}
+
+func (e *Engine) SealBlock(timestamp time.Time, hash crypto.Hash, signature crypto.Signature) {
+	if e.chain.LiveBlock == nil {
+		return
+	}
+	epoch := e.chain.LiveBlock.Epoch
+	if err := e.chain.SealBlock(timestamp, 0, hash, signature); err != nil {
+		log.Printf("consensus: could not seal block: %v", err)
+		return
+	}
+	e.pool.BrodcastSealBlock(timestamp, e.chain.Candidates[epoch][hash].ActionsRoot, hash, signature)
+	if !e.voting() {
+		return
+	}
+	// votes cover the outcome of the commit, which is only known for the block
+	// subsequent to the last commit
+	block, err := e.chain.PrepareCommit(epoch, hash)
+	if err != nil {
+		log.Printf("consensus: could not prepare commit of block %v: %v", epoch, err)
+		return
+	}
+	e.pool.BroadcastVote(chain.NewVote(epoch, hash, block.CommitHash(), e.credentials))
+}
+
+func (e *Engine) CommitBlock(epoch uint64, hash, parent crypto.Hash, invalidated []crypto.Hash, root crypto.Hash, certificate *chain.QuorumCertificate) {
+	if err := e.chain.CommitBlock(epoch, hash, parent, invalidated, root, certificate); err != nil {
+		log.Printf("consensus: could not commit block %v: %v", epoch, err)
+		return
+	}
+	block := e.chain.SealedBlocks[epoch]
+	e.pool.BrodcastCommitBlock(epoch, hash, parent, invalidated, certificate, block.StateRoot)
+	e.commited(block)
+}
+
+func (e *Engine) RolloverBlock(epoch uint64) {
+	if err := e.chain.RolloverBlock(epoch); err != nil {
+		log.Printf("consensus: could not rollover to block %v: %v", epoch, err)
+		return
+	}
+	e.pool.BroadcastRollover(epoch)
+}
+
+// Recover is the disaster recovery mechanism to be triggered by the operator.
+// It requests other validators to restore the chain to its last checkpoint,
+// which must be certified by a quorum of the committee. The chain is restored
+// once operators of a quorum of the committee requested the recovery to the
+// same checkpoint, and a recovery event carrying their requests is broadcast
+// so that other validators and listeners discard blocks after it. It must
+// only be called on an engine running its event loop.
+func (e *Engine) Recover() error {
+	done := make(chan error)
+	e.recovery <- done
+	return <-done
+}
+
+// requestRecovery signs and broadcasts the request of the node to recover to
+// its last checkpoint.
+func (e *Engine) requestRecovery() error {
+	request, err := e.chain.RecoveryRequest()
+	if err != nil {
+		return err
+	}
+	e.pool.BroadcastRecoveryRequest(request)
+	e.recoveryRequest(request)
+	return nil
+}
+
+// recoveryRequest tallies a request to recover to the own last checkpoint.
+// The chain recovers once a quorum of the committee requested it.
+func (e *Engine) recoveryRequest(request *chain.RecoveryRequest) {
+	checkpoint := e.chain.LastCheckpoint
+	if checkpoint == nil || request.Epoch != checkpoint.Epoch || request.Epoch <= e.chain.Recovered {
+		return
+	}
+	if e.recovering == nil || e.recovering.Epoch != request.Epoch {
+		e.recovering = chain.NewRecoveryCertificate(checkpoint.Epoch, checkpoint.Hash())
+	}
+	if e.recovering.Append(request) && e.recovering.Verify(e.chain.Committee) {
+		e.recover(e.recovering)
+	}
+}
+
+// recover restores the chain to the checkpoint decided by a quorum and relays
+// the decision.
+func (e *Engine) recover(decision *chain.RecoveryCertificate) {
+	if err := e.chain.Recover(decision); err != nil {
+		log.Printf("consensus: could not recover to checkpoint %v: %v", decision.Epoch, err)
+		return
+	}
+	e.certificate = nil
+	e.recovering = nil
+	e.forming = make(map[crypto.Token]*chain.Block)
+	e.resetView()
+	e.pool.BroadcastRecovery(decision)
+	e.proposeNext(decision.Epoch)
+}
+
+func (e *Engine) Gateway() chan []byte {
+	return e.actions
+}
+
+// Chain returns the chain of the engine. It must not be accessed concurrently
+// with the event loop of the engine.
+func (e *Engine) Chain() *chain.Chain {
+	return e.chain
+}
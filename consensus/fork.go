@@ -0,0 +1,62 @@
+package consensus
+
+import (
+	"log"
+
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+// A proposer may publish more than one block for its epoch, as an equivocating
+// proposer would. The block the chain follows live is the first one, and the
+// blocks announced after it are assembled apart and added to the candidates
+// of the chain once sealed, so that the commit of any of them can be followed.
+// Sealed competing blocks are relayed to listeners at once, so that their
+// messages do not interleave with those of the block under formation.
+
+// competing returns true if a block announced for the given epoch competes
+// with a block the chain already follows for it.
+func (e *Engine) competing(header *echo.BlockHeader) bool {
+	if e.chain.LiveBlock != nil && e.chain.LiveBlock.Epoch == header.Epoch {
+		return true
+	}
+	return len(e.chain.Candidates[header.Epoch]) > 0
+}
+
+// compete starts the assembly of a competing block.
+func (e *Engine) compete(header *echo.BlockHeader) {
+	e.forming[header.Publisher] = &chain.Block{
+		Epoch:          header.Epoch,
+		CheckPoint:     header.Checkpoint,
+		CheckpointHash: header.CheckpointHash,
+		Proposer:       header.Publisher,
+		Actions:        make([][]byte, 0),
+	}
+}
+
+// form incorporates a block formation message of a proposer into its
+// competing block. Sealed blocks are added to the candidates of the chain.
+func (e *Engine) form(msg []byte, block *chain.Block) {
+	if action := echo.ParseAction(msg); action != nil {
+		block.Actions = append(block.Actions, action)
+		return
+	}
+	seal := echo.ParseBlockTail(msg)
+	if seal == nil {
+		return
+	}
+	delete(e.forming, block.Proposer)
+	block.ProposedAt = seal.Timestamp
+	block.ActionsRoot = seal.ActionsRoot
+	block.Hash = seal.Hash
+	block.SealSignature = seal.Signature
+	if err := e.chain.AddCandidate(block); err != nil {
+		log.Printf("consensus: could not add competing block %v: %v", block.Epoch, err)
+		return
+	}
+	e.pool.BrodcastNextBlock(block.Epoch, block.CheckPoint, block.CheckpointHash, block.Proposer)
+	for _, action := range block.Actions {
+		e.pool.BroadcastAction(action)
+	}
+	e.pool.BrodcastSealBlock(block.ProposedAt, block.ActionsRoot, block.Hash, block.SealSignature)
+}
@@ -0,0 +1,126 @@
+package consensus
+
+import (
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/network/gossip"
+	"github.com/lienkolabs/breeze/network/trusted"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/genesis"
+	"github.com/lienkolabs/breeze/protocol/state"
+)
+
+var reconnectInterval = 5 * time.Second
+
+// Peer is another validator of the network. Address is the host:port of its
+// block broadcast service and PeerAddress the host:port of its peer-to-peer
+// service.
+type Peer struct {
+	Token       crypto.Token
+	Address     string
+	PeerAddress string
+}
+
+// NodeConfig is the configuration shared by validators of every schedule.
+type NodeConfig struct {
+	Credentials   crypto.PrivateKey
+	GatewayPort   int
+	BroadcastPort int
+	WalletPath    string
+	Genesis       *genesis.Spec
+	PeerPort      int // if set validators communicate through a gossip mesh
+}
+
+// Node is the commited state and chain of a validator together with its
+// actions gateway and its block broadcast service.
+type Node struct {
+	State   *state.State
+	Chain   *chain.Chain
+	Pool    *echo.BroadcastPool
+	actions chan []byte
+	config  *NodeConfig
+}
+
+// OpenNode resumes the state and the chain persisted on the wallet path of the
+// configuration, or starts them from genesis, and opens the gateway and the
+// broadcast ports of the node.
+func OpenNode(config *NodeConfig) (*Node, error) {
+	chain.MaxProtocolEpoch = config.Genesis.MaxProtocolEpoch
+	commitState, err := state.OpenState(config.Genesis.StateAllocations(), config.WalletPath)
+	if err != nil {
+		return nil, err
+	}
+	commitState.UnbondingPeriod = config.Genesis.Unbonding()
+	blockchain, err := chain.OpenChain(config.Credentials, commitState, config.Genesis.Hash(), config.WalletPath)
+	if err != nil {
+		return nil, err
+	}
+	actions := make(chan []byte)
+	if _, err := echo.NewActionsGateway(config.GatewayPort, config.Credentials, trusted.AcceptAllConnections, actions); err != nil {
+		return nil, err
+	}
+	pool, err := echo.NewBroadcastPool(config.Credentials, trusted.AcceptAllConnections, config.BroadcastPort)
+	if err != nil {
+		return nil, err
+	}
+	return &Node{State: commitState, Chain: blockchain, Pool: pool, actions: actions, config: config}, nil
+}
+
+// Run connects the engine of the node to the other validators, through a
+// gossip mesh if the node has a peer port and otherwise following the
+// broadcast service of each of them, and starts its event loop.
+func (n *Node) Run(engine *Engine, peers []Peer) error {
+	token := n.config.Credentials.PublicKey()
+	if n.config.PeerPort != 0 {
+		mesh := make([]gossip.Peer, 0, len(peers))
+		for _, peer := range peers {
+			mesh = append(mesh, gossip.Peer{Token: peer.Token, Address: peer.PeerAddress})
+		}
+		if err := engine.gossip(n.Pool, n.config.PeerPort, mesh); err != nil {
+			return err
+		}
+	} else {
+		for _, peer := range peers {
+			if !peer.Token.Equal(token) {
+				engine.follow(peer)
+			}
+		}
+	}
+	engine.Start(n.config.Genesis.Interval(), n.actions, n.Pool.BalanceRequests())
+	return nil
+}
+
+// follow keeps a listener connected to the broadcast service of the given
+// peer, reconnecting whenever the connection is lost.
+func (e *Engine) follow(peer Peer) {
+	go func() {
+		for {
+			listener, err := echo.NewListener(e.credentials, peer.Address, peer.Token)
+			if err == nil {
+				for msg := range listener.Incoming {
+					e.messages <- trusted.Message{Token: peer.Token, Data: msg}
+				}
+			}
+			time.Sleep(reconnectInterval)
+		}
+	}()
+}
+
+// gossip joins the peer-to-peer mesh of validators. Every message broadcast by
+// the node is sent to the mesh and messages of other validators are received
+// from it.
+func (e *Engine) gossip(pool *echo.BroadcastPool, port int, peers []gossip.Peer) error {
+	mesh, err := gossip.NewMesh(&gossip.MeshConfig{Credentials: e.credentials, Port: port, Peers: peers})
+	if err != nil {
+		return err
+	}
+	pool.SetGossip(mesh)
+	go func() {
+		for msg := range mesh.Messages {
+			e.messages <- msg
+		}
+	}()
+	return nil
+}
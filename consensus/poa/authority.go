@@ -0,0 +1,88 @@
+package poa
+
+import (
+	"errors"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+// Authority is a member of the proof-of-authority validator set. Address is
+// the host:port of its block broadcast service and PeerAddress the host:port
+// of its peer-to-peer service.
+type Authority struct {
+	Token       crypto.Token
+	Address     string
+	PeerAddress string
+}
+
+// AuthoritySet is the ordered set of authorities entitled to propose blocks.
+// Proposer duty rotates over the validator set in charge of the epoch one epoch
+// at a time, and to the next validator on each view change. Without a Rule
+// every authority validates from genesis on. With a Rule the authorities are
+// candidates and the validator set is recomputed out of their deposits at each
+// checkpoint.
+type AuthoritySet struct {
+	Authorities []Authority
+	Rule        *chain.SetRule
+	Rotation    *chain.Rotation
+}
+
+func NewAuthoritySet(authorities []Authority) (*AuthoritySet, error) {
+	if len(authorities) == 0 {
+		return nil, errors.New("authority set cannot be empty")
+	}
+	tokens := make(map[crypto.Token]struct{})
+	for _, authority := range authorities {
+		if _, ok := tokens[authority.Token]; ok {
+			return nil, errors.New("duplicate token in authority set")
+		}
+		tokens[authority.Token] = struct{}{}
+	}
+	set := &AuthoritySet{Authorities: authorities}
+	set.Rotation = chain.NewRotation(&chain.ValidatorSet{Members: set.tokens(), Stakes: make([]uint64, len(authorities))})
+	return set, nil
+}
+
+func (a *AuthoritySet) tokens() []crypto.Token {
+	tokens := make([]crypto.Token, len(a.Authorities))
+	for n, authority := range a.Authorities {
+		tokens[n] = authority.Token
+	}
+	return tokens
+}
+
+// Proposer returns the token of the authority responsible for proposing the
+// block of the given epoch at the given view.
+func (a *AuthoritySet) Proposer(epoch, view uint64) crypto.Token {
+	members := a.Rotation.Members(epoch)
+	return members[int((epoch+view)%uint64(len(members)))]
+}
+
+func (a *AuthoritySet) IsAuthority(token crypto.Token) bool {
+	for _, authority := range a.Authorities {
+		if authority.Token.Equal(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rotate computes the validator set at the given epoch out of the deposits of
+// the authorities. It returns nil if the set does not rotate or if no authority
+// qualifies, in which case the current set stays in charge.
+func (a *AuthoritySet) Rotate(epoch uint64, stake func(crypto.Token) uint64) *chain.ValidatorSet {
+	if a.Rule == nil {
+		return nil
+	}
+	set := chain.NewValidatorSet(epoch, a.tokens(), stake, *a.Rule)
+	if len(set.Members) == 0 {
+		return nil
+	}
+	return set
+}
+
+// Committee returns the validator sets as the committee voting on blocks.
+func (a *AuthoritySet) Committee() *chain.Rotation {
+	return a.Rotation
+}
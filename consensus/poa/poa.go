@@ -1,64 +1,29 @@
-// Package poa implements the proof-of-authority consensus engine.
+// Package poa implements the schedule of the proof-of-authority consensus
+// engine.
 package poa
 
 import (
-	"fmt"
-	"time"
+	"errors"
 
+	"github.com/lienkolabs/breeze/consensus"
 	"github.com/lienkolabs/breeze/crypto"
-	"github.com/lienkolabs/breeze/network/echo"
-	"github.com/lienkolabs/breeze/network/trusted"
-	"github.com/lienkolabs/breeze/protocol/chain"
-	"github.com/lienkolabs/breeze/protocol/state"
+	"github.com/lienkolabs/breeze/protocol/genesis"
 )
 
-var blockInterval = time.Second
+var errNotAnAuthority = errors.New("node token is not in the authority set")
 
-func NewProofOfAuthorityValidator(credentials crypto.PrivateKey, gatewayPort, broadcastPort int, walletPath string) error {
-	actions := make(chan []byte)
-	gateway, err := echo.NewActionsGateway(gatewayPort, credentials, trusted.AcceptAllConnections, actions)
-	if err != nil {
-		return err
+// NewProofOfAuthorityValidator launches a single node proof-of-authority
+// validator: a round-robin validator whose only authority is the node itself.
+// Genesis is the default genesis of the node token.
+func NewProofOfAuthorityValidator(credentials crypto.PrivateKey, gatewayPort, broadcastPort int, walletPath string) (*consensus.Engine, error) {
+	token := credentials.PublicKey()
+	config := RoundRobinConfig{
+		Credentials:   credentials,
+		GatewayPort:   gatewayPort,
+		BroadcastPort: broadcastPort,
+		WalletPath:    walletPath,
+		Genesis:       genesis.Default(token),
+		Authorities:   []Authority{{Token: token}},
 	}
-	pool, err := echo.NewBroadcastPool(credentials, trusted.AcceptAllConnections, broadcastPort)
-	if err != nil {
-		return err
-	}
-	blockstate := state.NewGenesisStateWithToken(credentials.PublicKey(), walletPath)
-	epoch := uint64(0)
-	ticker := time.NewTicker(blockInterval)
-	block := &chain.Block{
-		Epoch:          1,
-		CheckPoint:     0,
-		CheckpointHash: crypto.ZeroHash,
-		Proposer:       credentials.PublicKey(),
-		Actions:        make([][]byte, 0),
-	}
-	validator := blockstate.Validator(state.NewMutations(1), 1)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				block.Seal(credentials)
-				pool.BrodcastSealBlock(block.ProposedAt, block.Hash, block.SealSignature)
-				pool.BrodcastCommitBlock(epoch, block.Hash)
-				pool.Append(block)
-				blockstate.Incorporate(validator, block.Proposer)
-				hash := block.Hash
-				epoch += 1
-				validator = blockstate.Validator(state.NewMutations(epoch), epoch)
-				fmt.Println(block.Epoch, len(block.Actions))
-				block = block.NewBlock()
-				pool.BrodcastNextBlock(epoch, epoch-1, hash, block.Proposer)
-			case action := <-gateway.Actions:
-				fmt.Println(action)
-				if validator.Validate(action) {
-					fmt.Println("incorporated")
-					block.Actions = append(block.Actions, action)
-					pool.BroadcastAction(action)
-				}
-			}
-		}
-	}()
-	return nil
+	return NewRoundRobinValidator(&config)
 }
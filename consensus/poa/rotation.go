@@ -0,0 +1,89 @@
+package poa
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
+)
+
+// rotate recomputes the validator set out of the deposits commited at the
+// given epoch. It returns the new set or nil if the set in charge is kept. At
+// genesis the new set replaces the set of every authority.
+func (r *RoundRobin) rotate(epoch uint64) *chain.ValidatorSet {
+	set := r.authorities.Rotate(epoch, r.stake)
+	if set == nil {
+		return nil
+	}
+	rotation := r.authorities.Rotation
+	if epoch == 0 {
+		rotation.Sets = []*chain.ValidatorSet{set}
+	} else if !rotation.Append(set) {
+		return nil
+	}
+	if err := r.saveSets(); err != nil {
+		log.Printf("poa: %v", err)
+	}
+	return set
+}
+
+// stake returns the deposit of a token on the commited state.
+func (r *RoundRobin) stake(token crypto.Token) uint64 {
+	commitState, ok := r.chain.CommitState.(*state.State)
+	if !ok {
+		return 0
+	}
+	_, deposit := commitState.Deposits.Balance(token)
+	return deposit
+}
+
+// loadSets sets the validators in charge of a rotating authority set: out of
+// genesis deposits for a new chain, from the persisted sets for a resumed one,
+// so that a restarted node does not depend on past states to recover them, and
+// out of the deposits at the checkpoint for a chain imported from a snapshot.
+func (r *RoundRobin) loadSets() error {
+	if r.authorities.Rule == nil {
+		return nil
+	}
+	if r.chain.LastCommitEpoch == 0 {
+		r.rotate(0)
+		return nil
+	}
+	if r.setsPath == "" {
+		return errors.New("no validator set file to resume from")
+	}
+	data, err := os.ReadFile(r.setsPath)
+	if os.IsNotExist(err) && chain.IsCheckpoint(r.chain.LastCommitEpoch) {
+		// chain imported from a snapshot at a checkpoint: the set in charge
+		// follows from the deposits of the imported state
+		set := r.authorities.Rotate(r.chain.LastCommitEpoch, r.stake)
+		if set == nil {
+			return errors.New("no validator set out of imported deposits")
+		}
+		r.authorities.Rotation.Sets = []*chain.ValidatorSet{set}
+		return r.saveSets()
+	}
+	if err != nil {
+		return fmt.Errorf("could not read validator sets: %v", err)
+	}
+	rotation := chain.ParseRotation(data)
+	if rotation == nil {
+		return errors.New("corrupted validator set file")
+	}
+	r.authorities.Rotation.Sets = rotation.Sets
+	return nil
+}
+
+func (r *RoundRobin) saveSets() error {
+	if r.setsPath == "" {
+		return nil
+	}
+	if err := os.WriteFile(r.setsPath, r.authorities.Rotation.Serialize(), 0644); err != nil {
+		return fmt.Errorf("could not persist validator sets: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package poa
+
+import (
+	"fmt"
+
+	"github.com/lienkolabs/breeze/consensus"
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/genesis"
+)
+
+var _ consensus.Schedule = &RoundRobin{}
+
+type RoundRobinConfig struct {
+	Credentials   crypto.PrivateKey
+	GatewayPort   int
+	BroadcastPort int
+	WalletPath    string
+	Genesis       *genesis.Spec
+	Authorities   []Authority
+	PeerPort      int // if set authorities communicate through a gossip mesh
+}
+
+// RoundRobin is the schedule of proof-of-authority validators working along
+// other authorities of a configured set. The proposer of each epoch is given by
+// the authority set schedule and every validator of the set in charge votes on
+// blocks. With a rotation rule the validator set is recomputed out of the
+// deposits of authorities at every checkpoint and announced to listeners.
+type RoundRobin struct {
+	authorities *AuthoritySet
+	chain       *chain.Chain
+	setsPath    string // file where validator sets are persisted, if any
+}
+
+// NewRoundRobinValidator launches a round robin validator node.
+func NewRoundRobinValidator(config *RoundRobinConfig) (*consensus.Engine, error) {
+	authorities, err := NewAuthoritySet(config.Authorities)
+	if err != nil {
+		return nil, err
+	}
+	authorities.Rule = config.Genesis.SetRule()
+	if !authorities.IsAuthority(config.Credentials.PublicKey()) {
+		return nil, errNotAnAuthority
+	}
+	node, err := consensus.OpenNode(&consensus.NodeConfig{
+		Credentials:   config.Credentials,
+		GatewayPort:   config.GatewayPort,
+		BroadcastPort: config.BroadcastPort,
+		WalletPath:    config.WalletPath,
+		Genesis:       config.Genesis,
+		PeerPort:      config.PeerPort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	schedule := &RoundRobin{authorities: authorities, chain: node.Chain}
+	if config.WalletPath != "" {
+		schedule.setsPath = fmt.Sprintf("%vvalidators.dat", config.WalletPath)
+	}
+	if err := schedule.loadSets(); err != nil {
+		return nil, err
+	}
+	engine := consensus.NewEngine(config.Credentials, schedule, node.Chain, node.Pool)
+	peers := make([]consensus.Peer, 0, len(authorities.Authorities))
+	for _, authority := range authorities.Authorities {
+		peers = append(peers, consensus.Peer(authority))
+	}
+	if err := node.Run(engine, peers); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// NewRoundRobinEngine returns a round robin engine on the given chain relaying
+// its events to pool. If rule is set validators rotate by deposits at
+// checkpoints. Unlike NewRoundRobinValidator it opens no port and runs no
+// event loop. It is meant for simulation.
+func NewRoundRobinEngine(credentials crypto.PrivateKey, authorities []Authority, rule *chain.SetRule, blockchain *chain.Chain, pool consensus.Broadcaster) (*consensus.Engine, error) {
+	set, err := NewAuthoritySet(authorities)
+	if err != nil {
+		return nil, err
+	}
+	set.Rule = rule
+	if !set.IsAuthority(credentials.PublicKey()) {
+		return nil, errNotAnAuthority
+	}
+	schedule := &RoundRobin{authorities: set, chain: blockchain}
+	if err := schedule.loadSets(); err != nil {
+		return nil, err
+	}
+	return consensus.NewEngine(credentials, schedule, blockchain, pool), nil
+}
+
+// Proposer returns the authority scheduled for the given epoch and view.
+func (r *RoundRobin) Proposer(epoch, view uint64) crypto.Token {
+	return r.authorities.Proposer(epoch, view)
+}
+
+// Committee returns the validator sets of the authorities.
+func (r *RoundRobin) Committee() chain.Committee {
+	return r.authorities.Committee()
+}
+
+// Commited rotates the validator set on the commit of a checkpoint epoch. It
+// returns the new set, if any.
+func (r *RoundRobin) Commited(epoch uint64, hash crypto.Hash) *chain.ValidatorSet {
+	if !chain.IsCheckpoint(epoch) {
+		return nil
+	}
+	return r.rotate(epoch)
+}
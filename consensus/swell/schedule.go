@@ -0,0 +1,142 @@
+package swell
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Candidate is a node eligible to take part on the validator committee if it
+// holds a deposit. Address is the host:port of its block broadcast service and
+// PeerAddress the host:port of its peer-to-peer service.
+type Candidate struct {
+	Token       crypto.Token
+	Address     string
+	PeerAddress string
+}
+
+// Schedule is the committee of validators selected for a checkpoint window
+// together with their stakes. Committee members are drawn with probability
+// proportional to their deposits and the proposer of each epoch within the
+// window is drawn among committee members with the same rule.
+type Schedule struct {
+	Window    uint64
+	Seed      crypto.Hash
+	Committee []crypto.Token
+	Stakes    []uint64
+	total     uint64
+}
+
+// NewSchedule selects up to size committee members among candidates for the
+// given window. stake returns the deposited balance of a token at the state
+// used for the selection. If no candidate holds a deposit every candidate is
+// given equal weight.
+func NewSchedule(window uint64, seed crypto.Hash, candidates []Candidate, stake func(crypto.Token) uint64, size int) *Schedule {
+	tokens := make([]crypto.Token, len(candidates))
+	for n, candidate := range candidates {
+		tokens[n] = candidate.Token
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return bytes.Compare(tokens[i][:], tokens[j][:]) < 0
+	})
+	stakes := make([]uint64, len(tokens))
+	total := uint64(0)
+	for n, token := range tokens {
+		stakes[n] = stake(token)
+		total += stakes[n]
+	}
+	if total == 0 {
+		for n := range stakes {
+			stakes[n] = 1
+		}
+		total = uint64(len(stakes))
+	}
+	schedule := &Schedule{
+		Window:    window,
+		Seed:      seed,
+		Committee: make([]crypto.Token, 0),
+		Stakes:    make([]uint64, 0),
+	}
+	for slot := 0; slot < size && total > 0; slot++ {
+		n := pick(draw(seed, uint64(slot)), stakes, total)
+		schedule.Committee = append(schedule.Committee, tokens[n])
+		schedule.Stakes = append(schedule.Stakes, stakes[n])
+		schedule.total += stakes[n]
+		total -= stakes[n]
+		stakes[n] = 0
+	}
+	return schedule
+}
+
+// Proposer returns the committee member entitled to propose the block of the
+// given epoch at the given view. The member drawn for the epoch proposes at
+// view zero and each further view hands the epoch over to the next member of
+// the committee.
+func (s *Schedule) Proposer(epoch, view uint64) crypto.Token {
+	if len(s.Committee) == 0 {
+		return crypto.ZeroToken
+	}
+	n := uint64(pick(draw(s.Seed, epoch), s.Stakes, s.total))
+	return s.Committee[(n+view)%uint64(len(s.Committee))]
+}
+
+func (s *Schedule) IsMember(token crypto.Token) bool {
+	for _, member := range s.Committee {
+		if member.Equal(token) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schedule) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(s.Window, &bytes)
+	util.PutHash(s.Seed, &bytes)
+	util.PutTokenArray(s.Committee, &bytes)
+	for _, stake := range s.Stakes {
+		util.PutUint64(stake, &bytes)
+	}
+	return bytes
+}
+
+func ParseSchedule(data []byte, position int) (*Schedule, int) {
+	schedule := Schedule{}
+	schedule.Window, position = util.ParseUint64(data, position)
+	schedule.Seed, position = util.ParseHash(data, position)
+	schedule.Committee, position = util.ParseTokenArray(data, position)
+	schedule.Stakes = make([]uint64, len(schedule.Committee))
+	for n := range schedule.Stakes {
+		schedule.Stakes[n], position = util.ParseUint64(data, position)
+		schedule.total += schedule.Stakes[n]
+	}
+	if position > len(data) {
+		return nil, position
+	}
+	return &schedule, position
+}
+
+// draw derives a pseudo-random number from seed and a counter.
+func draw(seed crypto.Hash, counter uint64) uint64 {
+	data := seed[:]
+	util.PutUint64(counter, &data)
+	hash := crypto.Hasher(data)
+	return binary.LittleEndian.Uint64(hash[0:8])
+}
+
+// pick returns the index of the weight interval containing random modulo
+// total.
+func pick(random uint64, weights []uint64, total uint64) int {
+	target := random % total
+	cumulative := uint64(0)
+	for n, weight := range weights {
+		cumulative += weight
+		if target < cumulative {
+			return n
+		}
+	}
+	return len(weights) - 1
+}
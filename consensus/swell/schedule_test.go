@@ -0,0 +1,43 @@
+package swell
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestScheduleSelection(t *testing.T) {
+	candidates := make([]Candidate, 0)
+	stakes := make(map[crypto.Token]uint64)
+	for n := 0; n < 5; n++ {
+		token, _ := crypto.RandomAsymetricKey()
+		candidates = append(candidates, Candidate{Token: token})
+		stakes[token] = uint64(n) * 100
+	}
+	stake := func(token crypto.Token) uint64 { return stakes[token] }
+	seed := crypto.Hasher([]byte("seed"))
+	schedule := NewSchedule(1, seed, candidates, stake, 3)
+	if len(schedule.Committee) != 3 {
+		t.Fatalf("wrong committee size: %v", len(schedule.Committee))
+	}
+	if schedule.IsMember(candidates[0].Token) {
+		t.Errorf("candidate without deposit selected for committee")
+	}
+	another := NewSchedule(1, seed, candidates, stake, 3)
+	for epoch := uint64(0); epoch < 100; epoch++ {
+		proposer := schedule.Proposer(epoch, 0)
+		if !schedule.IsMember(proposer) {
+			t.Fatalf("proposer is not a committee member")
+		}
+		if !proposer.Equal(another.Proposer(epoch, 0)) {
+			t.Fatalf("schedule is not deterministic")
+		}
+		if proposer.Equal(schedule.Proposer(epoch, 1)) {
+			t.Fatalf("view change does not replace the proposer")
+		}
+	}
+	full := NewSchedule(1, seed, candidates, stake, 10)
+	if len(full.Committee) != 4 {
+		t.Errorf("committee should hold every candidate with deposits: %v", len(full.Committee))
+	}
+}
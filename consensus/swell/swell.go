@@ -0,0 +1,209 @@
+// Package swell implements the schedule of the swell proof-of-stake consensus
+// engine.
+//
+// Time is divided into checkpoint windows of CheckpointWindow epochs. For each
+// window a committee of validators is drawn among the configured candidates
+// with probability proportional to their balance on the deposits wallet, and
+// the proposer of each epoch is drawn among committee members with the same
+// rule. The committee of a window is computed from the state commited at the
+// first epoch of the preceding window, so that every node agrees on it well
+// before the window starts.
+package swell
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lienkolabs/breeze/consensus"
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/genesis"
+	"github.com/lienkolabs/breeze/protocol/state"
+)
+
+const (
+	CheckpointWindow = chain.CheckpointInterval
+	CommitteeSize    = 21
+)
+
+var _ consensus.Schedule = &StakeWeighted{}
+
+type Config struct {
+	Credentials   crypto.PrivateKey
+	GatewayPort   int
+	BroadcastPort int
+	WalletPath    string
+	Genesis       *genesis.Spec
+	Candidates    []Candidate
+	PeerPort      int // if set candidates communicate through a gossip mesh
+}
+
+// StakeWeighted is the schedule of swell proof-of-stake validators. Every
+// candidate follows the block formation messages of the others, but only
+// messages from the proposer scheduled for an epoch are taken into account.
+type StakeWeighted struct {
+	candidates []Candidate
+	state      *state.State
+	schedules  map[uint64]*Schedule
+	// file where schedules are persisted, if any
+	schedulePath string
+}
+
+// NewSwellValidator launches a swell validator node.
+func NewSwellValidator(config *Config) (*consensus.Engine, error) {
+	if len(config.Candidates) == 0 {
+		return nil, errors.New("no validator candidates provided")
+	}
+	node, err := consensus.OpenNode(&consensus.NodeConfig{
+		Credentials:   config.Credentials,
+		GatewayPort:   config.GatewayPort,
+		BroadcastPort: config.BroadcastPort,
+		WalletPath:    config.WalletPath,
+		Genesis:       config.Genesis,
+		PeerPort:      config.PeerPort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	schedule := &StakeWeighted{
+		candidates: config.Candidates,
+		state:      node.State,
+		schedules:  make(map[uint64]*Schedule),
+	}
+	if config.WalletPath != "" {
+		schedule.schedulePath = fmt.Sprintf("%vschedule.dat", config.WalletPath)
+	}
+	if err := schedule.open(node.Chain.LastCommitEpoch, config.Genesis.Hash()); err != nil {
+		return nil, err
+	}
+	engine := consensus.NewEngine(config.Credentials, schedule, node.Chain, node.Pool)
+	peers := make([]consensus.Peer, 0, len(config.Candidates))
+	for _, candidate := range config.Candidates {
+		peers = append(peers, consensus.Peer(candidate))
+	}
+	if err := node.Run(engine, peers); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// NewStakeWeightedEngine returns a swell engine for the given candidates on a
+// chain started from genesis, without opening any port. Events are relayed to
+// pool.
+func NewStakeWeightedEngine(credentials crypto.PrivateKey, candidates []Candidate, genesisHash crypto.Hash, blockchain *chain.Chain, pool consensus.Broadcaster) (*consensus.Engine, error) {
+	if len(candidates) == 0 {
+		return nil, errors.New("no validator candidates provided")
+	}
+	commitState, ok := blockchain.CommitState.(*state.State)
+	if !ok {
+		return nil, errors.New("swell schedules need a breeze state")
+	}
+	schedule := &StakeWeighted{
+		candidates: candidates,
+		state:      commitState,
+		schedules:  make(map[uint64]*Schedule),
+	}
+	if err := schedule.open(blockchain.LastCommitEpoch, genesisHash); err != nil {
+		return nil, err
+	}
+	return consensus.NewEngine(credentials, schedule, blockchain, pool), nil
+}
+
+// open computes the schedules of the first two windows out of genesis for a
+// new chain and loads the persisted schedules for a resumed one.
+func (s *StakeWeighted) open(lastCommit uint64, genesisHash crypto.Hash) error {
+	if lastCommit > 0 {
+		return s.loadSchedules()
+	}
+	s.schedules[0] = s.newSchedule(0, genesisHash)
+	s.schedules[1] = s.newSchedule(1, genesisHash)
+	return s.saveSchedules()
+}
+
+func (s *StakeWeighted) newSchedule(window uint64, seed crypto.Hash) *Schedule {
+	stake := func(token crypto.Token) uint64 {
+		_, balance := s.state.Deposits.Balance(token)
+		return balance
+	}
+	return NewSchedule(window, seed, s.candidates, stake, CommitteeSize)
+}
+
+// Proposer returns the token scheduled to propose the block of the given epoch
+// at the given view or crypto.ZeroToken if the schedule for its window is not
+// yet known.
+func (s *StakeWeighted) Proposer(epoch, view uint64) crypto.Token {
+	schedule, ok := s.schedules[chain.CheckpointWindow(epoch)]
+	if !ok {
+		return crypto.ZeroToken
+	}
+	return schedule.Proposer(epoch, view)
+}
+
+// Members returns the committee of the window of the given epoch.
+func (s *StakeWeighted) Members(epoch uint64) []crypto.Token {
+	schedule, ok := s.schedules[chain.CheckpointWindow(epoch)]
+	if !ok {
+		return nil
+	}
+	return schedule.Committee
+}
+
+// Committee returns the schedule itself: committees are those of the windows.
+func (s *StakeWeighted) Committee() chain.Committee {
+	return s
+}
+
+// Commited updates schedules after the commit of a block. On the first epoch
+// of a window the schedule of the next window is computed and the schedule of
+// the previous one discarded.
+func (s *StakeWeighted) Commited(epoch uint64, hash crypto.Hash) *chain.ValidatorSet {
+	if epoch%CheckpointWindow != 0 {
+		return nil
+	}
+	window := chain.CheckpointWindow(epoch)
+	s.schedules[window+1] = s.newSchedule(window+1, hash)
+	if window > 0 {
+		delete(s.schedules, window-1)
+	}
+	if err := s.saveSchedules(); err != nil {
+		log.Printf("swell: %v", err)
+	}
+	return nil
+}
+
+// saveSchedules persists the known schedules so that a restarted node does not
+// depend on past states to recover them.
+func (s *StakeWeighted) saveSchedules() error {
+	if s.schedulePath == "" {
+		return nil
+	}
+	bytes := make([]byte, 0)
+	for _, schedule := range s.schedules {
+		bytes = append(bytes, schedule.Serialize()...)
+	}
+	if err := os.WriteFile(s.schedulePath, bytes, 0644); err != nil {
+		return fmt.Errorf("could not persist schedules: %v", err)
+	}
+	return nil
+}
+
+func (s *StakeWeighted) loadSchedules() error {
+	if s.schedulePath == "" {
+		return errors.New("no schedule file to resume from")
+	}
+	data, err := os.ReadFile(s.schedulePath)
+	if err != nil {
+		return fmt.Errorf("could not read schedules: %v", err)
+	}
+	position := 0
+	for position < len(data) {
+		var schedule *Schedule
+		if schedule, position = ParseSchedule(data, position); schedule == nil {
+			return errors.New("corrupted schedule file")
+		}
+		s.schedules[schedule.Window] = schedule
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package consensus
+
+import (
+	"log"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+// requestView signs and broadcasts the request to hand the epoch subsequent to
+// the last commit over to the proposer of the given view. A node that voted on
+// a block of the epoch does not request it, and a node that requested it no
+// longer votes on blocks of the epoch, so that a view change and the commit of
+// a block of the same epoch cannot both gather a quorum. A proposer lost after
+// sealing thus stalls the chain until recovery.
+func (e *Engine) requestView(view uint64) {
+	epoch := e.chain.LastCommitEpoch + 1
+	if len(e.chain.Candidates[epoch]) > 0 {
+		return
+	}
+	e.requested = view
+	change := chain.NewViewChange(epoch, view, e.credentials)
+	e.pool.BroadcastViewChange(change)
+	e.viewChange(change)
+}
+
+// viewChange tallies a request to replace the proposer of the epoch subsequent
+// to the last commit. A node that already requested a view joins requests for
+// higher views, so that requests of nodes timing out at different moments
+// converge. The view changes once a quorum of the committee requested it.
+func (e *Engine) viewChange(change *chain.ViewChange) {
+	epoch := e.chain.LastCommitEpoch + 1
+	if change.Epoch != epoch || change.View <= e.chain.View {
+		return
+	}
+	certificate, ok := e.views[change.View]
+	if !ok {
+		certificate = chain.NewViewCertificate(epoch, change.View)
+		e.views[change.View] = certificate
+	}
+	if !certificate.Append(change) {
+		return
+	}
+	if e.requested > e.chain.View && change.View > e.requested {
+		e.requestView(change.View)
+		return
+	}
+	if certificate.Verify(e.chain.Committee) {
+		e.newView(certificate)
+	}
+}
+
+// newView moves the chain to a certified view and relays the certificate. The
+// block under formation is discarded and its actions kept pending, and the
+// proposer of the view proposes the epoch.
+func (e *Engine) newView(certificate *chain.ViewCertificate) {
+	var discarded [][]byte
+	if e.chain.LiveBlock != nil {
+		discarded = e.chain.LiveBlock.Actions
+	}
+	stalled := e.schedule.Proposer(certificate.Epoch, e.chain.View)
+	if err := e.chain.ChangeView(certificate, stalled); err != nil {
+		log.Printf("consensus: could not change view of block %v: %v", certificate.Epoch, err)
+		return
+	}
+	e.pending = append(e.pending, discarded...)
+	e.certificate = nil
+	e.forming = make(map[crypto.Token]*chain.Block)
+	e.resetView()
+	e.pool.BroadcastNewView(certificate)
+	e.proposeNext(e.chain.LastCommitEpoch)
+}
+
+// voting returns true if the node may vote on blocks of the epoch subsequent
+// to the last commit: it has not requested a view change for it.
+func (e *Engine) voting() bool {
+	return e.requested <= e.chain.View
+}
+
+// resetView discards view change requests once the chain makes progress.
+func (e *Engine) resetView() {
+	e.views = make(map[uint64]*chain.ViewCertificate)
+	e.requested = 0
+	e.stalled = 0
+}
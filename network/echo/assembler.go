@@ -0,0 +1,130 @@
+package echo
+
+import (
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+// Assembler rebuilds commited blocks out of the block formation messages of a
+// block provider. Seals are verified against the proposer of the block. If the
+// listener receives every action, the actions of sealed blocks are checked
+// against the sealed actions root. Competing blocks sealed for the same epoch
+// are kept as candidates until the commit of one of them. A competing block
+// is relayed by providers at once while another block may be under formation:
+// blocks under formation are stacked and messages apply to the last one. If a
+// committee is provided only commits with a valid quorum certificate are taken
+// into account. A rotating committee is kept up to date with the validator
+// sets announced by the provider that carry the endorsements of a quorum of
+// the outgoing set. View changes are only taken into account if certified by
+// a quorum of the committee.
+type Assembler struct {
+	forming   []*chain.Block
+	sealed    map[uint64]map[crypto.Hash]*chain.Block
+	committee chain.Committee
+	all       bool
+}
+
+func NewAssembler(committee chain.Committee, all bool) *Assembler {
+	return &Assembler{
+		sealed:    make(map[uint64]map[crypto.Hash]*chain.Block),
+		committee: committee,
+		all:       all,
+	}
+}
+
+// Message processes a block formation message and returns the block it
+// commits, if any.
+func (a *Assembler) Message(msg []byte) *chain.Block {
+	switch msg[0] {
+	case actionMsg:
+		if len(a.forming) > 0 {
+			block := a.forming[len(a.forming)-1]
+			block.Actions = append(block.Actions, msg[1:])
+		}
+	case nextBlockMsg:
+		if nextBlock := ParseBlockHeader(msg); nextBlock != nil {
+			a.discard(func(block *chain.Block) bool { return block.Epoch < nextBlock.Epoch })
+			a.forming = append(a.forming, &chain.Block{
+				Epoch:          nextBlock.Epoch,
+				CheckPoint:     nextBlock.Checkpoint,
+				CheckpointHash: nextBlock.CheckpointHash,
+				Proposer:       nextBlock.Publisher,
+				Actions:        make([][]byte, 0),
+			})
+		}
+	case sealBLockMsg:
+		if seal := ParseBlockTail(msg); seal != nil && len(a.forming) > 0 {
+			block := a.forming[len(a.forming)-1]
+			a.forming = a.forming[:len(a.forming)-1]
+			block.ProposedAt = seal.Timestamp
+			block.ActionsRoot = seal.ActionsRoot
+			block.Hash = seal.Hash
+			block.SealSignature = seal.Signature
+			if !block.VerifySeal() || (a.all && !chain.ActionsRoot(block.Actions).Equal(block.ActionsRoot)) {
+				return nil
+			}
+			if _, ok := a.sealed[block.Epoch]; !ok {
+				a.sealed[block.Epoch] = make(map[crypto.Hash]*chain.Block)
+			}
+			a.sealed[block.Epoch][block.Hash] = block
+		}
+	case commitBlockMsg:
+		if commit := ParseCommitBlock(msg); commit != nil {
+			if a.committee != nil && !commit.Finalized(a.committee) {
+				return nil
+			}
+			if sealed, ok := a.sealed[commit.Epoch][commit.Hash]; ok {
+				sealed.PreviousHash = commit.ParentHash
+				sealed.Invalidate = commit.Invalidate
+				sealed.Certificate = commit.Certificate
+				sealed.StateRoot = commit.StateRoot
+				delete(a.sealed, commit.Epoch)
+				return sealed
+			}
+		}
+	case validatorSetMsg:
+		if rotation, ok := a.committee.(*chain.Rotation); ok {
+			if certificate := ParseValidatorSetMessage(msg); certificate.Verify(rotation) {
+				rotation.Append(certificate.Set)
+			}
+		}
+	case newViewMsg:
+		if view := ParseNewViewMessage(msg); view != nil && (a.committee == nil || view.Verify(a.committee)) {
+			a.discard(func(block *chain.Block) bool { return block.Epoch >= view.Epoch })
+			for epoch := range a.sealed {
+				if epoch >= view.Epoch {
+					delete(a.sealed, epoch)
+				}
+			}
+		}
+	case rolloverBlockMsg:
+		if rollover := ParseRolloverBlock(msg); rollover != nil && rollover.Verify() {
+			if a.committee != nil && !isMember(rollover.Token, a.committee.Members(rollover.Epoch)) {
+				return nil
+			}
+			for epoch := range a.sealed {
+				if epoch > rollover.Epoch {
+					delete(a.sealed, epoch)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Reset discards every block not yet commited.
+func (a *Assembler) Reset() {
+	a.forming = nil
+	a.sealed = make(map[uint64]map[crypto.Hash]*chain.Block)
+}
+
+// discard drops the blocks under formation matching the given condition.
+func (a *Assembler) discard(matches func(*chain.Block) bool) {
+	kept := a.forming[:0]
+	for _, block := range a.forming {
+		if !matches(block) {
+			kept = append(kept, block)
+		}
+	}
+	a.forming = kept
+}
@@ -7,19 +7,39 @@ import (
 )
 
 // Block listener connects to a server providing blocks and channels every
-// commited block.
+// commited block. Competing blocks sealed for an epoch are kept until the
+// commit of one of them, which is the block channeled. If a committee is
+// provided only blocks with a valid quorum certificate are channeled. On
+// disaster recovery the checkpoint epoch the chain was restored to is channeled
+// on Recovery: blocks after it must be discarded. Recoveries are only followed
+// if a quorum of the committee decided them, if their checkpoint is not below
+// the last certified checkpoint announced by the provider and if the listener
+// did not recover to it before, so a listener without a committee never
+// discards blocks and replayed decisions are refused. Answers to balance
+// requests are channeled on Balance if their proof is valid against the state
+// root certified by the committee for their epoch. Proofs of epochs ahead of
+// the listener wait for their block; a listener without a committee channels
+// none.
 type BlockListener struct {
 	Connection *trusted.SignedConnection
 	Block      chan *chain.Block
+	Recovery   chan uint64
+	Balance    chan *BalanceProof
 	shutdown   chan struct{}
-	newBlock   *chain.Block
-	sealed     map[uint64]*chain.Block
+	assembler  *Assembler
+	committee  chain.Committee
+	certified  uint64                     // epoch of the last certified checkpoint
+	recovered  uint64                     // epoch of the last checkpoint recovered to
+	roots      map[uint64]crypto.Hash     // state roots of recent certified blocks
+	unproven   map[uint64][]*BalanceProof // proofs waiting for the block of their epoch
+	last       uint64                     // epoch of the last certified block
 }
 
 type BlockListenerConfig struct {
 	Credentials         crypto.PrivateKey
 	BlockServiceAddress string
 	BlockServiveToken   crypto.Token
+	Committee           chain.Committee // optional: verify finality of blocks
 }
 
 func NewBlockListener(config *BlockListenerConfig) (*BlockListener, error) {
@@ -28,8 +48,13 @@ func NewBlockListener(config *BlockListenerConfig) (*BlockListener, error) {
 	listener := &BlockListener{
 		Connection: conn,
 		Block:      make(chan *chain.Block),
+		Recovery:   make(chan uint64),
+		Balance:    make(chan *BalanceProof),
 		shutdown:   make(chan struct{}),
-		sealed:     make(map[uint64]*chain.Block),
+		assembler:  NewAssembler(config.Committee, true),
+		committee:  config.Committee,
+		roots:      make(map[uint64]crypto.Hash),
+		unproven:   make(map[uint64][]*BalanceProof),
 	}
 	if err != nil {
 		return nil, err
@@ -74,6 +99,19 @@ func NewBlockListener(config *BlockListenerConfig) (*BlockListener, error) {
 	return listener, nil
 }
 
+// RequestValidatorSet asks the provider for its current validator set. The
+// answer updates the committee of the listener if it is a chain.Rotation.
+func (l *BlockListener) RequestValidatorSet() error {
+	return l.Connection.Send(NewValidatorSetRequest())
+}
+
+// RequestBalance asks the provider for the proof of the balances of a token.
+// The root of the answer must be checked against the state root of the block
+// of its epoch.
+func (l *BlockListener) RequestBalance(token crypto.Token) error {
+	return l.Connection.Send(NewBalanceRequest(token))
+}
+
 func (l *BlockListener) Shutdown() {
 	l.shutdown <- struct{}{}
 }
@@ -83,50 +121,86 @@ func (l *BlockListener) NewMessage(msg []byte) {
 	case blockcacheMsg:
 		if len(msg) > 1 {
 			block := chain.ParseBlock(msg[1:])
-			if block != nil {
-				l.Block <- block
+			if block != nil && l.finalized(block) {
+				l.channel(block)
 			}
 		}
-	case actionMsg:
-		if l.newBlock != nil {
-			l.newBlock.Actions = append(l.newBlock.Actions, msg[1:])
-		}
-	case nextBlockMsg:
-		if nextBlock := ParseBlockHeader(msg); nextBlock != nil {
-			l.newBlock = &chain.Block{
-				Epoch:          nextBlock.Epoch,
-				CheckPoint:     nextBlock.Checkpoint,
-				CheckpointHash: nextBlock.CheckpointHash,
-				Proposer:       nextBlock.Publisher,
-				Actions:        make([][]byte, 0),
+	case checkpointCertificateMsg:
+		if certificate := ParseCheckpointCertificateMessage(msg); certificate != nil {
+			if certificate.Epoch > l.certified && certificate.Verify(l.committee) {
+				l.certified = certificate.Epoch
 			}
 		}
-	case sealBLockMsg:
-		if seal := ParseBlockTail(msg); seal != nil {
-			if l.newBlock != nil {
-				l.newBlock.ProposedAt = seal.Timestamp
-				l.newBlock.Hash = seal.Hash
-				l.newBlock.SealSignature = seal.Signature
-				l.sealed[l.newBlock.Epoch] = l.newBlock
-				l.newBlock = nil
+	case recoveryMsg:
+		if decision := ParseRecoveryMessage(msg); decision != nil {
+			if decision.Epoch < l.certified || decision.Epoch <= l.recovered || !decision.Verify(l.committee) {
+				return
 			}
+			l.certified = decision.Epoch
+			l.recovered = decision.Epoch
+			l.assembler.Reset()
+			l.Recovery <- decision.Epoch
 		}
-	case commitBlockMsg:
-		if commit := ParseCommitBlock(msg); commit != nil {
-			if sealed, ok := l.sealed[commit.Epoch]; ok && sealed.Hash.Equal(commit.Hash) {
-				sealed.PreviousHash = commit.ParentHash
-				sealed.Invalidate = commit.Invalidate
-				l.Block <- sealed
-				delete(l.sealed, commit.Epoch)
-			}
+	case balanceProofMsg:
+		if proof := ParseBalanceProof(msg); proof != nil && proof.Verify() != nil {
+			l.prove(proof)
 		}
-	case rolloverBlockMsg:
-		if rollover := ParseRolloverBlock(msg); rollover != nil {
-			for epoch := range l.sealed {
-				if epoch > rollover.Epoch {
-					delete(l.sealed, epoch)
-				}
-			}
+	default:
+		if block := l.assembler.Message(msg); block != nil {
+			l.channel(block)
+		}
+	}
+}
+
+// channel hands a finalized block over and keeps its state root, certified
+// if the listener has a committee, to check balance proofs against.
+func (l *BlockListener) channel(block *chain.Block) {
+	l.Block <- block
+	if l.committee == nil {
+		return
+	}
+	l.roots[block.Epoch] = block.StateRoot
+	delete(l.roots, block.Epoch-chain.KeepLastN)
+	if block.Epoch > l.last {
+		l.last = block.Epoch
+	}
+	for epoch, proofs := range l.unproven {
+		if epoch > l.last {
+			continue
+		}
+		delete(l.unproven, epoch)
+		for _, proof := range proofs {
+			l.prove(proof)
+		}
+	}
+}
+
+// prove channels a balance proof against the certified root of its epoch.
+// Proofs of epochs not yet certified are kept until their block arrives.
+func (l *BlockListener) prove(proof *BalanceProof) {
+	if l.committee == nil {
+		return
+	}
+	if root, ok := l.roots[proof.Epoch]; ok {
+		if root.Equal(proof.Root) {
+			l.Balance <- proof
 		}
+		return
 	}
+	if proof.Epoch > l.last && proof.Epoch <= l.last+chain.KeepLastN {
+		l.unproven[proof.Epoch] = append(l.unproven[proof.Epoch], proof)
+	}
+}
+
+func isMember(token crypto.Token, members []crypto.Token) bool {
+	for _, member := range members {
+		if member.Equal(token) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *BlockListener) finalized(block *chain.Block) bool {
+	return l.committee == nil || block.Certificate.Certifies(block.Epoch, block.Hash, block.CommitHash(), l.committee)
 }
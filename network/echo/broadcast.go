@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/lienkolabs/breeze/network"
 	"github.com/lienkolabs/breeze/network/trusted"
 	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
 )
 
 const MaxCacheSize = 60 * 15
@@ -44,6 +46,23 @@ func (c *cache) Append(block *chain.Block) {
 	c.lastEpoch = block.Epoch
 }
 
+// Truncate removes from cache every block after the given epoch.
+func (c *cache) Truncate(epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for blockEpoch := range c.blocks {
+		if blockEpoch > epoch {
+			delete(c.blocks, blockEpoch)
+		}
+	}
+	if c.lastEpoch > epoch {
+		c.lastEpoch = epoch
+	}
+	if c.firstEpoch > epoch {
+		c.firstEpoch = epoch
+	}
+}
+
 // Get copy of cache pointers starting from start epoch. It pressuposes that
 // cache will be called with the pool lock. It cannot be used in other contexts.
 func (c *cache) GetCopy(epochs ...uint64) []*chain.Block {
@@ -195,7 +214,7 @@ func (l *listenerConnection) Subscribe(subscribe *SubscribeProtocol, pool *Broad
 				if l.all {
 					bytes = NewBlockCache(block)
 				} else {
-					bytes = NewFilteredBlockCache(block, l.code)
+					bytes = NewFilteredBlockCache(block, l.code, pool.credentials)
 				}
 				l.conn.Send(bytes)
 			}
@@ -263,6 +282,28 @@ type BroadcastPool struct {
 	broadcastAction chan []byte
 	nextBlock       chan uint64
 	block           chan *chain.Block
+	truncate        chan uint64
+	validators      chan *chain.SetCertificate
+	validatorSet    *chain.SetCertificate // last announced, served on request
+	liveness        chan *chain.LivenessReport
+	reports         map[uint64]*chain.LivenessReport // by window, served on request
+	balance         chan *BalanceJob
+	snapshots       chan [][]byte
+	snapshot        [][]byte // chunks of the snapshot at the last checkpoint
+	gossip          Gossip
+	credentials     crypto.PrivateKey
+}
+
+// Gossip is a peer-to-peer network among validators. Messages broadcast on a
+// pool with a gossip network are also sent to peers.
+type Gossip interface {
+	Broadcast(data []byte)
+}
+
+// SetGossip instructs the pool to forward every broadcast message to the
+// gossip network. It must be called before any broadcast.
+func (pool *BroadcastPool) SetGossip(gossip Gossip) {
+	pool.gossip = gossip
 }
 
 // NewBroadcastPool instances a new pool listening to connections on the
@@ -279,6 +320,13 @@ func NewBroadcastPool(credentials crypto.PrivateKey, validator network.ValidateC
 		broadcastAction: make(chan []byte),
 		nextBlock:       make(chan uint64),
 		block:           make(chan *chain.Block),
+		truncate:        make(chan uint64),
+		validators:      make(chan *chain.SetCertificate),
+		liveness:        make(chan *chain.LivenessReport),
+		reports:         make(map[uint64]*chain.LivenessReport),
+		balance:         make(chan *BalanceJob),
+		snapshots:       make(chan [][]byte),
+		credentials:     credentials,
 	}
 
 	listeners, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
@@ -315,10 +363,16 @@ func NewBroadcastPool(credentials crypto.PrivateKey, validator network.ValidateC
 				for _, listener := range pool.conn {
 					listener.Send(msg)
 				}
+				if pool.gossip != nil {
+					pool.gossip.Broadcast(msg)
+				}
 			case msg := <-pool.broadcastAction:
 				for _, listener := range pool.conn {
 					listener.SendAction(msg)
 				}
+				if pool.gossip != nil {
+					pool.gossip.Broadcast(msg)
+				}
 			case epoch := <-pool.nextBlock:
 				for _, listener := range pool.conn {
 					if listener.firstnewblock == 0 {
@@ -327,6 +381,19 @@ func NewBroadcastPool(credentials crypto.PrivateKey, validator network.ValidateC
 				}
 			case block := <-pool.block:
 				pool.cache.Append(block)
+			case epoch := <-pool.truncate:
+				pool.cache.Truncate(epoch)
+			case certificate := <-pool.validators:
+				pool.validatorSet = certificate
+			case report := <-pool.liveness:
+				pool.reports[report.Window] = report
+				for window := range pool.reports {
+					if window+1 < report.Window {
+						delete(pool.reports, window)
+					}
+				}
+			case chunks := <-pool.snapshots:
+				pool.snapshot = chunks
 			case listener := <-incoming:
 				pool.conn[listener.conn.Token] = listener
 				listener.conn.Listen(messages, shutdown)
@@ -342,6 +409,35 @@ func NewBroadcastPool(credentials crypto.PrivateKey, validator network.ValidateC
 					if listener, ok := pool.conn[msg.Token]; ok {
 						listener.Subscribe(subscribe, pool)
 					}
+				} else if IsValidatorSetRequest(msg.Data) && pool.validatorSet != nil {
+					if listener, ok := pool.conn[msg.Token]; ok {
+						listener.conn.Send(NewValidatorSetMessage(pool.validatorSet))
+					}
+				} else if account, ok := ParseBalanceRequest(msg.Data); ok {
+					if listener, ok := pool.conn[msg.Token]; ok {
+						select {
+						case pool.balance <- &BalanceJob{Connection: listener.conn, Account: account}:
+						default:
+						}
+					}
+				} else if IsSnapshotRequest(msg.Data) && pool.snapshot != nil {
+					if listener, ok := pool.conn[msg.Token]; ok {
+						// snapshots are large: stream them without holding
+						// the pool
+						go func(conn *trusted.SignedConnection, chunks [][]byte) {
+							for _, chunk := range chunks {
+								if conn.Send(chunk) != nil {
+									return
+								}
+							}
+						}(listener.conn, pool.snapshot)
+					}
+				} else if IsLivenessRequest(msg.Data) {
+					if listener, ok := pool.conn[msg.Token]; ok {
+						for _, report := range pool.livenessReports() {
+							listener.conn.Send(NewLivenessMessage(report))
+						}
+					}
 				}
 			}
 		}
@@ -359,26 +455,23 @@ func (pool *BroadcastPool) Shutdown() {
 // Broadcast action to all connected parties subscribing to protocol codes
 // compatible with the action.
 func (pool *BroadcastPool) BroadcastAction(data []byte) {
-	msg := []byte{actionMsg}
-	msg = append(msg, data...)
-	pool.broadcastAction <- msg
+	pool.broadcastAction <- NewActionMessage(data)
 }
 
-// Broadcast message to rollover blockchain to specified epoch.
+// Broadcast message to rollover blockchain to specified epoch, signed with the
+// credentials of the pool.
 func (pool *BroadcastPool) BroadcastRollover(epoch uint64) {
-	rollover := RolloverBlock{
-		Epoch: epoch,
-	}
-	msg := rollover.Serialize()
-	pool.Broadcast(msg)
+	rollover := NewRolloverBlock(epoch, pool.credentials)
+	pool.Broadcast(rollover.Serialize())
 }
 
 // Broadcast message with details about block sealing event.
-func (pool *BroadcastPool) BrodcastSealBlock(timestamp time.Time, hash crypto.Hash, signature crypto.Signature) {
+func (pool *BroadcastPool) BrodcastSealBlock(timestamp time.Time, actionsRoot, hash crypto.Hash, signature crypto.Signature) {
 	seal := BlockTail{
-		Timestamp: timestamp,
-		Hash:      hash,
-		Signature: signature,
+		Timestamp:   timestamp,
+		ActionsRoot: actionsRoot,
+		Hash:        hash,
+		Signature:   signature,
 	}
 	msg := seal.Serialize()
 	pool.Broadcast(msg)
@@ -400,16 +493,120 @@ func (pool *BroadcastPool) BrodcastNextBlock(epoch, checkpoint uint64, checkpoin
 
 // Broadcast message to consider the sealed block for given eposh and given
 // hash commited. Commited blocks can only be rolled over on disaster recovery
-// through swell checkpoint mechanism.
-func (pool *BroadcastPool) BrodcastCommitBlock(epoch uint64, hash crypto.Hash) {
+// through swell checkpoint mechanism. The state root of the node after the
+// commit is announced with it.
+func (pool *BroadcastPool) BrodcastCommitBlock(epoch uint64, hash, parent crypto.Hash, invalidated []crypto.Hash, certificate *chain.QuorumCertificate, root crypto.Hash) {
 	commit := CommitBlock{
-		Epoch: epoch,
-		Hash:  hash,
+		Epoch:       epoch,
+		Hash:        hash,
+		ParentHash:  parent,
+		Invalidate:  invalidated,
+		Certificate: certificate,
+		StateRoot:   root,
 	}
 	msg := commit.Serialize()
 	pool.Broadcast(msg)
 }
 
+// Broadcast the vote of the node on a sealed block.
+func (pool *BroadcastPool) BroadcastVote(vote *chain.Vote) {
+	pool.Broadcast(NewVoteMessage(vote))
+}
+
+// Broadcast the signed checkpoint of the node.
+func (pool *BroadcastPool) BroadcastCheckpoint(checkpoint *chain.Checkpoint) {
+	pool.Broadcast(NewCheckpointMessage(checkpoint))
+}
+
+// Broadcast the certificate of a checkpoint certified by a quorum.
+func (pool *BroadcastPool) BroadcastCheckpointCertificate(certificate *chain.CheckpointCertificate) {
+	pool.Broadcast(NewCheckpointCertificateMessage(certificate))
+}
+
+// Broadcast the request of the node to restore the chain to its last
+// certified checkpoint.
+func (pool *BroadcastPool) BroadcastRecoveryRequest(request *chain.RecoveryRequest) {
+	pool.Broadcast(NewRecoveryRequestMessage(request))
+}
+
+// Broadcast message that the chain was restored to the checkpoint decided by
+// a quorum on disaster recovery. Cached blocks after the checkpoint are
+// discarded.
+func (pool *BroadcastPool) BroadcastRecovery(certificate *chain.RecoveryCertificate) {
+	pool.truncate <- certificate.Epoch
+	pool.Broadcast(NewRecoveryMessage(certificate))
+}
+
+// Broadcast the request of the node to replace the proposer of a stalled
+// epoch.
+func (pool *BroadcastPool) BroadcastViewChange(change *chain.ViewChange) {
+	pool.Broadcast(NewViewChangeMessage(change))
+}
+
+// Broadcast the certificate replacing the proposer of a stalled epoch.
+func (pool *BroadcastPool) BroadcastNewView(certificate *chain.ViewCertificate) {
+	pool.Broadcast(NewViewMessage(certificate))
+}
+
+// UpdateSnapshot replaces the snapshot streamed to syncing nodes by the
+// snapshot of the state at a newly certified checkpoint.
+func (pool *BroadcastPool) UpdateSnapshot(certified *state.CertifiedSnapshot) {
+	pool.snapshots <- NewSnapshotChunks(certified)
+}
+
+// BalanceJob is a request for the proof of the balances of an account to be
+// answered on the connection with a BalanceProof.
+type BalanceJob struct {
+	Connection *trusted.SignedConnection
+	Account    crypto.Hash
+}
+
+// BalanceRequests returns the channel on which balance requests of listeners
+// are forwarded. Requests are dropped while the engine is busy.
+func (pool *BroadcastPool) BalanceRequests() chan *BalanceJob {
+	return pool.balance
+}
+
+// UpdateLiveness instructs the pool to keep the liveness report of a window to
+// answer liveness requests. Reports of the current and the previous window are
+// kept.
+func (pool *BroadcastPool) UpdateLiveness(report *chain.LivenessReport) {
+	pool.liveness <- report
+}
+
+// Broadcast the liveness report of a window closed by a checkpoint. The report
+// is kept as by UpdateLiveness.
+func (pool *BroadcastPool) BroadcastLiveness(report *chain.LivenessReport) {
+	pool.UpdateLiveness(report)
+	pool.Broadcast(NewLivenessMessage(report))
+}
+
+// livenessReports returns the kept liveness reports in window order.
+func (pool *BroadcastPool) livenessReports() []*chain.LivenessReport {
+	reports := make([]*chain.LivenessReport, 0, len(pool.reports))
+	for _, report := range pool.reports {
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Window < reports[j].Window
+	})
+	return reports
+}
+
+// Broadcast the validator set computed at a checkpoint once certified by the
+// outgoing set. The pool keeps the last set announced to answer validator set
+// requests of gateways.
+func (pool *BroadcastPool) BroadcastValidatorSet(certificate *chain.SetCertificate) {
+	pool.validators <- certificate
+	pool.Broadcast(NewValidatorSetMessage(certificate))
+}
+
+// Broadcast the endorsement of the node on the validator set computed at a
+// checkpoint.
+func (pool *BroadcastPool) BroadcastSetEndorsement(endorsement *chain.SetEndorsement) {
+	pool.Broadcast(NewSetEndorsementMessage(endorsement))
+}
+
 // Broadcast messages to all connected parties. To broadcast action use
 // BroadcastAction method that implements protocol code filtering.
 func (pool *BroadcastPool) Broadcast(data []byte) {
@@ -147,3 +147,19 @@ func (db *DBClient) Subscribe(epoch uint64, keepalive bool, tokens ...crypto.Tok
 	}
 	return db.Conn.Send(msg.Serialize())
 }
+
+// RequestProof asks the provider for the receipt of inclusion of an action on
+// the commited block of the given epoch. The receipt is received as any other
+// message and must be parsed with ParseActionProof.
+func (db *DBClient) RequestProof(epoch uint64, action crypto.Hash) error {
+	request := ProofRequest{Epoch: epoch, Action: action}
+	return db.Conn.Send(request.Serialize())
+}
+
+// RequestBalance asks the provider for the balance of a token after the commit
+// of the block of the given epoch. The answer is received as any other message
+// and must be parsed with ParseHistoricalBalance.
+func (db *DBClient) RequestBalance(epoch uint64, token crypto.Token) error {
+	request := HistoryRequest{Epoch: epoch, Token: token}
+	return db.Conn.Send(request.Serialize())
+}
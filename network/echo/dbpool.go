@@ -25,6 +25,22 @@ type DBPoolConfig struct {
 	Validator   network.ValidateConnection
 	ServePort   int
 	Job         chan *NewIndexJob
+	Proof       chan *ProofJob   // if set proof requests are forwarded here
+	History     chan *HistoryJob // if set history requests are forwarded here
+}
+
+// ProofJob is a request for the receipt of inclusion of an action to be
+// answered on the connection with an ActionProof.
+type ProofJob struct {
+	Connection *trusted.SignedConnection
+	Request    *ProofRequest
+}
+
+// HistoryJob is a request for the balance of a token at an epoch to be
+// answered on the connection with a HistoricalBalance.
+type HistoryJob struct {
+	Connection *trusted.SignedConnection
+	Request    *HistoryRequest
 }
 
 type NewIndexJob struct {
@@ -93,6 +109,14 @@ func NewDBPool(config *DBPoolConfig) (*DBPool, error) {
 						config.Job <- &job
 					}
 
+				} else if request := ParseProofRequest(msg.Data); request != nil && config.Proof != nil {
+					if conn, ok := pool.conn[msg.Token]; ok {
+						config.Proof <- &ProofJob{Connection: conn, Request: request}
+					}
+				} else if request := ParseHistoryRequest(msg.Data); request != nil && config.History != nil {
+					if conn, ok := pool.conn[msg.Token]; ok {
+						config.History <- &HistoryJob{Connection: conn, Request: request}
+					}
 				}
 			}
 		}
@@ -5,6 +5,9 @@ import (
 	"github.com/lienkolabs/breeze/network/trusted"
 )
 
+// Listener connects to a block broadcast service and channels every block
+// formation message (actions, headers, seals, votes, commits and rollovers)
+// received from it. Incoming is closed when the connection is lost.
 type Listener struct {
 	Connection *trusted.SignedConnection
 	Incoming   chan []byte
@@ -12,61 +15,42 @@ type Listener struct {
 
 func NewListener(credentials crypto.PrivateKey, address string, token crypto.Token) (*Listener, error) {
 	conn, err := trusted.Dial(address, credentials, token)
+	if err != nil {
+		return nil, err
+	}
 	listener := &Listener{
 		Connection: conn,
 		Incoming:   make(chan []byte),
 	}
-	if err != nil {
-		return nil, err
-	}
-
-	messages := make(chan []byte)
-	shutdown := make(chan struct{})
-
-	live := true
 
 	go func() {
+		subscribe := SubscribeProtocol{
+			Code:      ProtocolCode{255, 255, 255, 255},
+			FromEpoch: 0,
+		}
+		conn.Send(subscribe.Serialize())
 		for {
 			msg, err := conn.Read()
 			if err != nil {
-				if live {
-					live = false
-					shutdown <- struct{}{}
-				}
+				close(listener.Incoming)
 				return
 			}
-			messages <- msg
-		}
-	}()
-
-	// close broken connections and process subscribe instructions
-	go func() {
-		for {
-			select {
-			case <-shutdown:
-				if live {
-					listener.Connection.Shutdown()
-				}
-				live = false
-				return
-			case msg := <-messages:
-				listener.NewMessage(msg)
-			}
+			listener.NewMessage(msg)
 		}
 	}()
 	return listener, nil
 }
 
 func (l *Listener) Shutdown() {
-
+	l.Connection.Shutdown()
 }
 
 func (l *Listener) NewMessage(msg []byte) {
+	if len(msg) == 0 {
+		return
+	}
 	switch msg[0] {
-	case actionMsg:
-	case nextBlockMsg:
-	case sealBLockMsg:
-	case commitBlockMsg:
-	case rolloverBlockMsg:
+	case actionMsg, nextBlockMsg, sealBLockMsg, commitBlockMsg, rolloverBlockMsg, voteMsg, checkpointMsg, recoveryMsg, recoveryRequestMsg, checkpointCertificateMsg, viewChangeMsg, newViewMsg, setEndorsementMsg:
+		l.Incoming <- msg
 	}
 }
@@ -4,7 +4,9 @@ import (
 	"time"
 
 	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol"
 	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
 	"github.com/lienkolabs/breeze/util"
 )
 
@@ -17,13 +19,48 @@ const (
 	subscribeMsg
 	receiveTokenMsg
 	blockcacheMsg
+	voteMsg
+	checkpointMsg
+	recoveryMsg
+	proofRequestMsg
+	actionProofMsg
+	validatorSetMsg
+	validatorSetRequestMsg
+	viewChangeMsg
+	newViewMsg
+	livenessMsg
+	livenessRequestMsg
+	recoveryRequestMsg
+	checkpointCertificateMsg
+	setEndorsementMsg
+	balanceRequestMsg
+	balanceProofMsg
+	snapshotRequestMsg
+	snapshotMsg
+	historyRequestMsg
+	historicalBalanceMsg
 )
 
 const protocolPos = 9
 
 type ProtocolCode [4]byte
 
+// Code is the protocol code as recorded on blocks published for the protocol.
+func (c ProtocolCode) Code() protocol.Code {
+	code, _ := util.ParseUint32(c[:], 0)
+	return protocol.Code(code)
+}
+
+// Matches returns true if the action belongs to the protocol. Bytes of the
+// code equal to 255 match any byte.
+func (c ProtocolCode) Matches(action []byte) bool {
+	return validateCode(c, action)
+}
+
 func validateCode(code ProtocolCode, data []byte) bool {
+	if len(data) < protocolPos+4 {
+		return false
+	}
 	for n := 0; n < 4; n++ {
 		if code[n] != 255 && code[n] != data[protocolPos+n] {
 			return false
@@ -38,37 +75,15 @@ func NewBlockCache(block *chain.Block) BlockCache {
 	return append([]byte{blockcacheMsg}, block.Serialize()...)
 }
 
-func NewFilteredBlockCache(block *chain.Block, code ProtocolCode) BlockCache {
-	filtered := chain.Block{
-		Protocol:         block.Protocol,
-		Epoch:            block.Epoch,
-		CheckPoint:       block.CheckPoint,
-		CheckpointHash:   block.CheckpointHash,
-		Proposer:         block.Proposer,
-		Publisher:        block.Publisher,
-		ProposedAt:       block.ProposedAt,
-		Actions:          make([][]byte, 0),
-		Hash:             block.Hash,
-		SealSignature:    block.SealSignature,
-		PublishHash:      block.PublishHash,
-		PublishSignature: block.PublishSignature,
-		PreviousHash:     block.PreviousHash,
-		Invalidate:       make([]crypto.Hash, 0),
-	}
-	hashes := make(map[crypto.Hash]struct{})
-	for _, hash := range block.Invalidate {
-		hashes[hash] = struct{}{}
-	}
-	for _, action := range block.Actions {
-		if validateCode(code, action) {
-			filtered.Actions = append(filtered.Actions, action)
-			hash := crypto.Hasher(action)
-			if _, ok := hashes[hash]; ok {
-				filtered.Invalidate = append(filtered.Invalidate, hash)
-			}
-		}
+// NewFilteredBlockCache returns the block cache of the actions of the block
+// matching the protocol code. The filtered block is published with the given
+// credentials and carries a proof of the omitted actions, so that subscribers
+// can verify it against the seal of the original block.
+func NewFilteredBlockCache(block *chain.Block, code ProtocolCode, credentials crypto.PrivateKey) BlockCache {
+	keep := func(action []byte) bool {
+		return validateCode(code, action)
 	}
-	return NewBlockCache(&filtered)
+	return NewBlockCache(chain.NewPublishedBlock(block, code.Code(), keep, credentials))
 }
 
 func ParseBlockCache(data []byte) BlockCache {
@@ -78,6 +93,20 @@ func ParseBlockCache(data []byte) BlockCache {
 	return data[1:]
 }
 
+// NewActionMessage returns the message relaying an action to listeners.
+func NewActionMessage(action []byte) []byte {
+	return append([]byte{actionMsg}, action...)
+}
+
+// ParseAction returns the action carried by an action message or nil if data
+// is not an action message.
+func ParseAction(data []byte) []byte {
+	if len(data) < 2 || data[0] != actionMsg {
+		return nil
+	}
+	return data[1:]
+}
+
 type SubscribeProtocol struct {
 	Code      ProtocolCode
 	FromEpoch uint64
@@ -178,15 +207,19 @@ func ParseBlockHeader(data []byte) *BlockHeader {
 	return &header
 }
 
+// BlockTail is the seal of a block. The actions root allows listeners of a
+// subset of the actions of the block to verify the seal.
 type BlockTail struct {
-	Timestamp time.Time
-	Hash      crypto.Hash
-	Signature crypto.Signature
+	Timestamp   time.Time
+	ActionsRoot crypto.Hash
+	Hash        crypto.Hash
+	Signature   crypto.Signature
 }
 
 func (b *BlockTail) Serialize() []byte {
 	data := []byte{sealBLockMsg}
 	util.PutTime(b.Timestamp, &data)
+	util.PutHash(b.ActionsRoot, &data)
 	util.PutHash(b.Hash, &data)
 	util.PutSignature(b.Signature, &data)
 	return data
@@ -202,6 +235,7 @@ func ParseBlockTail(data []byte) *BlockTail {
 	position := 1
 	var tail BlockTail
 	tail.Timestamp, position = util.ParseTime(data, position)
+	tail.ActionsRoot, position = util.ParseHash(data, position)
 	tail.Hash, position = util.ParseHash(data, position)
 	tail.Signature, position = util.ParseSignature(data, position)
 	if position != len(data) {
@@ -210,11 +244,16 @@ func ParseBlockTail(data []byte) *BlockTail {
 	return &tail
 }
 
+// CommitBlock instructs the commit of a sealed block. Certificate carries the
+// votes of validators on the block so that receivers can verify finality.
+// StateRoot is the state root of the sender after the commit.
 type CommitBlock struct {
-	Epoch      uint64
-	Hash       crypto.Hash
-	ParentHash crypto.Hash
-	Invalidate []crypto.Hash
+	Epoch       uint64
+	Hash        crypto.Hash
+	ParentHash  crypto.Hash
+	Invalidate  []crypto.Hash
+	Certificate *chain.QuorumCertificate
+	StateRoot   crypto.Hash
 }
 
 func (b *CommitBlock) Serialize() []byte {
@@ -223,6 +262,8 @@ func (b *CommitBlock) Serialize() []byte {
 	util.PutHash(b.Hash, &data)
 	util.PutHash(b.ParentHash, &data)
 	util.PutHashArray(b.Invalidate, &data)
+	chain.PutQuorumCertificate(b.Certificate, &data)
+	util.PutHash(b.StateRoot, &data)
 	return data
 }
 
@@ -239,19 +280,63 @@ func ParseCommitBlock(data []byte) *CommitBlock {
 	commit.Hash, position = util.ParseHash(data, position)
 	commit.ParentHash, position = util.ParseHash(data, position)
 	commit.Invalidate, position = util.ParseHashArray(data, position)
+	commit.Certificate, position = chain.ParseOptionalQuorumCertificate(data, position)
+	commit.StateRoot, position = util.ParseHash(data, position)
 	if position != len(data) {
 		return nil
 	}
 	return &commit
 }
 
+// Finalized checks if the commit carries a valid quorum certificate for the
+// commited block according to the given committee.
+func (b *CommitBlock) Finalized(committee chain.Committee) bool {
+	return b.Certificate.Certifies(b.Epoch, b.Hash, chain.CommitHash(b.ParentHash, b.Invalidate, b.StateRoot), committee)
+}
+
+// NewVoteMessage wraps the vote of a validator on a sealed block.
+func NewVoteMessage(vote *chain.Vote) []byte {
+	return append([]byte{voteMsg}, vote.Serialize()...)
+}
+
+func ParseVoteMessage(data []byte) *chain.Vote {
+	if len(data) < 1 || data[0] != voteMsg {
+		return nil
+	}
+	return chain.ParseVote(data[1:])
+}
+
+// RolloverBlock instructs to discard every block after Epoch. It is signed by
+// the validator issuing it.
 type RolloverBlock struct {
-	Epoch uint64
+	Epoch     uint64
+	Token     crypto.Token
+	Signature crypto.Signature
 }
 
-func (b *RolloverBlock) Serialize() []byte {
+// NewRolloverBlock returns a rollover to the given epoch signed with the
+// credentials.
+func NewRolloverBlock(epoch uint64, credentials crypto.PrivateKey) *RolloverBlock {
+	rollover := RolloverBlock{Epoch: epoch, Token: credentials.PublicKey()}
+	rollover.Signature = credentials.Sign(rollover.serializeToSign())
+	return &rollover
+}
+
+func (b *RolloverBlock) serializeToSign() []byte {
 	data := []byte{rolloverBlockMsg}
 	util.PutUint64(b.Epoch, &data)
+	util.PutToken(b.Token, &data)
+	return data
+}
+
+// Verify returns true if the rollover is signed by its token.
+func (b *RolloverBlock) Verify() bool {
+	return b.Token.Verify(b.serializeToSign(), b.Signature)
+}
+
+func (b *RolloverBlock) Serialize() []byte {
+	data := b.serializeToSign()
+	util.PutSignature(b.Signature, &data)
 	return data
 }
 
@@ -265,8 +350,444 @@ func ParseRolloverBlock(data []byte) *RolloverBlock {
 	position := 1
 	var rollover RolloverBlock
 	rollover.Epoch, position = util.ParseUint64(data, position)
+	rollover.Token, position = util.ParseToken(data, position)
+	rollover.Signature, position = util.ParseSignature(data, position)
 	if position != len(data) {
 		return nil
 	}
 	return &rollover
 }
+
+// NewCheckpointMessage wraps the signed checkpoint of a node.
+func NewCheckpointMessage(checkpoint *chain.Checkpoint) []byte {
+	return append([]byte{checkpointMsg}, checkpoint.Serialize()...)
+}
+
+func ParseCheckpointMessage(data []byte) *chain.Checkpoint {
+	if len(data) < 1 || data[0] != checkpointMsg {
+		return nil
+	}
+	return chain.ParseCheckpoint(data[1:])
+}
+
+// NewCheckpointCertificateMessage announces that a quorum of the committee
+// certified a checkpoint. Listeners refuse recoveries below it.
+func NewCheckpointCertificateMessage(certificate *chain.CheckpointCertificate) []byte {
+	return append([]byte{checkpointCertificateMsg}, certificate.Serialize()...)
+}
+
+func ParseCheckpointCertificateMessage(data []byte) *chain.CheckpointCertificate {
+	if len(data) < 1 || data[0] != checkpointCertificateMsg {
+		return nil
+	}
+	return chain.ParseCheckpointCertificate(data[1:])
+}
+
+// NewRecoveryRequestMessage wraps the request of a validator to restore the
+// chain to its last certified checkpoint.
+func NewRecoveryRequestMessage(request *chain.RecoveryRequest) []byte {
+	return append([]byte{recoveryRequestMsg}, request.Serialize()...)
+}
+
+func ParseRecoveryRequestMessage(data []byte) *chain.RecoveryRequest {
+	if len(data) < 1 || data[0] != recoveryRequestMsg {
+		return nil
+	}
+	return chain.ParseRecoveryRequest(data[1:])
+}
+
+// NewRecoveryMessage announces that a quorum of the committee decided to
+// restore the chain to the checkpoint of the certificate. Every block after
+// the checkpoint epoch must be discarded once the certificate is verified
+// against the committee.
+func NewRecoveryMessage(certificate *chain.RecoveryCertificate) []byte {
+	return append([]byte{recoveryMsg}, certificate.Serialize()...)
+}
+
+func ParseRecoveryMessage(data []byte) *chain.RecoveryCertificate {
+	if len(data) < 1 || data[0] != recoveryMsg {
+		return nil
+	}
+	return chain.ParseRecoveryCertificate(data[1:])
+}
+
+// ProofRequest asks a block provider for the receipt of inclusion of an
+// action on the commited block of the given epoch.
+type ProofRequest struct {
+	Epoch  uint64
+	Action crypto.Hash
+}
+
+func (p *ProofRequest) Serialize() []byte {
+	data := []byte{proofRequestMsg}
+	util.PutUint64(p.Epoch, &data)
+	util.PutHash(p.Action, &data)
+	return data
+}
+
+func ParseProofRequest(data []byte) *ProofRequest {
+	if len(data) == 0 || data[0] != proofRequestMsg {
+		return nil
+	}
+	position := 1
+	var request ProofRequest
+	request.Epoch, position = util.ParseUint64(data, position)
+	request.Action, position = util.ParseHash(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &request
+}
+
+// ActionProof is the receipt of inclusion of an action on a commited block:
+// the sealed header of the block, the seal signature of its proposer, the
+// Merkle path of the action to the actions root of the header and the
+// certified outcome of the commit of the block. A receipt without header
+// reports that the provider does not know the action as incorporated by the
+// block.
+type ActionProof struct {
+	Epoch     uint64
+	Action    crypto.Hash
+	Header    []byte
+	Signature crypto.Signature
+	Proof     *chain.MerkleProof
+	Commit    *chain.CertifiedCommit
+}
+
+// Verify checks the seal of the header, the inclusion of the action and the
+// certificate of the commit of the block against the committee. An action
+// invalidated by the commit is not incorporated and its receipt is not valid.
+// It returns the header of the block or nil if the receipt is not valid.
+func (p *ActionProof) Verify(committee chain.Committee) *chain.Block {
+	if len(p.Header) == 0 || p.Proof == nil {
+		return nil
+	}
+	header := chain.ParseHeader(p.Header)
+	if header == nil || header.Epoch != p.Epoch {
+		return nil
+	}
+	if !header.Proposer.Verify(header.Hash[:], p.Signature) {
+		return nil
+	}
+	if !chain.VerifyInclusion(header.ActionsRoot, p.Action, p.Proof) {
+		return nil
+	}
+	if !p.Commit.Verify(committee) || p.Commit.Epoch != header.Epoch || !p.Commit.Hash.Equal(header.Hash) {
+		return nil
+	}
+	for _, invalidated := range p.Commit.Invalidate {
+		if invalidated.Equal(p.Action) {
+			return nil
+		}
+	}
+	header.SealSignature = p.Signature
+	header.PreviousHash = p.Commit.PreviousHash
+	header.Invalidate = p.Commit.Invalidate
+	header.StateRoot = p.Commit.StateRoot
+	header.Certificate = p.Commit.Certificate
+	return header
+}
+
+func (p *ActionProof) Serialize() []byte {
+	data := []byte{actionProofMsg}
+	util.PutUint64(p.Epoch, &data)
+	util.PutHash(p.Action, &data)
+	util.PutByteArray(p.Header, &data)
+	if len(p.Header) == 0 {
+		return data
+	}
+	util.PutSignature(p.Signature, &data)
+	util.PutByteArray(p.Proof.Serialize(), &data)
+	util.PutByteArray(p.Commit.Serialize(), &data)
+	return data
+}
+
+func ParseActionProof(data []byte) *ActionProof {
+	if len(data) == 0 || data[0] != actionProofMsg {
+		return nil
+	}
+	position := 1
+	var proof ActionProof
+	proof.Epoch, position = util.ParseUint64(data, position)
+	proof.Action, position = util.ParseHash(data, position)
+	proof.Header, position = util.ParseByteArray(data, position)
+	if len(proof.Header) == 0 {
+		if position != len(data) {
+			return nil
+		}
+		return &proof
+	}
+	proof.Signature, position = util.ParseSignature(data, position)
+	var path, commit []byte
+	path, position = util.ParseByteArray(data, position)
+	commit, position = util.ParseByteArray(data, position)
+	if position != len(data) {
+		return nil
+	}
+	if proof.Proof = chain.ParseMerkleProof(path); proof.Proof == nil {
+		return nil
+	}
+	if proof.Commit = chain.ParseCertifiedCommit(commit); proof.Commit == nil {
+		return nil
+	}
+	return &proof
+}
+
+// NewValidatorSetMessage announces the validator set computed at a checkpoint
+// with the endorsements of the outgoing set. It is also the answer of a block
+// provider to a validator set request.
+func NewValidatorSetMessage(certificate *chain.SetCertificate) []byte {
+	return append([]byte{validatorSetMsg}, certificate.Serialize()...)
+}
+
+func ParseValidatorSetMessage(data []byte) *chain.SetCertificate {
+	if len(data) < 1 || data[0] != validatorSetMsg {
+		return nil
+	}
+	return chain.ParseSetCertificate(data[1:])
+}
+
+// NewSetEndorsementMessage wraps the endorsement of a validator on the
+// validator set computed at a checkpoint.
+func NewSetEndorsementMessage(endorsement *chain.SetEndorsement) []byte {
+	return append([]byte{setEndorsementMsg}, endorsement.Serialize()...)
+}
+
+func ParseSetEndorsementMessage(data []byte) *chain.SetEndorsement {
+	if len(data) < 1 || data[0] != setEndorsementMsg {
+		return nil
+	}
+	return chain.ParseSetEndorsement(data[1:])
+}
+
+// NewValidatorSetRequest asks a block provider for its current validator set.
+func NewValidatorSetRequest() []byte {
+	return []byte{validatorSetRequestMsg}
+}
+
+func IsValidatorSetRequest(data []byte) bool {
+	return len(data) == 1 && data[0] == validatorSetRequestMsg
+}
+
+// NewViewChangeMessage wraps the request of a validator to replace the
+// proposer of a stalled epoch.
+func NewViewChangeMessage(change *chain.ViewChange) []byte {
+	return append([]byte{viewChangeMsg}, change.Serialize()...)
+}
+
+func ParseViewChangeMessage(data []byte) *chain.ViewChange {
+	if len(data) < 1 || data[0] != viewChangeMsg {
+		return nil
+	}
+	return chain.ParseViewChange(data[1:])
+}
+
+// NewViewMessage announces that a quorum of validators replaced the proposer
+// of a stalled epoch. Blocks of the epoch formed before it must be discarded.
+func NewViewMessage(certificate *chain.ViewCertificate) []byte {
+	return append([]byte{newViewMsg}, certificate.Serialize()...)
+}
+
+func ParseNewViewMessage(data []byte) *chain.ViewCertificate {
+	if len(data) < 1 || data[0] != newViewMsg {
+		return nil
+	}
+	return chain.ParseViewCertificate(data[1:])
+}
+
+// NewLivenessMessage wraps the liveness of validators within a checkpoint
+// window as seen by a node.
+func NewLivenessMessage(report *chain.LivenessReport) []byte {
+	return append([]byte{livenessMsg}, report.Serialize()...)
+}
+
+func ParseLivenessMessage(data []byte) *chain.LivenessReport {
+	if len(data) < 1 || data[0] != livenessMsg {
+		return nil
+	}
+	return chain.ParseLivenessReport(data[1:])
+}
+
+// NewLivenessRequest asks a block provider for the liveness of validators on
+// the current and the previous checkpoint windows.
+func NewLivenessRequest() []byte {
+	return []byte{livenessRequestMsg}
+}
+
+func IsLivenessRequest(data []byte) bool {
+	return len(data) == 1 && data[0] == livenessRequestMsg
+}
+
+// NewBalanceRequest asks a validator for the proof of the balances of a token
+// against its state root.
+func NewBalanceRequest(token crypto.Token) []byte {
+	data := []byte{balanceRequestMsg}
+	util.PutToken(token, &data)
+	return data
+}
+
+// ParseBalanceRequest returns the hash of the account of the requested token.
+func ParseBalanceRequest(data []byte) (crypto.Hash, bool) {
+	if len(data) < 1 || data[0] != balanceRequestMsg {
+		return crypto.Hash{}, false
+	}
+	token, position := util.ParseToken(data, 1)
+	if position != len(data) {
+		return crypto.Hash{}, false
+	}
+	return crypto.HashToken(token), true
+}
+
+// BalanceProof is the answer to a balance request: the proof of the balances
+// of an account against the state root of a validator after the commit of the
+// block of the given epoch. The root must match the state root of the block,
+// as certified by the quorum certificate of its commit.
+type BalanceProof struct {
+	Epoch uint64
+	Root  crypto.Hash
+	Proof *state.BalanceProof
+}
+
+// Verify checks the proof against the root and returns the balances of the
+// account, or nil if the proof is not valid.
+func (b *BalanceProof) Verify() *state.Leaf {
+	if b.Proof == nil || !b.Proof.Verify(b.Root) {
+		return nil
+	}
+	return &b.Proof.Leaf
+}
+
+func (b *BalanceProof) Serialize() []byte {
+	data := []byte{balanceProofMsg}
+	util.PutUint64(b.Epoch, &data)
+	util.PutHash(b.Root, &data)
+	util.PutByteArray(b.Proof.Serialize(), &data)
+	return data
+}
+
+func ParseBalanceProof(data []byte) *BalanceProof {
+	if len(data) < 1 || data[0] != balanceProofMsg {
+		return nil
+	}
+	position := 1
+	var proof BalanceProof
+	var bytes []byte
+	proof.Epoch, position = util.ParseUint64(data, position)
+	proof.Root, position = util.ParseHash(data, position)
+	bytes, position = util.ParseByteArray(data, position)
+	if position != len(data) {
+		return nil
+	}
+	if proof.Proof = state.ParseBalanceProof(bytes); proof.Proof == nil {
+		return nil
+	}
+	return &proof
+}
+
+func NewSnapshotRequest() []byte {
+	return []byte{snapshotRequestMsg}
+}
+
+func IsSnapshotRequest(data []byte) bool {
+	return len(data) == 1 && data[0] == snapshotRequestMsg
+}
+
+// SnapshotChunk is a piece of the snapshot file of the state at a checkpoint
+// epoch. Snapshots are streamed in Count chunks of at most SnapshotChunkSize
+// bytes.
+type SnapshotChunk struct {
+	Epoch uint64
+	Index uint32
+	Count uint32
+	Data  []byte
+}
+
+func (s *SnapshotChunk) Serialize() []byte {
+	data := []byte{snapshotMsg}
+	util.PutUint64(s.Epoch, &data)
+	util.PutUint32(s.Index, &data)
+	util.PutUint32(s.Count, &data)
+	util.PutByteArray(s.Data, &data)
+	return data
+}
+
+func ParseSnapshotChunk(data []byte) *SnapshotChunk {
+	if len(data) < 1 || data[0] != snapshotMsg {
+		return nil
+	}
+	position := 1
+	var chunk SnapshotChunk
+	chunk.Epoch, position = util.ParseUint64(data, position)
+	chunk.Index, position = util.ParseUint32(data, position)
+	chunk.Count, position = util.ParseUint32(data, position)
+	chunk.Data, position = util.ParseByteArray(data, position)
+	if position != len(data) || chunk.Index >= chunk.Count {
+		return nil
+	}
+	return &chunk
+}
+
+// HistoryRequest asks an index provider for the balance of a token after the
+// commit of the block of the given epoch.
+type HistoryRequest struct {
+	Epoch uint64
+	Token crypto.Token
+}
+
+func (h *HistoryRequest) Serialize() []byte {
+	data := []byte{historyRequestMsg}
+	util.PutUint64(h.Epoch, &data)
+	util.PutToken(h.Token, &data)
+	return data
+}
+
+func ParseHistoryRequest(data []byte) *HistoryRequest {
+	if len(data) == 0 || data[0] != historyRequestMsg {
+		return nil
+	}
+	position := 1
+	var request HistoryRequest
+	request.Epoch, position = util.ParseUint64(data, position)
+	request.Token, position = util.ParseToken(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &request
+}
+
+// HistoricalBalance is the answer to a history request. A balance that is not
+// Known reports that the epoch is out of the history of the provider.
+type HistoricalBalance struct {
+	Epoch   uint64
+	Token   crypto.Token
+	Known   bool
+	Wallet  uint64
+	Deposit uint64
+}
+
+func (h *HistoricalBalance) Serialize() []byte {
+	data := []byte{historicalBalanceMsg}
+	util.PutUint64(h.Epoch, &data)
+	util.PutToken(h.Token, &data)
+	util.PutBool(h.Known, &data)
+	util.PutUint64(h.Wallet, &data)
+	util.PutUint64(h.Deposit, &data)
+	return data
+}
+
+func ParseHistoricalBalance(data []byte) *HistoricalBalance {
+	if len(data) == 0 || data[0] != historicalBalanceMsg {
+		return nil
+	}
+	position := 1
+	var balance HistoricalBalance
+	balance.Epoch, position = util.ParseUint64(data, position)
+	balance.Token, position = util.ParseToken(data, position)
+	balance.Known, position = util.ParseBool(data, position)
+	balance.Wallet, position = util.ParseUint64(data, position)
+	balance.Deposit, position = util.ParseUint64(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &balance
+}
@@ -89,7 +89,7 @@ func (node *ProtocolNode) incorporate(msg []byte) bool {
 			node.Validator.CommitBlock(commit.Epoch, commit.Hash, commit.ParentHash, commit.Invalidate)
 		case rolloverBlockMsg:
 			rollover := ParseRolloverBlock(msg)
-			if rollover == nil {
+			if rollover == nil || !rollover.Verify() {
 				return false
 			}
 			node.Validator.RolloverBlock(rollover.Epoch)
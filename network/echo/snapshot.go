@@ -0,0 +1,105 @@
+package echo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/trusted"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
+)
+
+// SnapshotChunkSize is the maximum size of the data of a snapshot chunk.
+const SnapshotChunkSize = 1 << 15
+
+// snapshotTimeout bounds the wait for the next chunk of a snapshot.
+const snapshotTimeout = 10 * time.Second
+
+// NewSnapshotChunks splits the snapshot file of the state at a certified
+// checkpoint into serialized snapshot chunk messages.
+func NewSnapshotChunks(certified *state.CertifiedSnapshot) [][]byte {
+	data := certified.Serialize()
+	count := (len(data) + SnapshotChunkSize - 1) / SnapshotChunkSize
+	chunks := make([][]byte, 0, count)
+	for n := 0; n < count; n++ {
+		end := (n + 1) * SnapshotChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := SnapshotChunk{Epoch: certified.Snapshot.Epoch, Index: uint32(n), Count: uint32(count), Data: data[n*SnapshotChunkSize : end]}
+		chunks = append(chunks, chunk.Serialize())
+	}
+	return chunks
+}
+
+// SyncSnapshot connects to the block broadcast service of a node and requests
+// the snapshot of the state at its last certified checkpoint. The snapshot is
+// verified against the committee in charge of the checkpoint, so that the node
+// need not be trusted.
+func SyncSnapshot(credentials crypto.PrivateKey, address string, token crypto.Token, committee chain.Committee) (*state.CertifiedSnapshot, error) {
+	conn, err := trusted.Dial(address, credentials, token)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Shutdown()
+	if err := conn.Send(NewSnapshotRequest()); err != nil {
+		return nil, err
+	}
+	chunks := make(chan *SnapshotChunk)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			data, err := conn.Read()
+			if err != nil {
+				close(chunks)
+				return
+			}
+			if chunk := ParseSnapshotChunk(data); chunk != nil {
+				select {
+				case chunks <- chunk:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	var epoch uint64
+	var pieces [][]byte
+	received := 0
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return nil, errors.New("connection closed before the snapshot was received")
+			}
+			if pieces == nil || chunk.Epoch != epoch || int(chunk.Count) != len(pieces) {
+				// first chunk, or the node moved on to a new checkpoint
+				epoch = chunk.Epoch
+				pieces = make([][]byte, chunk.Count)
+				received = 0
+			}
+			if pieces[chunk.Index] == nil {
+				pieces[chunk.Index] = chunk.Data
+				received++
+			}
+			if received == len(pieces) {
+				data := make([]byte, 0, len(pieces)*SnapshotChunkSize)
+				for _, piece := range pieces {
+					data = append(data, piece...)
+				}
+				certified := state.ParseCertifiedSnapshot(data)
+				if certified == nil {
+					return nil, errors.New("corrupted snapshot")
+				}
+				if err := certified.Verify(committee); err != nil {
+					return nil, err
+				}
+				return certified, nil
+			}
+		case <-time.After(snapshotTimeout):
+			return nil, errors.New("timeout waiting for the snapshot")
+		}
+	}
+}
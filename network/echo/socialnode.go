@@ -2,6 +2,7 @@ package echo
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/lienkolabs/breeze/crypto"
 	"github.com/lienkolabs/breeze/network"
@@ -19,6 +20,10 @@ type SocialNode struct {
 	State       chain.State
 	shutdown    chan struct{}
 	broadcast   *BroadcastPool
+	committee   chain.Committee
+	code        ProtocolCode
+	assembler   *Assembler
+	certified   uint64 // epoch of the last certified checkpoint
 }
 
 type SocialNodeConfig struct {
@@ -28,6 +33,7 @@ type SocialNodeConfig struct {
 	BlockServiveToken      crypto.Token
 	BlockBroadcastPort     int
 	BlockBroadcastFirewall network.ValidateConnection
+	Committee              chain.Committee // optional: verify finality of commits
 }
 
 func NewSocialNodeListener(config *SocialNodeConfig, state chain.State) (*SocialNode, error) {
@@ -39,6 +45,9 @@ func NewSocialNodeListener(config *SocialNodeConfig, state chain.State) (*Social
 		Credentials: config.Credentials,
 		State:       state,
 		shutdown:    make(chan struct{}),
+		committee:   config.Committee,
+		code:        config.SocialCode,
+		assembler:   NewAssembler(config.Committee, false),
 	}
 	node.broadcast, err = NewBroadcastPool(config.Credentials, config.BlockBroadcastFirewall, config.BlockBroadcastPort)
 	if err != nil {
@@ -86,7 +95,21 @@ func (l *SocialNode) Shutdown() {
 	l.shutdown <- struct{}{}
 }
 
+// publish re-signs a commited block filtered down to the protocol of the node
+// and broadcasts it to the listeners of the node.
+func (l *SocialNode) publish(block *chain.Block) {
+	keep := func(action []byte) bool {
+		return validateCode(l.code, action)
+	}
+	published := chain.NewPublishedBlock(block, l.code.Code(), keep, l.Credentials)
+	l.broadcast.Append(published)
+	l.broadcast.Broadcast(NewBlockCache(published))
+}
+
 func (l *SocialNode) NewMessage(msg []byte) {
+	if block := l.assembler.Message(msg); block != nil {
+		l.publish(block)
+	}
 	switch msg[0] {
 	case actionMsg:
 		l.Chain.Validate(msg[1:])
@@ -97,10 +120,36 @@ func (l *SocialNode) NewMessage(msg []byte) {
 		//seal := ParseBlockTail(msg)
 		l.Chain.SealOwnBlock()
 	case commitBlockMsg:
-		//commit := ParseCommitBlock(msg)
-		l.Chain.CommitOwnBlock()
+		commit := ParseCommitBlock(msg)
+		if commit == nil || (l.committee != nil && !commit.Finalized(l.committee)) {
+			return
+		}
+		l.Chain.CommitOwnBlock(commit.Certificate)
 	case rolloverBlockMsg:
 		rollover := ParseRolloverBlock(msg)
+		if rollover == nil || !rollover.Verify() {
+			return
+		}
+		if l.committee != nil && !isMember(rollover.Token, l.committee.Members(rollover.Epoch)) {
+			return
+		}
 		l.Chain.RolloverBlock(rollover.Epoch)
+	case checkpointCertificateMsg:
+		certificate := ParseCheckpointCertificateMessage(msg)
+		if certificate != nil && certificate.Epoch > l.certified && certificate.Verify(l.committee) {
+			l.certified = certificate.Epoch
+		}
+	case recoveryMsg:
+		decision := ParseRecoveryMessage(msg)
+		if decision == nil || decision.Epoch < l.certified || decision.Epoch <= l.Chain.Recovered || !decision.Verify(l.committee) {
+			return
+		}
+		if err := l.Chain.Recover(decision); err != nil {
+			log.Printf("social node: could not recover to checkpoint %v: %v", decision.Epoch, err)
+			return
+		}
+		l.certified = decision.Epoch
+		l.assembler.Reset()
+		l.broadcast.BroadcastRecovery(decision)
 	}
 }
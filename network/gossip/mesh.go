@@ -0,0 +1,235 @@
+// Package gossip implements a peer-to-peer mesh among validators.
+//
+// Every message on the mesh is wrapped into an envelope signed by the node
+// that originated it, so that relayed messages keep the identity of their
+// origin. Nodes relay every new envelope to all their peers except the one it
+// was received from. Envelopes are deduplicated by the hash of their contents:
+// a message already seen by a node is neither relayed nor delivered again, no
+// matter the origin.
+package gossip
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/trusted"
+	"github.com/lienkolabs/breeze/util"
+)
+
+var reconnectInterval = 5 * time.Second
+
+// sendQueueSize is the number of envelopes kept for a peer whose connection
+// cannot keep up. Further envelopes to the peer are dropped.
+const sendQueueSize = 1 << 10
+
+// Peer is a node of the mesh. Address is the host:port of its peer-to-peer
+// service.
+type Peer struct {
+	Token   crypto.Token
+	Address string
+}
+
+type MeshConfig struct {
+	Credentials crypto.PrivateKey
+	Port        int
+	Peers       []Peer
+}
+
+// Mesh is the connection of a node to its peers. Messages originated by any
+// node of the mesh are delivered once on Messages together with the token of
+// their origin.
+type Mesh struct {
+	Messages    chan trusted.Message
+	credentials crypto.PrivateKey
+	peers       map[crypto.Token]Peer
+	mu          sync.Mutex
+	conn        map[crypto.Token]*peerConnection
+	seen        *recent
+	listener    net.Listener
+}
+
+type peerConnection struct {
+	conn *trusted.SignedConnection
+	send chan []byte
+}
+
+// acceptPeers accepts connections only from tokens of the mesh.
+type acceptPeers map[crypto.Token]Peer
+
+func (a acceptPeers) ValidateConnection(token crypto.Token) chan bool {
+	response := make(chan bool, 1)
+	_, ok := a[token]
+	response <- ok
+	return response
+}
+
+// NewMesh listens for connections of peers on the configured port and keeps
+// connections to peers alive. To avoid duplicate connections a node dials
+// only peers whose token is greater than its own.
+func NewMesh(config *MeshConfig) (*Mesh, error) {
+	token := config.Credentials.PublicKey()
+	mesh := &Mesh{
+		Messages:    make(chan trusted.Message),
+		credentials: config.Credentials,
+		peers:       make(map[crypto.Token]Peer),
+		conn:        make(map[crypto.Token]*peerConnection),
+		seen:        newRecent(),
+	}
+	for _, peer := range config.Peers {
+		if !peer.Token.Equal(token) {
+			mesh.peers[peer.Token] = peer
+		}
+	}
+	var err error
+	if mesh.listener, err = net.Listen("tcp", fmt.Sprintf(":%v", config.Port)); err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := mesh.listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				signed, err := trusted.PromoteConnection(conn, config.Credentials, acceptPeers(mesh.peers))
+				if err != nil {
+					conn.Close()
+					return
+				}
+				mesh.serve(signed)
+			}()
+		}
+	}()
+	for _, peer := range mesh.peers {
+		if bytes.Compare(token[:], peer.Token[:]) < 0 {
+			mesh.dial(peer)
+		}
+	}
+	return mesh, nil
+}
+
+// dial keeps a connection to the given peer, reconnecting whenever it is lost.
+func (m *Mesh) dial(peer Peer) {
+	go func() {
+		for {
+			if conn, err := trusted.Dial(peer.Address, m.credentials, peer.Token); err == nil {
+				m.serve(conn)
+			}
+			time.Sleep(reconnectInterval)
+		}
+	}()
+}
+
+// serve registers the connection to a peer and reads envelopes from it until
+// the connection is lost.
+func (m *Mesh) serve(conn *trusted.SignedConnection) {
+	peer := &peerConnection{conn: conn, send: make(chan []byte, sendQueueSize)}
+	m.mu.Lock()
+	if existing, ok := m.conn[conn.Token]; ok {
+		existing.conn.Shutdown()
+	}
+	m.conn[conn.Token] = peer
+	m.mu.Unlock()
+	go func() {
+		for envelope := range peer.send {
+			if err := conn.Send(envelope); err != nil {
+				conn.Shutdown()
+			}
+		}
+	}()
+	for {
+		envelope, err := conn.Read()
+		if err != nil {
+			break
+		}
+		m.receive(conn.Token, envelope)
+	}
+	m.mu.Lock()
+	if m.conn[conn.Token] == peer {
+		delete(m.conn, conn.Token)
+	}
+	m.mu.Unlock()
+	close(peer.send)
+}
+
+// receive delivers and relays a new valid envelope.
+func (m *Mesh) receive(from crypto.Token, envelope []byte) {
+	origin, data := openEnvelope(envelope)
+	if data == nil || origin.Equal(m.credentials.PublicKey()) {
+		return
+	}
+	if _, ok := m.peers[origin]; !ok {
+		return
+	}
+	if !m.seen.add(crypto.Hasher(data)) {
+		return
+	}
+	m.relay(envelope, from)
+	m.Messages <- trusted.Message{Token: origin, Data: data}
+}
+
+// Broadcast originates a message on the mesh. Messages already seen on the
+// mesh are ignored, so nodes relaying messages of others on their own block
+// broadcast service can forward them here at no cost.
+func (m *Mesh) Broadcast(data []byte) {
+	if len(data) == 0 || !m.seen.add(crypto.Hasher(data)) {
+		return
+	}
+	m.relay(sealEnvelope(data, m.credentials), crypto.ZeroToken)
+}
+
+func (m *Mesh) relay(envelope []byte, except crypto.Token) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token, peer := range m.conn {
+		if token.Equal(except) {
+			continue
+		}
+		select {
+		case peer.send <- envelope:
+		default:
+			log.Printf("gossip: send queue to %v is full, dropping message", token)
+		}
+	}
+}
+
+func (m *Mesh) Shutdown() {
+	m.listener.Close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, peer := range m.conn {
+		peer.conn.Shutdown()
+	}
+}
+
+func sealEnvelope(data []byte, credentials crypto.PrivateKey) []byte {
+	envelope := make([]byte, 0, len(data)+crypto.TokenSize+crypto.SignatureSize+4)
+	util.PutToken(credentials.PublicKey(), &envelope)
+	util.PutUint32(uint32(len(data)), &envelope)
+	envelope = append(envelope, data...)
+	util.PutSignature(credentials.Sign(data), &envelope)
+	return envelope
+}
+
+func openEnvelope(envelope []byte) (crypto.Token, []byte) {
+	var origin crypto.Token
+	var size uint32
+	var signature crypto.Signature
+	position := 0
+	origin, position = util.ParseToken(envelope, position)
+	size, position = util.ParseUint32(envelope, position)
+	if position+int(size) > len(envelope) {
+		return origin, nil
+	}
+	data := envelope[position : position+int(size)]
+	signature, position = util.ParseSignature(envelope, position+int(size))
+	if position != len(envelope) || len(data) == 0 || !origin.Verify(data, signature) {
+		return origin, nil
+	}
+	return origin, data
+}
@@ -0,0 +1,65 @@
+package gossip
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestMesh(t *testing.T) {
+	reconnectInterval = 100 * time.Millisecond
+	keys := make([]crypto.PrivateKey, 3)
+	peers := make([]Peer, 3)
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+		peers[n] = Peer{Token: keys[n].PublicKey(), Address: fmt.Sprintf("localhost:%v", 7880+n)}
+	}
+	meshes := make([]*Mesh, 3)
+	for n := range meshes {
+		var err error
+		if meshes[n], err = NewMesh(&MeshConfig{Credentials: keys[n], Port: 7880 + n, Peers: peers}); err != nil {
+			t.Fatal(err)
+		}
+		defer meshes[n].Shutdown()
+	}
+	for count := 0; ; count++ {
+		connected := true
+		for _, mesh := range meshes {
+			mesh.mu.Lock()
+			connected = connected && len(mesh.conn) == 2
+			mesh.mu.Unlock()
+		}
+		if connected {
+			break
+		}
+		if count > 50 {
+			t.Fatal("mesh not connected")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	meshes[0].Broadcast([]byte("block"))
+	meshes[0].Broadcast([]byte("block"))
+	for _, mesh := range meshes[1:] {
+		select {
+		case msg := <-mesh.Messages:
+			if !msg.Token.Equal(keys[0].PublicKey()) || string(msg.Data) != "block" {
+				t.Fatalf("unexpected message: %v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case msg := <-meshes[1].Messages:
+			t.Fatalf("duplicate message delivered: %v", msg)
+		case msg := <-meshes[2].Messages:
+			t.Fatalf("duplicate message delivered: %v", msg)
+		case <-timeout:
+			return
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package gossip
+
+import (
+	"sync"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+// recentSize is the number of hashes kept on each generation of the recent
+// set. A hash is remembered for at least recentSize insertions.
+const recentSize = 1 << 16
+
+// recent is a bounded set of recently seen hashes. When the current
+// generation is full it becomes the previous one and the oldest generation is
+// discarded.
+type recent struct {
+	mu       sync.Mutex
+	current  map[crypto.Hash]struct{}
+	previous map[crypto.Hash]struct{}
+}
+
+func newRecent() *recent {
+	return &recent{
+		current:  make(map[crypto.Hash]struct{}),
+		previous: make(map[crypto.Hash]struct{}),
+	}
+}
+
+// add includes hash in the set and returns true if it was not seen before.
+func (r *recent) add(hash crypto.Hash) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.current[hash]; ok {
+		return false
+	}
+	if _, ok := r.previous[hash]; ok {
+		return false
+	}
+	if len(r.current) >= recentSize {
+		r.previous = r.current
+		r.current = make(map[crypto.Hash]struct{})
+	}
+	r.current[hash] = struct{}{}
+	return true
+}
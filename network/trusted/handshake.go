@@ -9,6 +9,17 @@ import (
 )
 
 var errCouldNotVerify = errors.New("could not verify communication")
+var errOtherNetwork = errors.New("remote node belongs to a network with another genesis")
+
+// genesis is the hash of the genesis of the network the node belongs to. It is
+// exchanged on handshake and connections to nodes of other networks refused.
+var genesis crypto.Hash
+
+// SetGenesis sets the genesis hash checked on every subsequent handshake. It
+// must be called before any connection is established.
+func SetGenesis(hash crypto.Hash) {
+	genesis = hash
+}
 
 // Simple implementation of hasdshake for signed communication between nodes.
 //
@@ -29,6 +40,9 @@ var errCouldNotVerify = errors.New("could not verify communication")
 // The caller checks if the token is the one expected and verify the signature.
 // It signs the proposed nonce and send it to the called.
 //
+// Both messages carry the genesis hash of the network of the sender, and each
+// party refuses the connection if it does not match its own.
+//
 // The called verifies the signature and if ok, the connection is ready to be
 // used.
 
@@ -80,7 +94,7 @@ func performClientHandShake(conn net.Conn, prvKey crypto.PrivateKey, remotePub c
 	// send own public key and a random nonce to be signed by the remote server
 	pubKey := prvKey.PublicKey()
 	nonce := crypto.Nonce()
-	msgToSend := append(pubKey[:], nonce...)
+	msgToSend := append(append(pubKey[:], nonce...), genesis[:]...)
 	writehs(conn, msgToSend)
 
 	// receive remote token, signature of provided nonce and a new nonce to sign
@@ -88,14 +102,18 @@ func performClientHandShake(conn net.Conn, prvKey crypto.PrivateKey, remotePub c
 	if err != nil {
 		return nil, err
 	}
-	if len(resp) != crypto.TokenSize+crypto.NonceSize+crypto.SignatureSize {
+	if len(resp) != crypto.TokenSize+crypto.NonceSize+crypto.SignatureSize+crypto.Size {
 		return nil, errCouldNotVerify
 	}
 	// test if t he copy matches with subtle
 	remoteToken := resp[0:crypto.TokenSize]
 	var remoteSignature crypto.Signature
 	copy(remoteSignature[:], resp[crypto.TokenSize:crypto.TokenSize+crypto.SignatureSize])
-	remoteNonce := resp[crypto.TokenSize+crypto.SignatureSize:]
+	remoteNonce := resp[crypto.TokenSize+crypto.SignatureSize : crypto.TokenSize+crypto.SignatureSize+crypto.NonceSize]
+	if !genesis.Equals(resp[crypto.TokenSize+crypto.SignatureSize+crypto.NonceSize:]) {
+		conn.Close()
+		return nil, errOtherNetwork
+	}
 	if subtle.ConstantTimeCompare(remoteToken, remotePub[:]) != 1 {
 		return nil, errCouldNotVerify
 	}
@@ -119,9 +137,13 @@ func PromoteConnection(conn net.Conn, prvKey crypto.PrivateKey, validator Valida
 	if err != nil {
 		return nil, err
 	}
-	if len(resp) != crypto.TokenSize+crypto.NonceSize {
+	if len(resp) != crypto.TokenSize+crypto.NonceSize+crypto.Size {
 		return nil, errCouldNotVerify
 	}
+	if !genesis.Equals(resp[crypto.TokenSize+crypto.NonceSize:]) {
+		conn.Close()
+		return nil, errOtherNetwork
+	}
 	var clientToken crypto.Token
 	copy(clientToken[:], resp[0:crypto.TokenSize])
 	// check if public key is a member: TODO check if is a validator
@@ -133,12 +155,12 @@ func PromoteConnection(conn net.Conn, prvKey crypto.PrivateKey, validator Valida
 		return nil, errCouldNotVerify
 	}
 
-	nonce := resp[crypto.TokenSize:]
+	nonce := resp[crypto.TokenSize : crypto.TokenSize+crypto.NonceSize]
 	signature := prvKey.Sign(nonce)
 	token := prvKey.PublicKey()
 	newNonce := crypto.Nonce()
 
-	msgToSend := append(append(token[:], signature[:]...), newNonce...)
+	msgToSend := append(append(append(token[:], signature[:]...), newNonce...), genesis[:]...)
 	if err := writehs(conn, msgToSend); err != nil {
 		return nil, err
 	}
@@ -10,9 +10,18 @@ const (
 	ITransfer
 	IDeposit
 	IWithdraw
+	IDoubleSign
 	IUnkown
 )
 
+// Version 0 actions are bounded only by the epoch they are signed for. Version 1
+// actions carry, right after the epoch, the sequence number of the account
+// signing them, which must follow the last sequence number of the account.
+const (
+	unsequencedVersion byte = iota
+	sequencedVersion
+)
+
 type HashAction struct {
 	Action Action
 	Hash   crypto.Hash
@@ -35,6 +44,9 @@ type Action interface {
 	Kind() byte
 	FeePaid() uint64
 	Tokens() []crypto.Token
+	// Sequenced returns the token signing the action and its sequence number,
+	// zero for version 0 actions.
+	Sequenced() (crypto.Token, uint64)
 }
 
 func NewPayment(debitAcc crypto.Hash, value uint64) *Payment {
@@ -69,22 +81,81 @@ func Kind(data []byte) byte {
 }
 
 func ParseAction(data []byte) Action {
-	if data[0] != 0 {
+	if len(data) < 2 || data[0] > sequencedVersion {
 		return nil
 	}
 	switch data[1] {
 	case ITransfer:
-		return ParseTransfer(data)
+		if transfer := ParseTransfer(data); transfer != nil {
+			return transfer
+		}
 	case IDeposit:
-		return ParseDeposit(data)
+		if deposit := ParseDeposit(data); deposit != nil {
+			return deposit
+		}
 	case IWithdraw:
-		return ParseWithdraw(data)
+		if withdraw := ParseWithdraw(data); withdraw != nil {
+			return withdraw
+		}
+	case IDoubleSign:
+		if evidence := ParseDoubleSign(data); evidence != nil {
+			return evidence
+		}
 	case IVoid:
-		return ParseVoid(data)
+		if void := ParseVoid(data); void != nil {
+			return void
+		}
 	}
 	return nil
 }
 
+// putHeader starts the serialization of an action with its version, kind,
+// epoch and, for version 1, the sequence number.
+func putHeader(kind byte, epoch, sequence uint64) []byte {
+	version := unsequencedVersion
+	if sequence > 0 {
+		version = sequencedVersion
+	}
+	bytes := []byte{version, kind}
+	util.PutUint64(epoch, &bytes)
+	if sequence > 0 {
+		util.PutUint64(sequence, &bytes)
+	}
+	return bytes
+}
+
+// parseHeader parses the header of an action of the given kind. It returns
+// false for another kind, an unknown version or a version 1 action without
+// sequence number.
+func parseHeader(data []byte, kind byte) (uint64, uint64, int, bool) {
+	if len(data) < 2 || data[1] != kind || data[0] > sequencedVersion {
+		return 0, 0, len(data) + 1, false
+	}
+	var epoch, sequence uint64
+	position := 2
+	epoch, position = util.ParseUint64(data, position)
+	if data[0] == sequencedVersion {
+		if sequence, position = util.ParseUint64(data, position); sequence == 0 {
+			return 0, 0, len(data) + 1, false
+		}
+	}
+	return epoch, sequence, position, true
+}
+
+// putJSONHeader puts the version, kind, epoch and sequence number of an action.
+func putJSONHeader(bulk *util.JSONBuilder, kind byte, epoch, sequence uint64) {
+	if sequence > 0 {
+		bulk.PutUint64("version", uint64(sequencedVersion))
+	} else {
+		bulk.PutUint64("version", uint64(unsequencedVersion))
+	}
+	bulk.PutUint64("instructionType", uint64(kind))
+	bulk.PutUint64("epoch", epoch)
+	if sequence > 0 {
+		bulk.PutUint64("sequence", sequence)
+	}
+}
+
 func GetTokens(data []byte) []crypto.Token {
 	action := ParseAction(data)
 	if action == nil {
@@ -7,6 +7,7 @@ import (
 
 type Deposit struct {
 	TimeStamp uint64
+	Sequence  uint64
 	Token     crypto.Token
 	Value     uint64
 	Fee       uint64
@@ -21,9 +22,12 @@ func (d *Deposit) FeePaid() uint64 {
 	return d.Fee
 }
 
+func (d *Deposit) Sequenced() (crypto.Token, uint64) {
+	return d.Token, d.Sequence
+}
+
 func (d *Deposit) serializeSign() []byte {
-	bytes := []byte{0, IDeposit}
-	util.PutUint64(d.TimeStamp, &bytes)
+	bytes := putHeader(IDeposit, d.TimeStamp, d.Sequence)
 	util.PutToken(d.Token, &bytes)
 	util.PutUint64(d.Value, &bytes)
 	util.PutUint64(d.Fee, &bytes)
@@ -59,9 +63,7 @@ func (d *Deposit) Sign(key crypto.PrivateKey) {
 
 func (d *Deposit) JSON() string {
 	bulk := &util.JSONBuilder{}
-	bulk.PutUint64("version", 0)
-	bulk.PutUint64("instructionType", uint64(IDeposit))
-	bulk.PutUint64("epoch", d.TimeStamp)
+	putJSONHeader(bulk, IDeposit, d.TimeStamp, d.Sequence)
 	bulk.PutHex("token", d.Token[:])
 	bulk.PutUint64("value", d.Value)
 	bulk.PutUint64("fee", d.Fee)
@@ -70,15 +72,17 @@ func (d *Deposit) JSON() string {
 }
 
 func ParseDeposit(data []byte) *Deposit {
-	if len(data) < 2 || data[1] != IDeposit {
+	epoch, sequence, position, ok := parseHeader(data, IDeposit)
+	if !ok {
 		return nil
 	}
-	p := Deposit{}
-	position := 2
-	p.TimeStamp, position = util.ParseUint64(data, position)
+	p := Deposit{TimeStamp: epoch, Sequence: sequence}
 	p.Token, position = util.ParseToken(data, position)
 	p.Value, position = util.ParseUint64(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msgToVerify := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
 	if !p.Token.Verify(msgToVerify, p.Signature) {
@@ -0,0 +1,172 @@
+package actions
+
+import (
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// SealTail is the block tail a proposer signs on sealing a block, together
+// with the checkpoint the block builds upon. With the epoch and the proposer
+// it completes the sealed header whose hash is signed.
+type SealTail struct {
+	Checkpoint     uint64
+	CheckpointHash crypto.Hash
+	Timestamp      time.Time
+	ActionsRoot    crypto.Hash
+	Signature      crypto.Signature
+}
+
+// Hash returns the hash of the sealed header of a block of the given epoch and
+// proposer with the seal. It must follow the sealed header of chain blocks.
+func (s *SealTail) Hash(epoch uint64, proposer crypto.Token) crypto.Hash {
+	bytes := make([]byte, 0)
+	util.PutUint32(0, &bytes)
+	util.PutUint64(epoch, &bytes)
+	util.PutUint64(s.Checkpoint, &bytes)
+	util.PutHash(s.CheckpointHash, &bytes)
+	util.PutToken(proposer, &bytes)
+	util.PutTime(s.Timestamp, &bytes)
+	util.PutHash(s.ActionsRoot, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+func putSealTail(s SealTail, data *[]byte) {
+	util.PutUint64(s.Checkpoint, data)
+	util.PutHash(s.CheckpointHash, data)
+	util.PutTime(s.Timestamp, data)
+	util.PutHash(s.ActionsRoot, data)
+	util.PutSignature(s.Signature, data)
+}
+
+func parseSealTail(data []byte, position int) (SealTail, int) {
+	s := SealTail{}
+	s.Checkpoint, position = util.ParseUint64(data, position)
+	s.CheckpointHash, position = util.ParseHash(data, position)
+	s.Timestamp, position = util.ParseTime(data, position)
+	s.ActionsRoot, position = util.ParseHash(data, position)
+	s.Signature, position = util.ParseSignature(data, position)
+	return s, position
+}
+
+// DoubleSign is the evidence that Offender signed the seals of two different
+// blocks for the same epoch. The evidence is submitted and signed by Reporter.
+// A valid evidence slashes the deposit of the offender and rewards the
+// reporter.
+type DoubleSign struct {
+	TimeStamp  uint64
+	Sequence   uint64
+	Reporter   crypto.Token
+	Offender   crypto.Token
+	BlockEpoch uint64
+	First      SealTail
+	Second     SealTail
+	Fee        uint64
+	Signature  crypto.Signature
+}
+
+func (d *DoubleSign) Tokens() []crypto.Token {
+	return []crypto.Token{d.Reporter, d.Offender}
+}
+
+func (d *DoubleSign) FeePaid() uint64 {
+	return d.Fee
+}
+
+func (d *DoubleSign) Sequenced() (crypto.Token, uint64) {
+	return d.Reporter, d.Sequence
+}
+
+func (d *DoubleSign) serializeSign() []byte {
+	bytes := putHeader(IDoubleSign, d.TimeStamp, d.Sequence)
+	util.PutToken(d.Reporter, &bytes)
+	util.PutToken(d.Offender, &bytes)
+	util.PutUint64(d.BlockEpoch, &bytes)
+	putSealTail(d.First, &bytes)
+	putSealTail(d.Second, &bytes)
+	util.PutUint64(d.Fee, &bytes)
+	return bytes
+}
+
+func (d *DoubleSign) Serialize() []byte {
+	bytes := d.serializeSign()
+	util.PutSignature(d.Signature, &bytes)
+	return bytes
+}
+
+func (d *DoubleSign) Authority() crypto.Token {
+	return crypto.ZeroToken
+}
+
+func (d *DoubleSign) Epoch() uint64 {
+	return d.TimeStamp
+}
+
+func (d *DoubleSign) Kind() byte {
+	return IDoubleSign
+}
+
+func (d *DoubleSign) Payments() *Payment {
+	return NewPayment(crypto.HashToken(d.Reporter), d.Fee)
+}
+
+func (d *DoubleSign) Sign(key crypto.PrivateKey) {
+	bytes := d.serializeSign()
+	d.Signature = key.Sign(bytes)
+}
+
+// Conflicting returns true if both seals are signed by the offender and seal
+// different blocks.
+func (d *DoubleSign) Conflicting() bool {
+	first := d.First.Hash(d.BlockEpoch, d.Offender)
+	second := d.Second.Hash(d.BlockEpoch, d.Offender)
+	if first.Equal(second) {
+		return false
+	}
+	return d.Offender.Verify(first[:], d.First.Signature) && d.Offender.Verify(second[:], d.Second.Signature)
+}
+
+func (d *DoubleSign) JSON() string {
+	bulk := &util.JSONBuilder{}
+	putJSONHeader(bulk, IDoubleSign, d.TimeStamp, d.Sequence)
+	bulk.PutHex("reporter", d.Reporter[:])
+	bulk.PutHex("offender", d.Offender[:])
+	bulk.PutUint64("blockEpoch", d.BlockEpoch)
+	first := d.First.Hash(d.BlockEpoch, d.Offender)
+	second := d.Second.Hash(d.BlockEpoch, d.Offender)
+	bulk.PutHex("firstHash", first[:])
+	bulk.PutHex("secondHash", second[:])
+	bulk.PutUint64("fee", d.Fee)
+	bulk.PutBase64("signature", d.Signature[:])
+	return bulk.ToString()
+}
+
+// ParseDoubleSign parses a double sign evidence. It returns nil if the
+// evidence is not signed by the reporter, if the reporter is the offender or
+// if the seals do not conflict.
+func ParseDoubleSign(data []byte) *DoubleSign {
+	epoch, sequence, position, ok := parseHeader(data, IDoubleSign)
+	if !ok {
+		return nil
+	}
+	p := DoubleSign{TimeStamp: epoch, Sequence: sequence}
+	p.Reporter, position = util.ParseToken(data, position)
+	p.Offender, position = util.ParseToken(data, position)
+	p.BlockEpoch, position = util.ParseUint64(data, position)
+	p.First, position = parseSealTail(data, position)
+	p.Second, position = parseSealTail(data, position)
+	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
+	if p.Reporter.Equal(p.Offender) {
+		return nil
+	}
+	msgToVerify := data[0:position]
+	p.Signature, _ = util.ParseSignature(data, position)
+	if !p.Reporter.Verify(msgToVerify, p.Signature) || !p.Conflicting() {
+		return nil
+	}
+	return &p
+}
@@ -7,6 +7,7 @@ import (
 
 type Transfer struct {
 	TimeStamp uint64
+	Sequence  uint64
 	From      crypto.Token
 	To        []crypto.TokenValue
 	Reason    string
@@ -35,9 +36,12 @@ func (t *Transfer) FeePaid() uint64 {
 	return t.Fee
 }
 
+func (t *Transfer) Sequenced() (crypto.Token, uint64) {
+	return t.From, t.Sequence
+}
+
 func (t *Transfer) serializeSign() []byte {
-	bytes := []byte{0, ITransfer}
-	util.PutUint64(t.TimeStamp, &bytes)
+	bytes := putHeader(ITransfer, t.TimeStamp, t.Sequence)
 	util.PutToken(t.From, &bytes)
 	util.PutUint16(uint16(len(t.To)), &bytes)
 	count := len(t.To)
@@ -92,9 +96,7 @@ func (t *Transfer) Sign(key crypto.PrivateKey) {
 
 func (t *Transfer) JSON() string {
 	bulk := &util.JSONBuilder{}
-	bulk.PutUint64("version", 0)
-	bulk.PutUint64("instructionType", uint64(ITransfer))
-	bulk.PutUint64("epoch", t.TimeStamp)
+	putJSONHeader(bulk, ITransfer, t.TimeStamp, t.Sequence)
 	bulk.PutHex("from", t.From[:])
 	bulk.PutTokenValueArray("to", t.To)
 	bulk.PutString("reason", t.Reason)
@@ -104,12 +106,11 @@ func (t *Transfer) JSON() string {
 }
 
 func ParseTransfer(data []byte) *Transfer {
-	if len(data) < 2 || data[1] != ITransfer {
+	epoch, sequence, position, ok := parseHeader(data, ITransfer)
+	if !ok {
 		return nil
 	}
-	p := Transfer{}
-	position := 2
-	p.TimeStamp, position = util.ParseUint64(data, position)
+	p := Transfer{TimeStamp: epoch, Sequence: sequence}
 	p.From, position = util.ParseToken(data, position)
 	var count uint16
 	count, position = util.ParseUint16(data, position)
@@ -120,6 +121,9 @@ func ParseTransfer(data []byte) *Transfer {
 	}
 	p.Reason, position = util.ParseString(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
 	if !p.From.Verify(msg, p.Signature) {
@@ -7,6 +7,7 @@ import (
 
 type Void struct {
 	TimeStamp uint64
+	Sequence  uint64
 	Protocol  uint32
 	Data      []byte
 	Wallet    crypto.Token
@@ -22,9 +23,12 @@ func (v *Void) FeePaid() uint64 {
 	return v.Fee
 }
 
+func (v *Void) Sequenced() (crypto.Token, uint64) {
+	return v.Wallet, v.Sequence
+}
+
 func (t *Void) serializeSign() []byte {
-	bytes := []byte{0, IVoid}
-	util.PutUint64(t.TimeStamp, &bytes)
+	bytes := putHeader(IVoid, t.TimeStamp, t.Sequence)
 	util.PutUint32(t.Protocol, &bytes)
 	util.PutByteArray(t.Data, &bytes)
 	util.PutToken(t.Wallet, &bytes)
@@ -65,16 +69,18 @@ func (t *Void) Sign(key crypto.PrivateKey) {
 }
 
 func ParseVoid(data []byte) *Void {
-	if len(data) < 2 || data[1] != IVoid {
+	epoch, sequence, position, ok := parseHeader(data, IVoid)
+	if !ok {
 		return nil
 	}
-	p := Void{}
-	position := 2
-	p.TimeStamp, position = util.ParseUint64(data, position)
+	p := Void{TimeStamp: epoch, Sequence: sequence}
 	p.Protocol, position = util.ParseUint32(data, position)
 	p.Data, position = util.ParseByteArray(data, position)
 	p.Wallet, position = util.ParseToken(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msg := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
 	if !p.Wallet.Verify(msg, p.Signature) {
@@ -7,6 +7,7 @@ import (
 
 type Withdraw struct {
 	TimeStamp uint64
+	Sequence  uint64
 	Token     crypto.Token
 	Value     uint64
 	Fee       uint64
@@ -21,9 +22,12 @@ func (w *Withdraw) FeePaid() uint64 {
 	return w.Fee
 }
 
+func (w *Withdraw) Sequenced() (crypto.Token, uint64) {
+	return w.Token, w.Sequence
+}
+
 func (w *Withdraw) serializeSign() []byte {
-	bytes := []byte{0, IWithdraw}
-	util.PutUint64(w.TimeStamp, &bytes)
+	bytes := putHeader(IWithdraw, w.TimeStamp, w.Sequence)
 	util.PutToken(w.Token, &bytes)
 	util.PutUint64(w.Value, &bytes)
 	util.PutUint64(w.Fee, &bytes)
@@ -59,9 +63,7 @@ func (w *Withdraw) Sign(key crypto.PrivateKey) {
 
 func (w *Withdraw) JSON() string {
 	bulk := &util.JSONBuilder{}
-	bulk.PutUint64("version", 0)
-	bulk.PutUint64("instructionType", uint64(IWithdraw))
-	bulk.PutUint64("epoch", w.TimeStamp)
+	putJSONHeader(bulk, IWithdraw, w.TimeStamp, w.Sequence)
 	bulk.PutHex("token", w.Token[:])
 	bulk.PutUint64("value", w.Value)
 	bulk.PutUint64("fee", w.Fee)
@@ -70,15 +72,17 @@ func (w *Withdraw) JSON() string {
 }
 
 func ParseWithdraw(data []byte) *Withdraw {
-	if len(data) < 2 || data[1] != IWithdraw {
+	epoch, sequence, position, ok := parseHeader(data, IWithdraw)
+	if !ok {
 		return nil
 	}
-	p := Withdraw{}
-	position := 2
-	p.TimeStamp, position = util.ParseUint64(data, position)
+	p := Withdraw{TimeStamp: epoch, Sequence: sequence}
 	p.Token, position = util.ParseToken(data, position)
 	p.Value, position = util.ParseUint64(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if position > len(data) {
+		return nil
+	}
 	msgToVerify := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
 	if !p.Token.Verify(msgToVerify, p.Signature) {
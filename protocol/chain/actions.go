@@ -1,34 +1,200 @@
 package chain
 
 import (
+	"fmt"
+	"os"
+	"sync"
+
 	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
 )
 
-const MaxProtocolEpoch = 100
+// MaxProtocolEpoch is the number of epochs an action remains valid after the
+// epoch it refers to. It is set by the genesis of the network.
+var MaxProtocolEpoch uint64 = 100
 
+// IncorporatedActions keeps the hashes of commited actions still within their
+// validity window, indexed by the epoch they refer to, together with the epoch
+// of the block that incorporated them. It rejects the inclusion of an action
+// more than once on the chain.
 type IncorporatedActions struct {
 	CurrentEpoch uint64
 	incorporated map[uint64]map[crypto.Hash]uint64
 }
 
-func (ia *IncorporatedActions) Append(hash crypto.Hash, epoch uint64) {
+func NewIncorporatedActions(epoch uint64) *IncorporatedActions {
+	return &IncorporatedActions{
+		CurrentEpoch: epoch,
+		incorporated: make(map[uint64]map[crypto.Hash]uint64),
+	}
+}
+
+// Append registers the action with the given hash referring to epoch as
+// incorporated by the block of epoch incorporation.
+func (ia *IncorporatedActions) Append(hash crypto.Hash, epoch, incorporation uint64) {
 	if epochHashes, ok := ia.incorporated[epoch]; ok {
-		epochHashes[hash] = epoch
+		epochHashes[hash] = incorporation
 	} else {
-		ia.incorporated[epoch] = map[crypto.Hash]uint64{hash: epoch}
+		ia.incorporated[epoch] = map[crypto.Hash]uint64{hash: incorporation}
 	}
 }
 
+// IsNew returns false if the action was incorporated by a block up to the
+// given checkpoint.
 func (ia *IncorporatedActions) IsNew(hash crypto.Hash, epoch uint64, checkpoint uint64) bool {
 	if epochHashes, ok := ia.incorporated[epoch]; ok {
 		incorporation, exists := epochHashes[hash]
-		return !exists && (incorporation <= checkpoint)
+		return !exists || incorporation > checkpoint
 	}
 	return true
 }
 
+// MoveForward advances the current epoch by one and discards actions that can
+// no longer be valid at the new epoch.
 func (ia *IncorporatedActions) MoveForward() uint64 {
-	delete(ia.incorporated, ia.CurrentEpoch-MaxProtocolEpoch)
 	ia.CurrentEpoch += 1
+	if ia.CurrentEpoch >= MaxProtocolEpoch {
+		delete(ia.incorporated, ia.CurrentEpoch-MaxProtocolEpoch)
+	}
 	return ia.CurrentEpoch
 }
+
+// Rollback forgets actions incorporated by blocks after the given epoch.
+func (ia *IncorporatedActions) Rollback(epoch uint64) {
+	for _, epochHashes := range ia.incorporated {
+		for hash, incorporation := range epochHashes {
+			if incorporation > epoch {
+				delete(epochHashes, hash)
+			}
+		}
+	}
+	ia.CurrentEpoch = epoch
+}
+
+// IncorporatedLog persists the actions incorporated by commited blocks so that
+// a resumed chain keeps rejecting actions incorporated before a restart. Each
+// commit appends a record of the block epoch followed by the hash and the
+// epoch of every action it incorporated. A later record for the same block
+// epoch, as after a recovery, replaces the earlier one.
+type IncorporatedLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func OpenIncorporatedLog(filePath string) (*IncorporatedLog, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open incorporated actions log: %v", err)
+	}
+	return &IncorporatedLog{file: file}, nil
+}
+
+// incorporation is the record of the actions incorporated by a block.
+type incorporation struct {
+	hashes []crypto.Hash
+	epochs []uint64
+}
+
+func putIncorporation(epoch uint64, record *incorporation, data *[]byte) {
+	util.PutUint64(epoch, data)
+	util.PutUint32(uint32(len(record.hashes)), data)
+	for n, hash := range record.hashes {
+		util.PutHash(hash, data)
+		util.PutUint64(record.epochs[n], data)
+	}
+}
+
+// Append persists the hashes and the epochs of the actions incorporated by the
+// commited block of the given epoch.
+func (l *IncorporatedLog) Append(block uint64, hashes []crypto.Hash, epochs []uint64) error {
+	record := &incorporation{hashes: hashes, epochs: epochs}
+	bytes := make([]byte, 0)
+	putIncorporation(block, record, &bytes)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n, err := l.file.Write(bytes); n != len(bytes) {
+		return fmt.Errorf("could not persist incorporated actions: %v", err)
+	}
+	return nil
+}
+
+// Load returns the actions incorporated by blocks up to the given commited
+// epoch that are still within their validity window at it.
+func (l *IncorporatedLog) Load(commited uint64) (*IncorporatedActions, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := os.ReadFile(l.file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("could not read incorporated actions log: %v", err)
+	}
+	records := make(map[uint64]*incorporation)
+	position := 0
+	for position < len(data) {
+		var epoch uint64
+		var count uint32
+		epoch, position = util.ParseUint64(data, position)
+		count, position = util.ParseUint32(data, position)
+		if position+int(count)*(crypto.Size+8) > len(data) {
+			return nil, fmt.Errorf("truncated incorporated actions log")
+		}
+		record := &incorporation{hashes: make([]crypto.Hash, int(count)), epochs: make([]uint64, int(count))}
+		for n := 0; n < int(count); n++ {
+			record.hashes[n], position = util.ParseHash(data, position)
+			record.epochs[n], position = util.ParseUint64(data, position)
+		}
+		records[epoch] = record
+	}
+	ia := NewIncorporatedActions(commited)
+	for incorporated, record := range records {
+		if incorporated > commited {
+			continue
+		}
+		for n, epoch := range record.epochs {
+			if epoch+MaxProtocolEpoch > commited {
+				ia.Append(record.hashes[n], epoch, incorporated)
+			}
+		}
+	}
+	return ia, nil
+}
+
+// Compact rewrites the log with the given incorporated actions alone, so that
+// the log does not grow beyond the validity window of actions.
+func (l *IncorporatedLog) Compact(ia *IncorporatedActions) error {
+	records := make(map[uint64]*incorporation)
+	for epoch, epochHashes := range ia.incorporated {
+		for hash, incorporated := range epochHashes {
+			record, ok := records[incorporated]
+			if !ok {
+				record = &incorporation{}
+				records[incorporated] = record
+			}
+			record.hashes = append(record.hashes, hash)
+			record.epochs = append(record.epochs, epoch)
+		}
+	}
+	bytes := make([]byte, 0)
+	for epoch, record := range records {
+		putIncorporation(epoch, record, &bytes)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	path := l.file.Name()
+	if err := os.WriteFile(path+".tmp", bytes, 0644); err != nil {
+		return fmt.Errorf("could not compact incorporated actions log: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("could not compact incorporated actions log: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open incorporated actions log: %v", err)
+	}
+	l.file.Close()
+	l.file = file
+	return nil
+}
+
+func (l *IncorporatedLog) Close() error {
+	return l.file.Close()
+}
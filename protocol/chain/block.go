@@ -24,13 +24,25 @@ type Block struct {
 	Publisher        crypto.Token // Only if prototol is not breeze
 	ProposedAt       time.Time
 	Actions          [][]byte
+	ActionsRoot      crypto.Hash // Merkle root of actions, see ActionsRoot
 	Hash             crypto.Hash
 	SealSignature    crypto.Signature
 	PublishHash      crypto.Hash      // Only if protocol is not breeze
 	PublishSignature crypto.Signature // Only if protocol is not breeze
+	Filter           *FilterProof     // Only if protocol is not breeze, optional
 	PreviousHash     crypto.Hash      // Hash of the recognzied prior sequence of blocks
 	Invalidate       []crypto.Hash
+	Certificate      *QuorumCertificate // Votes on the block finality
+	StateRoot        crypto.Hash        // Root of the state after the commit of the block
 	Validator        MutatingState
+	included         map[crypto.Hash]struct{} // hashes of actions, see Includes
+}
+
+// CommitHash is the digest of the outcome of the commit of the block voted by
+// validators. It is only meaningful once the block is commited or prepared for
+// commit.
+func (b *Block) CommitHash() crypto.Hash {
+	return CommitHash(b.PreviousHash, b.Invalidate, b.StateRoot)
 }
 
 func (b *Block) NewBlock() *Block {
@@ -44,6 +56,9 @@ func (b *Block) NewBlock() *Block {
 	}
 }
 
+// Header is the header of the block. The header alone suffices to check the
+// seal of the block and, together with a MerkleProof, the inclusion of an
+// action.
 func (b *Block) Header() []byte {
 	bytes := make([]byte, 0)
 	util.PutUint32(uint32(b.Protocol), &bytes)
@@ -55,10 +70,51 @@ func (b *Block) Header() []byte {
 		util.PutToken(b.Publisher, &bytes)
 	}
 	util.PutTime(b.ProposedAt, &bytes)
+	util.PutHash(b.ActionsRoot, &bytes)
 	util.PutUint32(uint32(len(b.Actions)), &bytes)
 	return bytes
 }
 
+// sealHeader is the part of the header sealed by the proposer. Blocks of other
+// protocols are filtered from a breeze block and keep its seal: their sealed
+// header is that of the breeze block, whose actions root they keep.
+func (b *Block) sealHeader() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint32(0, &bytes)
+	util.PutUint64(b.Epoch, &bytes)
+	util.PutUint64(b.CheckPoint, &bytes)
+	util.PutHash(b.CheckpointHash, &bytes)
+	util.PutToken(b.Proposer, &bytes)
+	util.PutTime(b.ProposedAt, &bytes)
+	util.PutHash(b.ActionsRoot, &bytes)
+	return bytes
+}
+
+// ParseHeader parses a header into a block without actions whose hash is the
+// hash of its sealed header.
+func ParseHeader(data []byte) *Block {
+	position := 0
+	block := Block{}
+	var protocolNum uint32
+	protocolNum, position = util.ParseUint32(data, position)
+	block.Protocol = protocol.Code(protocolNum)
+	block.Epoch, position = util.ParseUint64(data, position)
+	block.CheckPoint, position = util.ParseUint64(data, position)
+	block.CheckpointHash, position = util.ParseHash(data, position)
+	block.Proposer, position = util.ParseToken(data, position)
+	if block.Protocol != 0 {
+		block.Publisher, position = util.ParseToken(data, position)
+	}
+	block.ProposedAt, position = util.ParseTime(data, position)
+	block.ActionsRoot, position = util.ParseHash(data, position)
+	_, position = util.ParseUint32(data, position)
+	if position != len(data) {
+		return nil
+	}
+	block.Hash = crypto.Hasher(block.sealHeader())
+	return &block
+}
+
 func (b *Block) Tail() []byte {
 	bytes := make([]byte, 0)
 	util.PutSignature(b.SealSignature, &bytes)
@@ -75,43 +131,115 @@ func (b *Block) Validate(action []byte) bool {
 		return false
 	}
 	b.Actions = append(b.Actions, action)
+	if b.included != nil {
+		b.included[crypto.Hasher(action)] = struct{}{}
+	}
 	return true
 }
 
+// Includes returns true if the action with the given hash is on the block.
+func (b *Block) Includes(hash crypto.Hash) bool {
+	if b.included == nil {
+		b.included = make(map[crypto.Hash]struct{}, len(b.Actions))
+		for _, action := range b.Actions {
+			b.included[crypto.Hasher(action)] = struct{}{}
+		}
+	}
+	_, ok := b.included[hash]
+	return ok
+}
+
+// serializeForSeal is the header followed by the actions of the block.
 func (b *Block) serializeForSeal() []byte {
-	bytes := make([]byte, 0)
-	util.PutUint32(uint32(b.Protocol), &bytes)
-	util.PutUint64(b.Epoch, &bytes)
-	util.PutUint64(b.CheckPoint, &bytes)
-	util.PutHash(b.CheckpointHash, &bytes)
-	util.PutToken(b.Proposer, &bytes)
-	if b.Protocol != 0 {
-		util.PutToken(b.Publisher, &bytes)
+	bytes := b.Header()
+	for _, action := range b.Actions {
+		util.PutByteArray(action, &bytes)
 	}
-	util.PutTime(b.ProposedAt, &bytes)
-	util.PutActionsArray(b.Actions, &bytes)
 	return bytes
 }
 
+// sealHash sets the actions root of the block and returns the hash of its
+// sealed header.
+func (b *Block) sealHash() crypto.Hash {
+	b.ActionsRoot = ActionsRoot(b.Actions)
+	return crypto.Hasher(b.sealHeader())
+}
+
+// VerifySeal checks that the hash of the block is the hash of its sealed header
+// and that it is signed by the proposer.
+func (b *Block) VerifySeal() bool {
+	return crypto.Hasher(b.sealHeader()).Equal(b.Hash) && b.Proposer.Verify(b.Hash[:], b.SealSignature)
+}
+
 func (b *Block) Seal(credentials crypto.PrivateKey) {
-	b.ProposedAt = time.Now()
-	data := b.serializeForSeal()
-	b.Hash = crypto.Hasher(data)
+	b.SealAt(time.Now(), credentials)
+}
+
+// SealAt seals the block as proposed at the given time.
+func (b *Block) SealAt(proposedAt time.Time, credentials crypto.PrivateKey) {
+	b.ProposedAt = proposedAt
+	b.Hash = b.sealHash()
 	b.SealSignature = credentials.Sign(b.Hash[:])
 }
 
 func (b *Block) serializeForPublish() []byte {
 	bytes := b.serializeForSeal()
+	if b.Protocol != 0 {
+		putFilterProof(b.Filter, &bytes)
+	}
 	util.PutHash(b.Hash, &bytes)
 	util.PutSignature(b.SealSignature, &bytes)
 	return bytes
 }
 
+// Publish signs the block as its publisher. The publisher signature covers the
+// protocol code, the actions of the block and the seal of the proposer.
 func (b *Block) Publish(credentials crypto.PrivateKey) {
+	b.Publisher = credentials.PublicKey()
 	b.PublishHash = crypto.Hasher(b.serializeForPublish())
 	b.PublishSignature = credentials.Sign(b.PublishHash[:])
 }
 
+// NewPublishedBlock returns the block of the given protocol with the actions of
+// the sealed block source for which keep is true, published with credentials.
+// The published block keeps the seal, the actions root and the commit details
+// of source, every invalidated hash included, so that its quorum certificate
+// can still be verified. If source is a breeze block with all its actions, the
+// published block carries a FilterProof of its actions against the actions
+// root.
+func NewPublishedBlock(source *Block, code protocol.Code, keep func(action []byte) bool, credentials crypto.PrivateKey) *Block {
+	published := &Block{
+		Protocol:       code,
+		Epoch:          source.Epoch,
+		CheckPoint:     source.CheckPoint,
+		CheckpointHash: source.CheckpointHash,
+		Proposer:       source.Proposer,
+		ProposedAt:     source.ProposedAt,
+		Actions:        make([][]byte, 0),
+		ActionsRoot:    source.ActionsRoot,
+		Hash:           source.Hash,
+		SealSignature:  source.SealSignature,
+		PreviousHash:   source.PreviousHash,
+		Invalidate:     source.Invalidate,
+		Certificate:    source.Certificate,
+		StateRoot:      source.StateRoot,
+	}
+	filter := &FilterProof{Positions: make([]uint32, 0), Omitted: make([]crypto.Hash, 0)}
+	for n, action := range source.Actions {
+		if keep(action) {
+			published.Actions = append(published.Actions, action)
+			filter.Positions = append(filter.Positions, uint32(n))
+		} else {
+			filter.Omitted = append(filter.Omitted, crypto.Hasher(action))
+		}
+	}
+	if source.Protocol == 0 && ActionsRoot(source.Actions).Equal(source.ActionsRoot) {
+		published.Filter = filter
+	}
+	published.Publish(credentials)
+	return published
+}
+
 func (b *Block) Serialize() []byte {
 	bytes := b.serializeForPublish()
 	if b.Protocol != 0 {
@@ -120,13 +248,17 @@ func (b *Block) Serialize() []byte {
 	}
 	util.PutHash(b.PreviousHash, &bytes)
 	util.PutHashArray(b.Invalidate, &bytes)
+	PutQuorumCertificate(b.Certificate, &bytes)
+	util.PutHash(b.StateRoot, &bytes)
 	return bytes
 }
 
+// ParseBlock parses a block and verifies the seal of its proposer and, for
+// blocks of protocols other than breeze, the signature of its publisher. The
+// actions of a breeze block must match its actions root. Actions of blocks of
+// other protocols must match the actions root through their FilterProof, if
+// any, and are otherwise attested by the publisher alone.
 func ParseBlock(data []byte) *Block {
-	if data[0] != 0 {
-		return nil
-	}
 	position := 0
 	block := Block{}
 	var protocolNum uint32
@@ -140,25 +272,46 @@ func ParseBlock(data []byte) *Block {
 		block.Publisher, position = util.ParseToken(data, position)
 	}
 	block.ProposedAt, position = util.ParseTime(data, position)
+	block.ActionsRoot, position = util.ParseHash(data, position)
 	block.Actions, position = util.ParseActionsArray(data, position)
-	hash := crypto.Hasher(data[0:position])
-	block.Hash, position = util.ParseHash(data, position)
-	if block.Protocol == 0 && !hash.Equal(block.Hash) {
+	if block.Protocol == 0 && !ActionsRoot(block.Actions).Equal(block.ActionsRoot) {
 		return nil
 	}
+	if block.Protocol != 0 {
+		block.Filter, position = parseFilterProof(data, position)
+		if block.Filter != nil {
+			if root, ok := block.Filter.Root(block.Actions); !ok || !root.Equal(block.ActionsRoot) {
+				return nil
+			}
+		}
+	}
+	block.Hash, position = util.ParseHash(data, position)
 	block.SealSignature, position = util.ParseSignature(data, position)
-	if !block.Proposer.Verify(hash[:], block.SealSignature) {
+	if !block.VerifySeal() {
 		return nil
 	}
 	if block.Protocol != 0 {
+		if position > len(data) {
+			return nil
+		}
+		publishHash := crypto.Hasher(data[0:position])
 		block.PublishHash, position = util.ParseHash(data, position)
 		block.PublishSignature, position = util.ParseSignature(data, position)
-		if block.Publisher.Verify(block.PublishHash[:], block.PublishSignature) {
+		if !publishHash.Equal(block.PublishHash) || !block.Publisher.Verify(block.PublishHash[:], block.PublishSignature) {
 			return nil
 		}
 	}
 	block.PreviousHash, position = util.ParseHash(data, position)
-	block.Invalidate, _ = util.ParseHashArray(data, position)
+	block.Invalidate, position = util.ParseHashArray(data, position)
+	if position < len(data) {
+		block.Certificate, position = ParseOptionalQuorumCertificate(data, position)
+	}
+	if position < len(data) {
+		block.StateRoot, position = util.ParseHash(data, position)
+	}
+	if position != len(data) {
+		return nil
+	}
 	return &block
 }
 
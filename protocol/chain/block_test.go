@@ -0,0 +1,52 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestPublishedBlock(t *testing.T) {
+	proposer, proposerKey := crypto.RandomAsymetricKey()
+	publisher, publisherKey := crypto.RandomAsymetricKey()
+	source := &Block{Epoch: 5, Proposer: proposer, Actions: [][]byte{[]byte("first"), []byte("second"), []byte("third")}}
+	source.Seal(proposerKey)
+	source.Invalidate = []crypto.Hash{crypto.Hasher([]byte("first")), crypto.Hasher([]byte("third"))}
+	keep := func(action []byte) bool {
+		return string(action) != "third"
+	}
+	published := NewPublishedBlock(source, 7, keep, publisherKey)
+	if !published.CommitHash().Equal(source.CommitHash()) || published.Filter == nil {
+		t.Fatalf("published block does not keep the commit of its source")
+	}
+	data := published.Serialize()
+	parsed := ParseBlock(data)
+	if parsed == nil {
+		t.Fatal("could not parse published block")
+	}
+	if parsed.Protocol != 7 || !parsed.Publisher.Equal(publisher) || !parsed.Hash.Equal(source.Hash) || len(parsed.Actions) != 2 {
+		t.Fatal("published block does not match")
+	}
+	tampered := NewPublishedBlock(source, 7, keep, publisherKey)
+	tampered.Actions = append(tampered.Actions, []byte("forged"))
+	if ParseBlock(tampered.Serialize()) != nil {
+		t.Fatal("block with actions not attested by publisher accepted")
+	}
+	tampered.Actions[1] = []byte("forged")
+	tampered.Actions = tampered.Actions[:2]
+	tampered.Publish(publisherKey)
+	if ParseBlock(tampered.Serialize()) != nil {
+		t.Fatal("block with actions not on the sealed block accepted")
+	}
+	tampered.Filter = nil
+	tampered.Publish(publisherKey)
+	if ParseBlock(tampered.Serialize()) == nil {
+		t.Fatal("block without filter proof attested by publisher rejected")
+	}
+	forged := NewPublishedBlock(source, 7, keep, publisherKey)
+	forged.Epoch = 6
+	forged.Publish(publisherKey)
+	if ParseBlock(forged.Serialize()) != nil {
+		t.Fatal("block not sealed by proposer accepted")
+	}
+}
@@ -21,6 +21,7 @@ package chain
 
 import (
 	"errors"
+	"log"
 	"time"
 
 	"github.com/lienkolabs/breeze/crypto"
@@ -44,15 +45,22 @@ type State interface {
 	NewMutations() Mutations
 	Validator(Mutations, uint64) MutatingState
 	Incorporate(MutatingState, crypto.Token)
+	Checksum() crypto.Hash
+	Root() crypto.Hash
+	RootAfter(MutatingState, crypto.Token) crypto.Hash
+	Rollback(uint64) error
 	Shutdown()
 }
 
-// Chain is a non-disputed block interface... one block proposed for each
-// epoch, every block is sealed before the proposal of a new block.
+// Chain is a block interface with one block chosen for each epoch, every
+// block is sealed before the proposal of a new block. Competing proposals for
+// an epoch are kept as Candidates and the chain follows the branch chosen by
+// its ForkChoice rule, LongestBranch if none is set.
 // Final commit of blocks can be delayed and the chain might be asked to
 // rollover to any epoch after the last commit epoch. disaster recovery,
-// that means, the rollover before last commit epoch is not anticipated on the
-// structure and must be implemented separatedly.
+// that means, the rollover before last commit epoch, is only possible to the
+// last checkpoint through Recover, and only once a quorum of the committee
+// decided it. A chain recovers at most once to each checkpoint.
 type Chain struct {
 	Incorporated    *IncorporatedActions
 	Credentials     crypto.PrivateKey
@@ -60,7 +68,144 @@ type Chain struct {
 	LastCommitHash  crypto.Hash
 	CommitState     State
 	SealedBlocks    map[uint64]*Block
+	Candidates      map[uint64]map[crypto.Hash]*Block // sealed blocks after last commit by epoch and hash
+	ForkChoice      ForkChoice
 	LiveBlock       *Block
+	View            uint64    // proposer replacements of the epoch after the last commit
+	Committee       Committee // if set commits must carry a quorum certificate
+	RollingHash     crypto.Hash
+	LastCheckpoint  *Checkpoint
+	Certified       *CheckpointCertificate                // last checkpoint certified by a quorum
+	Recovered       uint64                                // epoch of the last checkpoint recovered to
+	Checkpoints     *CheckpointLog                        // if set checkpoints are persisted
+	Head            *HeadFile                             // if set the chain head is persisted
+	IncorporatedLog *IncorporatedLog                      // if set incorporated actions are persisted
+	Clock           func() time.Time                      // if set own blocks are sealed at its time
+	liveness        map[uint64]map[crypto.Token]*Liveness // by checkpoint window
+}
+
+// NewChainFromGenesis returns a chain whose only sealed and commited block is
+// the genesis block of the provided state identified by genesisHash.
+func NewChainFromGenesis(credentials crypto.PrivateKey, genesis State, genesisHash crypto.Hash) *Chain {
+	return &Chain{
+		Incorporated:    NewIncorporatedActions(0),
+		Credentials:     credentials,
+		LastCommitEpoch: 0,
+		LastCommitHash:  genesisHash,
+		CommitState:     genesis,
+		SealedBlocks:    map[uint64]*Block{0: {Epoch: 0, Hash: genesisHash}},
+		Candidates:      make(map[uint64]map[crypto.Hash]*Block),
+		RollingHash:     genesisHash,
+	}
+}
+
+// commited extends the rolling hash with a newly commited block and, at
+// checkpoint epochs, signs and persists a checkpoint of the chain.
+func (c *Chain) commited(block *Block) {
+	c.View = 0
+	c.live(block.Epoch, block.Proposer).Invalidated += uint64(len(block.Invalidate))
+	c.incorporate(block)
+	block.StateRoot = c.CommitState.Root()
+	c.RollingHash = RollingHash(c.RollingHash, block.Hash)
+	c.saveHead()
+	if !IsCheckpoint(block.Epoch) {
+		return
+	}
+	checkpoint := &Checkpoint{
+		Epoch:     block.Epoch,
+		BlockHash: block.Hash,
+		ChainHash: c.RollingHash,
+		StateHash: c.CommitState.Checksum(),
+	}
+	checkpoint.Sign(c.Credentials)
+	c.LastCheckpoint = checkpoint
+	if c.Checkpoints != nil {
+		if err := c.Checkpoints.Append(checkpoint); err != nil {
+			log.Printf("chain: %v", err)
+		}
+	}
+	c.compactIncorporated()
+}
+
+// incorporate registers the valid actions of a commited block so that they
+// cannot be incorporated again within their validity window.
+func (c *Chain) incorporate(block *Block) {
+	invalidated := make(map[crypto.Hash]struct{})
+	for _, hash := range block.Invalidate {
+		invalidated[hash] = struct{}{}
+	}
+	hashes := make([]crypto.Hash, 0, len(block.Actions))
+	epochs := make([]uint64, 0, len(block.Actions))
+	for _, action := range block.Actions {
+		hash := crypto.Hasher(action)
+		if _, ok := invalidated[hash]; !ok {
+			epoch := actions.GetEpochFromByteArray(action)
+			c.Incorporated.Append(hash, epoch, block.Epoch)
+			hashes = append(hashes, hash)
+			epochs = append(epochs, epoch)
+		}
+	}
+	for c.Incorporated.CurrentEpoch < block.Epoch {
+		c.Incorporated.MoveForward()
+	}
+	if c.IncorporatedLog != nil {
+		if err := c.IncorporatedLog.Append(block.Epoch, hashes, epochs); err != nil {
+			log.Printf("chain: %v", err)
+		}
+	}
+}
+
+// revalidate validates the actions of a block to be commited against the
+// given validator. Actions failing validation or already incorporated by the
+// chain are invalidated. Repetitions of an action on the block are skipped.
+func (c *Chain) revalidate(block *Block, validator MutatingState) {
+	block.Invalidate = make([]crypto.Hash, 0)
+	seen := make(map[crypto.Hash]struct{})
+	for _, action := range block.Actions {
+		hash := crypto.Hasher(action)
+		if _, repeated := seen[hash]; repeated {
+			continue
+		}
+		seen[hash] = struct{}{}
+		if !c.Incorporated.IsNew(hash, actions.GetEpochFromByteArray(action), c.LastCommitEpoch) || !validator.Validate(action) {
+			block.Invalidate = append(block.Invalidate, hash)
+		}
+	}
+	block.Validator = validator
+}
+
+// pending returns true if the action with the given hash is on the live block
+// or on a sealed block not yet commited the live block builds upon.
+func (c *Chain) pending(hash crypto.Hash) bool {
+	if c.LiveBlock.Includes(hash) {
+		return true
+	}
+	for epoch := c.LastCommitEpoch + 1; epoch <= c.LiveBlock.CheckPoint; epoch++ {
+		if block, ok := c.SealedBlocks[epoch]; ok && block.Includes(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Chain) saveHead() {
+	if c.Head == nil {
+		return
+	}
+	if err := c.Head.Save(c); err != nil {
+		log.Printf("chain: %v", err)
+	}
+}
+
+// compactIncorporated discards from the persisted incorporated actions those
+// no longer within their validity window or discarded by a recovery.
+func (c *Chain) compactIncorporated() {
+	if c.IncorporatedLog == nil {
+		return
+	}
+	if err := c.IncorporatedLog.Compact(c.Incorporated); err != nil {
+		log.Printf("chain: %v", err)
+	}
 }
 
 func (c *Chain) NewBlock(epoch, checkpoint uint64, publisher crypto.Token) (*Block, error) {
@@ -71,32 +216,40 @@ func (c *Chain) NewBlock(epoch, checkpoint uint64, publisher crypto.Token) (*Blo
 	if !ok {
 		return nil, errors.New("cannot find referred checkpoint")
 	}
-	mutations := c.CommitState.NewMutations()
-	if parent.Epoch >= c.LastCommitEpoch {
-		mutations = mutations.Append([]Mutations{parent.Validator.Mutations()})
-	}
 	return &Block{
 		Epoch:          epoch,
 		CheckPoint:     checkpoint,
 		CheckpointHash: parent.Hash,
 		Proposer:       publisher,
 		Actions:        make([][]byte, 0),
-		Validator:      c.CommitState.Validator(mutations, checkpoint),
+		Validator:      c.validator(parent, epoch),
 	}, nil
 }
 
+// validator returns the validator for a block of the given epoch building upon
+// parent.
+func (c *Chain) validator(parent *Block, epoch uint64) MutatingState {
+	mutations := c.CommitState.NewMutations()
+	if parent.Epoch > c.LastCommitEpoch {
+		mutations = mutations.Append([]Mutations{parent.Validator.Mutations()})
+	}
+	return c.CommitState.Validator(mutations, epoch)
+}
+
 func (c *Chain) CommitNextBlock() bool {
 	block, ok := c.SealedBlocks[c.LastCommitEpoch+1]
 	if !ok {
 		return false
 	}
 	if block.CheckPoint != c.LastCommitEpoch {
-		validator := c.CommitState.Validator(nil, c.LastCommitEpoch)
-		block.Revalidate(validator)
+		validator := c.CommitState.Validator(c.CommitState.NewMutations(), block.Epoch)
+		c.revalidate(block, validator)
 	}
 	c.CommitState.Incorporate(block.Validator, block.Proposer)
 	c.LastCommitEpoch = block.Epoch
 	c.LastCommitHash = block.Hash
+	c.commited(block)
+	c.prune()
 	return true
 }
 
@@ -106,7 +259,7 @@ func (c *Chain) Validate(action []byte) bool {
 		return false
 	}
 	hash := crypto.Hasher(action)
-	if !c.Incorporated.IsNew(hash, epoch, c.LiveBlock.CheckPoint) {
+	if !c.Incorporated.IsNew(hash, epoch, c.LiveBlock.CheckPoint) || c.pending(hash) {
 		return false
 	}
 	return c.LiveBlock.Validate(action)
@@ -117,76 +270,160 @@ func (c *Chain) NextBlock(epoch, checkpoint uint64, checkpointHash crypto.Hash,
 	if err != nil {
 		return err
 	}
+	if !liveBlock.CheckpointHash.Equal(checkpointHash) {
+		return errors.New("checkpoint hash does not match")
+	}
 	c.LiveBlock = liveBlock
+	c.live(epoch, publisher).Proposed += 1
 	return nil
 
 }
 
-func (c *Chain) SealOwnBlock() {
-	c.LiveBlock.Seal(c.Credentials)
+// SealOwnBlock seals the live block with the chain credentials and moves it
+// to the candidates of its epoch. It returns the sealed block or nil if there is no live
+// block.
+func (c *Chain) SealOwnBlock() *Block {
+	if c.LiveBlock == nil {
+		return nil
+	}
+	block := c.LiveBlock
+	if c.Clock != nil {
+		block.SealAt(c.Clock(), c.Credentials)
+	} else {
+		block.Seal(c.Credentials)
+	}
+	c.LiveBlock = nil
+	c.live(block.Epoch, block.Proposer).Sealed += 1
+	c.candidate(block)
+	c.choose(nil)
+	return block
 }
 
+// SealBlock seals the live block with the hash and signature published by its
+// proposer. The hash is recomputed from the actions of the live block and the
+// signature verified against the proposer token. A seal failing either check
+// is rejected with a *SealError and the live block is kept unsealed.
 func (c *Chain) SealBlock(publishedAt time.Time, fees uint64, hash crypto.Hash, signature crypto.Signature) error {
 	if c.LiveBlock == nil {
 		return errors.New("no live block to be sealed")
 	}
-	c.LiveBlock.ProposedAt = publishedAt
-	c.LiveBlock.Hash = hash
-	c.LiveBlock.SealSignature = signature
-	c.SealedBlocks[c.LiveBlock.Epoch] = c.LiveBlock
+	block := c.LiveBlock
+	if !block.Proposer.Verify(hash[:], signature) {
+		return &SealError{Epoch: block.Epoch, Hash: hash, Err: ErrInvalidSealSignature}
+	}
+	proposedAt := block.ProposedAt
+	block.ProposedAt = publishedAt
+	expected := block.sealHash()
+	if !expected.Equal(hash) {
+		block.ProposedAt = proposedAt
+		return &SealError{Epoch: block.Epoch, Hash: hash, Expected: expected, Err: ErrDivergentSeal}
+	}
+	block.Hash = hash
+	block.SealSignature = signature
 	c.LiveBlock = nil
-	// todo check hash and signature?
+	c.live(block.Epoch, block.Proposer).Sealed += 1
+	c.candidate(block)
+	c.choose(nil)
 	return nil
 }
 
-func (c *Chain) CommitOwnBlock() error {
+// PrepareCommit revalidates the sealed block with the given epoch and hash
+// against the commited state, as its commit would, and sets its previous hash,
+// its invalidated actions and the state root after its commit. Validators vote
+// on the CommitHash of the prepared block. Only the block subsequent to the
+// last commit can be prepared.
+func (c *Chain) PrepareCommit(epoch uint64, hash crypto.Hash) (*Block, error) {
+	if epoch != c.LastCommitEpoch+1 {
+		return nil, errors.New("not a subsequent commit")
+	}
+	block, ok := c.Candidates[epoch][hash]
+	if !ok {
+		return nil, errors.New("no sealed block with the given hash")
+	}
+	c.prepare(block)
+	return block, nil
+}
+
+func (c *Chain) prepare(block *Block) {
+	validator := c.CommitState.Validator(c.CommitState.NewMutations(), block.Epoch)
+	c.revalidate(block, validator)
+	block.PreviousHash = c.LastCommitHash
+	block.StateRoot = c.CommitState.RootAfter(validator, block.Proposer)
+}
+
+// CommitOwnBlock commits the sealed block subsequent to the last commit. If
+// the chain has a committee the certificate must certify the outcome of the
+// commit.
+func (c *Chain) CommitOwnBlock(certificate *QuorumCertificate) error {
 	nextCommit := c.LastCommitEpoch + 1
 	block, ok := c.SealedBlocks[nextCommit]
 	if !ok {
 		return errors.New("no sealed block")
 	}
-	validator := c.CommitState.Validator(nil, c.LastCommitEpoch)
-	block.Revalidate(validator)
-	c.CommitState.Incorporate(validator, block.Proposer)
-	block.PreviousHash = c.LastCommitHash
+	c.prepare(block)
+	if c.Committee != nil && !certificate.Certifies(block.Epoch, block.Hash, block.CommitHash(), c.Committee) {
+		return errors.New("commit without a valid quorum certificate")
+	}
+	c.CommitState.Incorporate(block.Validator, block.Proposer)
+	block.Certificate = certificate
 	c.LastCommitEpoch += 1
 	c.LastCommitHash = block.Hash
+	c.commited(block)
 	delete(c.SealedBlocks, nextCommit-KeepLastN)
+	c.prune()
 	return nil
 }
 
-func (c *Chain) CommitBlock(epoch uint64, blockhash crypto.Hash, previousblockhash crypto.Hash, invalidated []crypto.Hash) error {
+// CommitBlock commits the sealed block of the given epoch and hash with the
+// outcome published by its proposer. If the chain has a committee the
+// certificate must certify the outcome and the state root after the commit
+// must match the certified root.
+func (c *Chain) CommitBlock(epoch uint64, blockhash crypto.Hash, previousblockhash crypto.Hash, invalidated []crypto.Hash, root crypto.Hash, certificate *QuorumCertificate) error {
 	if epoch != c.LastCommitEpoch+1 {
 		return errors.New("not a subsequent commit")
 	}
+	if c.Committee != nil && !certificate.Certifies(epoch, blockhash, CommitHash(previousblockhash, invalidated, root), c.Committee) {
+		return errors.New("commit without a valid quorum certificate")
+	}
 	if c.LastCommitHash != previousblockhash {
 		return errors.New("previous hash does not match")
 	}
 	block, ok := c.SealedBlocks[epoch]
-	if !ok {
-		return errors.New("could not find sealed block")
-	}
-	if !block.Hash.Equal(blockhash) {
-		return errors.New("hash does not match")
+	if !ok || !block.Hash.Equal(blockhash) {
+		// the commit settles the fork in favour of another candidate
+		if err := c.ChooseBlock(epoch, blockhash); err != nil {
+			return err
+		}
+		block = c.SealedBlocks[epoch]
 	}
 	exclude := make(map[crypto.Hash]struct{})
 	for _, hash := range invalidated {
 		exclude[hash] = struct{}{}
 	}
-	validator := c.CommitState.Validator(nil, c.LastCommitEpoch)
+	validator := c.CommitState.Validator(c.CommitState.NewMutations(), block.Epoch)
+	// repetitions and replays are skipped as in revalidate
+	seen := make(map[crypto.Hash]struct{})
 	for _, action := range block.Actions {
 		hash := crypto.Hasher(action)
-		if _, ok := exclude[hash]; !ok {
+		_, excluded := exclude[hash]
+		_, repeated := seen[hash]
+		seen[hash] = struct{}{}
+		if !excluded && !repeated && c.Incorporated.IsNew(hash, actions.GetEpochFromByteArray(action), c.LastCommitEpoch) {
 			validator.Validate(action)
 		}
 	}
+	if c.Committee != nil && !c.CommitState.RootAfter(validator, block.Proposer).Equal(root) {
+		return errors.New("state root does not match the certified root")
+	}
 	c.CommitState.Incorporate(validator, block.Proposer)
 	block.PreviousHash = previousblockhash
 	block.Invalidate = invalidated
+	block.Certificate = certificate
 	c.LastCommitEpoch += 1
 	c.LastCommitHash = blockhash
+	c.commited(block)
 	delete(c.SealedBlocks, epoch-KeepLastN)
-
+	c.prune()
 	return nil
 }
 
@@ -209,12 +446,87 @@ func (c *Chain) RolloverBlock(epoch uint64) error {
 	for _, blockEpoch := range epochsAfter {
 		delete(c.SealedBlocks, blockEpoch)
 	}
-	if c.LiveBlock.Epoch > epoch {
+	for blockEpoch := range c.Candidates {
+		if blockEpoch > epoch {
+			delete(c.Candidates, blockEpoch)
+		}
+	}
+	if c.LiveBlock != nil && c.LiveBlock.Epoch > epoch {
 		c.LiveBlock = nil
 	}
 	return nil
 }
 
+// Certify records a certificate of the last checkpoint signed by a quorum of
+// the committee. Certificates of earlier checkpoints are refused.
+func (c *Chain) Certify(certificate *CheckpointCertificate) error {
+	if c.Committee == nil || !certificate.Certifies(c.LastCheckpoint, c.Committee) {
+		return errors.New("certificate is not a quorum on the last checkpoint")
+	}
+	if c.Certified != nil && c.Certified.Epoch > certificate.Epoch {
+		return errors.New("certificate of a checkpoint before the last certified one")
+	}
+	c.Certified = certificate
+	return nil
+}
+
+// Recover is the disaster recovery mechanism. It restores the state commited
+// at the last checkpoint and discards every block after it, commited or not.
+// The recovery must be decided by a quorum of the committee on the last
+// checkpoint, which every requesting validator certified, so that the chain is
+// never restored below a checkpoint the network agreed on. A decision to
+// recover to a checkpoint the chain already recovered to is refused, so that
+// replayed decisions do not discard blocks commited since.
+func (c *Chain) Recover(decision *RecoveryCertificate) error {
+	checkpoint := c.LastCheckpoint
+	if checkpoint == nil {
+		return errors.New("no checkpoint to recover to")
+	}
+	if c.Committee == nil || !decision.Verify(c.Committee) {
+		return errors.New("recovery is not decided by a quorum")
+	}
+	if decision.Epoch != checkpoint.Epoch || !decision.Checkpoint.Equal(checkpoint.Hash()) {
+		return errors.New("recovery to a checkpoint other than the last one")
+	}
+	if checkpoint.Epoch <= c.Recovered {
+		return errors.New("chain already recovered to the checkpoint")
+	}
+	if err := c.CommitState.Rollback(checkpoint.Epoch); err != nil {
+		return err
+	}
+	if !c.CommitState.Checksum().Equal(checkpoint.StateHash) {
+		return errors.New("restored state does not match checkpoint")
+	}
+	c.Recovered = checkpoint.Epoch
+	c.LastCommitEpoch = checkpoint.Epoch
+	c.LastCommitHash = checkpoint.BlockHash
+	c.RollingHash = checkpoint.ChainHash
+	c.Incorporated.Rollback(checkpoint.Epoch)
+	c.compactIncorporated()
+	c.saveHead()
+	c.LiveBlock = nil
+	c.View = 0
+	c.Candidates = nil
+	for epoch := range c.SealedBlocks {
+		if epoch > checkpoint.Epoch {
+			delete(c.SealedBlocks, epoch)
+		}
+	}
+	if _, ok := c.SealedBlocks[checkpoint.Epoch]; !ok {
+		c.SealedBlocks[checkpoint.Epoch] = &Block{Epoch: checkpoint.Epoch, Hash: checkpoint.BlockHash}
+	}
+	return nil
+}
+
 func (c *Chain) Shutdown() {
 	c.CommitState.Shutdown()
+	if c.Checkpoints != nil {
+		c.Checkpoints.Close()
+	}
+	if c.Head != nil {
+		c.Head.Close()
+	}
+	if c.IncorporatedLog != nil {
+		c.IncorporatedLog.Close()
+	}
 }
@@ -0,0 +1,255 @@
+package chain
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// CheckpointInterval is the number of epochs between checkpoints. With the
+// standard block interval of one second it amounts to 15 minutes.
+const CheckpointInterval = 900
+
+func IsCheckpoint(epoch uint64) bool {
+	return epoch > 0 && epoch%CheckpointInterval == 0
+}
+
+// CheckpointWindow returns the checkpoint window of an epoch. Window n spans
+// the epochs from checkpoint n up to the epoch before the next checkpoint, so
+// that the commit of a checkpoint closes the preceding window.
+func CheckpointWindow(epoch uint64) uint64 {
+	return epoch / CheckpointInterval
+}
+
+// Checkpoint is a digest of the chain at a checkpoint epoch. ChainHash is the
+// rolling hash of every commited block hash up to the epoch and StateHash the
+// checksum of the state after the commit of the block of the epoch. Two nodes
+// with matching checkpoints agree on the entire history up to the epoch.
+type Checkpoint struct {
+	Epoch     uint64
+	BlockHash crypto.Hash
+	ChainHash crypto.Hash
+	StateHash crypto.Hash
+	Signer    crypto.Token
+	Signature crypto.Signature
+}
+
+func (c *Checkpoint) serializeForSign() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(c.Epoch, &bytes)
+	util.PutHash(c.BlockHash, &bytes)
+	util.PutHash(c.ChainHash, &bytes)
+	util.PutHash(c.StateHash, &bytes)
+	return bytes
+}
+
+// Hash of the checkpoint contents, regardless of the signer.
+func (c *Checkpoint) Hash() crypto.Hash {
+	return crypto.Hasher(c.serializeForSign())
+}
+
+// Matches checks if another checkpoint is for the same epoch with the same
+// contents.
+func (c *Checkpoint) Matches(another *Checkpoint) bool {
+	return another != nil && c.Hash().Equal(another.Hash())
+}
+
+func (c *Checkpoint) Sign(credentials crypto.PrivateKey) {
+	c.Signer = credentials.PublicKey()
+	hash := c.Hash()
+	c.Signature = credentials.Sign(hash[:])
+}
+
+func (c *Checkpoint) Serialize() []byte {
+	bytes := c.serializeForSign()
+	util.PutToken(c.Signer, &bytes)
+	util.PutSignature(c.Signature, &bytes)
+	return bytes
+}
+
+func ParseCheckpoint(data []byte) *Checkpoint {
+	position := 0
+	var checkpoint Checkpoint
+	checkpoint.Epoch, position = util.ParseUint64(data, position)
+	checkpoint.BlockHash, position = util.ParseHash(data, position)
+	checkpoint.ChainHash, position = util.ParseHash(data, position)
+	checkpoint.StateHash, position = util.ParseHash(data, position)
+	checkpoint.Signer, position = util.ParseToken(data, position)
+	checkpoint.Signature, position = util.ParseSignature(data, position)
+	if position != len(data) {
+		return nil
+	}
+	hash := checkpoint.Hash()
+	if !checkpoint.Signer.Verify(hash[:], checkpoint.Signature) {
+		return nil
+	}
+	return &checkpoint
+}
+
+// checkpointSize is the size of a serialized checkpoint.
+const checkpointSize = 8 + 3*crypto.Size + crypto.TokenSize + crypto.SignatureSize
+
+// CheckpointCertificate aggregates checkpoints of validators with the same
+// contents. A certificate signed by more than two thirds of the committee of
+// the checkpoint epoch is a proof that the network agreed on the history up to
+// the checkpoint.
+type CheckpointCertificate struct {
+	Epoch       uint64
+	Hash        crypto.Hash // hash of the checkpoint contents
+	Checkpoints []*Checkpoint
+}
+
+func NewCheckpointCertificate(checkpoint *Checkpoint) *CheckpointCertificate {
+	return &CheckpointCertificate{
+		Epoch:       checkpoint.Epoch,
+		Hash:        checkpoint.Hash(),
+		Checkpoints: []*Checkpoint{checkpoint},
+	}
+}
+
+// Append incorporates a validly signed checkpoint with the certified contents.
+// Repeated checkpoints of the same signer are ignored.
+func (q *CheckpointCertificate) Append(checkpoint *Checkpoint) bool {
+	hash := checkpoint.Hash()
+	if checkpoint.Epoch != q.Epoch || !hash.Equal(q.Hash) {
+		return false
+	}
+	for _, existing := range q.Checkpoints {
+		if existing.Signer.Equal(checkpoint.Signer) {
+			return false
+		}
+	}
+	if !checkpoint.Signer.Verify(hash[:], checkpoint.Signature) {
+		return false
+	}
+	q.Checkpoints = append(q.Checkpoints, checkpoint)
+	return true
+}
+
+// Verify checks if the certificate holds valid checkpoints of more than two
+// thirds of the members of the committee. It is safe to call on a nil
+// certificate.
+func (q *CheckpointCertificate) Verify(committee Committee) bool {
+	if q == nil || committee == nil {
+		return false
+	}
+	members := committee.Members(q.Epoch)
+	if len(members) == 0 {
+		return false
+	}
+	signed := make(map[crypto.Token]struct{})
+	for _, checkpoint := range q.Checkpoints {
+		hash := checkpoint.Hash()
+		if checkpoint.Epoch != q.Epoch || !hash.Equal(q.Hash) {
+			return false
+		}
+		if checkpoint.Signer.Verify(hash[:], checkpoint.Signature) {
+			signed[checkpoint.Signer] = struct{}{}
+		}
+	}
+	return hasQuorum(members, signed)
+}
+
+// Certifies checks if the certificate is a valid proof of agreement on the
+// given checkpoint.
+func (q *CheckpointCertificate) Certifies(checkpoint *Checkpoint, committee Committee) bool {
+	if q == nil || checkpoint == nil || q.Epoch != checkpoint.Epoch || !q.Hash.Equal(checkpoint.Hash()) {
+		return false
+	}
+	return q.Verify(committee)
+}
+
+func (q *CheckpointCertificate) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint32(uint32(len(q.Checkpoints)), &bytes)
+	for _, checkpoint := range q.Checkpoints {
+		bytes = append(bytes, checkpoint.Serialize()...)
+	}
+	return bytes
+}
+
+// ParseCheckpointCertificate parses a certificate. Epoch and hash are those
+// of its first checkpoint.
+func ParseCheckpointCertificate(data []byte) *CheckpointCertificate {
+	count, position := util.ParseUint32(data, 0)
+	if count == 0 || position+int(count)*checkpointSize != len(data) {
+		return nil
+	}
+	certificate := CheckpointCertificate{Checkpoints: make([]*Checkpoint, 0, int(count))}
+	for n := 0; n < int(count); n++ {
+		checkpoint := ParseCheckpoint(data[position : position+checkpointSize])
+		if checkpoint == nil {
+			return nil
+		}
+		certificate.Checkpoints = append(certificate.Checkpoints, checkpoint)
+		position += checkpointSize
+	}
+	certificate.Epoch = certificate.Checkpoints[0].Epoch
+	certificate.Hash = certificate.Checkpoints[0].Hash()
+	return &certificate
+}
+
+// RollingHash returns the hash of the sequence of commited blocks extended by
+// a new commited block hash.
+func RollingHash(previous, block crypto.Hash) crypto.Hash {
+	return crypto.Hasher(append(previous[:], block[:]...))
+}
+
+// CheckpointLog persists checkpoints sequentially on a file so that operators
+// can compare nodes.
+type CheckpointLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func OpenCheckpointLog(filePath string) (*CheckpointLog, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open checkpoint log: %v", err)
+	}
+	return &CheckpointLog{file: file}, nil
+}
+
+func (l *CheckpointLog) Append(checkpoint *Checkpoint) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data := checkpoint.Serialize()
+	bytes := make([]byte, 0, len(data)+4)
+	util.PutUint32(uint32(len(data)), &bytes)
+	bytes = append(bytes, data...)
+	if n, err := l.file.Write(bytes); n != len(bytes) {
+		return fmt.Errorf("could not persist checkpoint: %v", err)
+	}
+	return nil
+}
+
+// All returns every checkpoint on the log in the order they were appended.
+func (l *CheckpointLog) All() ([]*Checkpoint, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := os.ReadFile(l.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := make([]*Checkpoint, 0)
+	position := 0
+	for position+4 <= len(data) {
+		var size uint32
+		size, position = util.ParseUint32(data, position)
+		if position+int(size) > len(data) {
+			return checkpoints, fmt.Errorf("truncated checkpoint log")
+		}
+		if checkpoint := ParseCheckpoint(data[position : position+int(size)]); checkpoint != nil {
+			checkpoints = append(checkpoints, checkpoint)
+		}
+		position += int(size)
+	}
+	return checkpoints, nil
+}
+
+func (l *CheckpointLog) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,121 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestCheckpointCertificate(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	committee := make(StaticCommittee, 4)
+	for n := range keys {
+		committee[n], keys[n] = crypto.RandomAsymetricKey()
+	}
+	contents := Checkpoint{
+		Epoch:     CheckpointInterval,
+		BlockHash: crypto.Hasher([]byte("block")),
+		ChainHash: crypto.Hasher([]byte("chain")),
+		StateHash: crypto.Hasher([]byte("state")),
+	}
+	signed := func(key crypto.PrivateKey) *Checkpoint {
+		checkpoint := contents
+		checkpoint.Sign(key)
+		return &checkpoint
+	}
+	blockchain := &Chain{LastCheckpoint: signed(keys[0]), Committee: committee}
+	if _, err := blockchain.RecoveryRequest(); err == nil {
+		t.Fatal("recovery requested to a checkpoint without certificate")
+	}
+	certificate := NewCheckpointCertificate(blockchain.LastCheckpoint)
+	if blockchain.Certify(certificate) == nil {
+		t.Error("checkpoint certified by a single signature")
+	}
+	diverging := contents
+	diverging.StateHash = crypto.Hasher([]byte("another state"))
+	diverging.Sign(keys[1])
+	if certificate.Append(&diverging) {
+		t.Error("diverging checkpoint appended")
+	}
+	if certificate.Append(signed(keys[0])) {
+		t.Error("repeated signer appended")
+	}
+	for n := 1; n < 3; n++ {
+		if !certificate.Append(signed(keys[n])) {
+			t.Fatal("matching checkpoint not appended")
+		}
+	}
+	parsed := ParseCheckpointCertificate(certificate.Serialize())
+	if parsed == nil || !parsed.Certifies(blockchain.LastCheckpoint, committee) {
+		t.Fatal("checkpoint certificate serialization failed")
+	}
+	if err := blockchain.Certify(parsed); err != nil {
+		t.Fatalf("certificate with three of four signatures refused: %v", err)
+	}
+	if parsed.Verify(nil) {
+		t.Error("certificate verified without a committee")
+	}
+}
+
+func TestRecoveryDecision(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	committee := make(StaticCommittee, 4)
+	for n := range keys {
+		committee[n], keys[n] = crypto.RandomAsymetricKey()
+	}
+	checkpoint := &Checkpoint{Epoch: CheckpointInterval, BlockHash: crypto.Hasher([]byte("block"))}
+	checkpoint.Sign(keys[0])
+	certificate := NewCheckpointCertificate(checkpoint)
+	for n := 1; n < 3; n++ {
+		another := *checkpoint
+		another.Sign(keys[n])
+		certificate.Append(&another)
+	}
+	blockchain := NewChainFromGenesis(keys[0], &epochState{epoch: CheckpointInterval + 5}, crypto.ZeroHash)
+	blockchain.LastCommitEpoch = CheckpointInterval + 5
+	blockchain.LastCheckpoint = checkpoint
+	blockchain.Committee = committee
+	if err := blockchain.Certify(certificate); err != nil {
+		t.Fatal(err)
+	}
+
+	// a checkpoint certificate is no decision to recover
+	if blockchain.Recover(NewRecoveryCertificate(certificate.Epoch, certificate.Hash)) == nil {
+		t.Fatal("recovered without requests")
+	}
+	decision := NewRecoveryCertificate(checkpoint.Epoch, checkpoint.Hash())
+	for n := 0; n < 2; n++ {
+		blockchain.Credentials = keys[n]
+		request, err := blockchain.RecoveryRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision.Append(request)
+	}
+	if blockchain.Recover(decision) == nil {
+		t.Fatal("recovered without a quorum")
+	}
+	blockchain.Credentials = keys[2]
+	request, _ := blockchain.RecoveryRequest()
+	if !decision.Append(request) {
+		t.Fatal("recovery request not appended")
+	}
+	other := NewRecoveryCertificate(checkpoint.Epoch, crypto.Hasher([]byte("other")))
+	for _, key := range keys {
+		other.Append(&RecoveryRequest{Epoch: checkpoint.Epoch, Checkpoint: other.Checkpoint, Token: key.PublicKey(), Signature: key.Sign(recoveryMessage(checkpoint.Epoch, other.Checkpoint))})
+	}
+	if blockchain.Recover(other) == nil {
+		t.Fatal("recovered to a checkpoint other than the last one")
+	}
+	parsed := ParseRecoveryCertificate(decision.Serialize())
+	if err := blockchain.Recover(parsed); err != nil {
+		t.Fatalf("recovery decided by a quorum refused: %v", err)
+	}
+	if blockchain.LastCommitEpoch != CheckpointInterval || blockchain.Recovered != CheckpointInterval {
+		t.Fatalf("chain not restored to the checkpoint: %v", blockchain.LastCommitEpoch)
+	}
+	blockchain.LastCommitEpoch = CheckpointInterval + 3
+	if blockchain.Recover(parsed) == nil {
+		t.Fatal("replayed recovery decision accepted")
+	}
+}
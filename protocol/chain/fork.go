@@ -0,0 +1,235 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+// Competing proposals for the same epoch are kept by the chain as candidates
+// keyed by their hash. A candidate builds upon the block of its checkpoint,
+// either commited or itself a candidate. A branch is a sequence of candidates,
+// at most one for each epoch after the last commit, each of them building
+// upon a block of the branch or upon a commited block. The chain follows the
+// branch preferred by its fork choice rule: SealedBlocks holds the commited
+// blocks and the blocks of the chosen branch.
+
+// Branch is a sequence of candidates ordered by epoch.
+type Branch []*Block
+
+// At returns the block of the branch for the given epoch, or nil if there is
+// none.
+func (b Branch) At(epoch uint64) *Block {
+	n := sort.Search(len(b), func(n int) bool { return b[n].Epoch >= epoch })
+	if n < len(b) && b[n].Epoch == epoch {
+		return b[n]
+	}
+	return nil
+}
+
+// ForkChoice is the rule by which the chain picks among competing branches.
+// Prefer returns true if branch a is to be followed instead of branch b.
+type ForkChoice interface {
+	Prefer(a, b Branch) bool
+}
+
+// LongestBranch is the default fork choice rule. It prefers the branch with
+// more blocks. Among branches of the same length it prefers the one with the
+// lowest block hash on the first epoch they diverge, so that every node
+// reaches the same choice.
+type LongestBranch struct{}
+
+func (LongestBranch) Prefer(a, b Branch) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	for n := range a {
+		if !a[n].Hash.Equal(b[n].Hash) {
+			return bytes.Compare(a[n].Hash[:], b[n].Hash[:]) < 0
+		}
+	}
+	return false
+}
+
+// AddCandidate incorporates a sealed block competing with the blocks of the
+// chain. The block must be sealed by its proposer, carry every action of its
+// actions root and build upon a known block. Its actions are validated against
+// the state derived at its checkpoint. The fork choice rule is then applied
+// and the chain might rollback to another branch.
+func (c *Chain) AddCandidate(block *Block) error {
+	if block.Epoch <= c.LastCommitEpoch {
+		return errors.New("cannot replace commited block outside recovery mode")
+	}
+	if block.CheckPoint >= block.Epoch {
+		return errors.New("checkpoint not prior to block epoch")
+	}
+	if !block.VerifySeal() || !ActionsRoot(block.Actions).Equal(block.ActionsRoot) {
+		return errors.New("invalid block seal")
+	}
+	if _, ok := c.Candidates[block.Epoch][block.Hash]; ok {
+		return nil
+	}
+	parent := c.parent(block)
+	if parent == nil {
+		return errors.New("cannot find referred checkpoint")
+	}
+	validator := c.validator(parent, block.Epoch)
+	for _, action := range block.Actions {
+		validator.Validate(action)
+	}
+	block.Validator = validator
+	c.candidate(block)
+	c.choose(nil)
+	return nil
+}
+
+// ChooseBlock rolls the chain back to a branch with the candidate of the given
+// epoch and hash. Competing candidates for the epoch are discarded once the
+// chain follows the chosen one, and are kept if it cannot.
+func (c *Chain) ChooseBlock(epoch uint64, hash crypto.Hash) error {
+	block, ok := c.Candidates[epoch][hash]
+	if !ok {
+		return errors.New("could not find candidate block")
+	}
+	if !c.choose(block) {
+		return errors.New("candidate block on no branch of the chain")
+	}
+	for other := range c.Candidates[epoch] {
+		if !other.Equal(hash) {
+			delete(c.Candidates[epoch], other)
+		}
+	}
+	return nil
+}
+
+// candidate stores a sealed block as a candidate for its epoch.
+func (c *Chain) candidate(block *Block) {
+	if c.Candidates == nil {
+		c.Candidates = make(map[uint64]map[crypto.Hash]*Block)
+	}
+	if _, ok := c.Candidates[block.Epoch]; !ok {
+		c.Candidates[block.Epoch] = make(map[crypto.Hash]*Block)
+	}
+	c.Candidates[block.Epoch][block.Hash] = block
+}
+
+// parent returns the block of the checkpoint of the given block, or nil if it
+// is neither commited nor a candidate.
+func (c *Chain) parent(block *Block) *Block {
+	if block.CheckPoint <= c.LastCommitEpoch {
+		if commited, ok := c.SealedBlocks[block.CheckPoint]; ok && commited.Hash.Equal(block.CheckpointHash) {
+			return commited
+		}
+		return nil
+	}
+	return c.Candidates[block.CheckPoint][block.CheckpointHash]
+}
+
+// fits returns true if the block builds upon the given branch.
+func (c *Chain) fits(block *Block, branch Branch) bool {
+	if block.CheckPoint <= c.LastCommitEpoch {
+		return c.parent(block) != nil
+	}
+	parent := branch.At(block.CheckPoint)
+	return parent != nil && parent.Hash.Equal(block.CheckpointHash)
+}
+
+// candidateEpochs returns the epochs after the last commit with candidates,
+// in ascending order.
+func (c *Chain) candidateEpochs() []uint64 {
+	epochs := make([]uint64, 0, len(c.Candidates))
+	for epoch := range c.Candidates {
+		if epoch > c.LastCommitEpoch {
+			epochs = append(epochs, epoch)
+		}
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	return epochs
+}
+
+// branches returns every branch that cannot be extended by another candidate.
+// Branches are enumerated exhaustively, which is fine for the handful of
+// candidates per epoch expected between commits.
+func (c *Chain) branches() []Branch {
+	epochs := c.candidateEpochs()
+	all := make([]Branch, 0)
+	var extend func(n int, branch Branch)
+	extend = func(n int, branch Branch) {
+		if n == len(epochs) {
+			all = append(all, branch)
+			return
+		}
+		extended := false
+		for _, block := range c.Candidates[epochs[n]] {
+			if c.fits(block, branch) {
+				extend(n+1, append(branch[:len(branch):len(branch)], block))
+				extended = true
+			}
+		}
+		if !extended {
+			extend(n+1, branch)
+		}
+	}
+	extend(0, make(Branch, 0))
+	return all
+}
+
+// choose applies the fork choice rule to the branches with the given block,
+// or to every branch if block is nil, and rolls the chain back to the chosen
+// branch. The live block is discarded if its checkpoint is not on the chosen
+// branch. It returns false if no branch qualifies.
+func (c *Chain) choose(block *Block) bool {
+	rule := c.ForkChoice
+	if rule == nil {
+		rule = LongestBranch{}
+	}
+	var chosen Branch
+	for _, branch := range c.branches() {
+		if block != nil && branch.At(block.Epoch) != block {
+			continue
+		}
+		if chosen == nil || rule.Prefer(branch, chosen) {
+			chosen = branch
+		}
+	}
+	if chosen == nil {
+		return false
+	}
+	for epoch := range c.SealedBlocks {
+		if epoch > c.LastCommitEpoch {
+			delete(c.SealedBlocks, epoch)
+		}
+	}
+	for _, block := range chosen {
+		c.SealedBlocks[block.Epoch] = block
+	}
+	if c.LiveBlock != nil {
+		if parent, ok := c.SealedBlocks[c.LiveBlock.CheckPoint]; !ok || !parent.Hash.Equal(c.LiveBlock.CheckpointHash) {
+			c.LiveBlock = nil
+		}
+	}
+	return true
+}
+
+// prune discards candidates of commited epochs and candidates no longer
+// building upon a known block.
+func (c *Chain) prune() {
+	for epoch := range c.Candidates {
+		if epoch <= c.LastCommitEpoch {
+			delete(c.Candidates, epoch)
+		}
+	}
+	for _, epoch := range c.candidateEpochs() {
+		for hash, block := range c.Candidates[epoch] {
+			if c.parent(block) == nil {
+				delete(c.Candidates[epoch], hash)
+			}
+		}
+		if len(c.Candidates[epoch]) == 0 {
+			delete(c.Candidates, epoch)
+		}
+	}
+	c.choose(nil)
+}
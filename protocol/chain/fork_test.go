@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+// epochState is a state that accepts every action and only keeps track of the
+// epoch of the last incorporated block.
+type epochState struct {
+	epoch uint64
+}
+
+type epochMutations uint64
+
+func (m epochMutations) Append([]Mutations) Mutations { return m }
+
+func (m epochMutations) GetEpoch() uint64 { return uint64(m) }
+
+type epochValidator uint64
+
+func (v epochValidator) Validate(msg []byte) bool { return true }
+
+func (v epochValidator) Mutations() Mutations { return epochMutations(v) }
+
+func (v epochValidator) GetEpoch() uint64 { return uint64(v) }
+
+func (s *epochState) NewMutations() Mutations { return epochMutations(s.epoch + 1) }
+
+func (s *epochState) Validator(m Mutations, epoch uint64) MutatingState { return epochValidator(epoch) }
+
+func (s *epochState) Incorporate(v MutatingState, token crypto.Token) { s.epoch = v.GetEpoch() }
+
+func (s *epochState) Checksum() crypto.Hash { return crypto.ZeroValueHash }
+
+func (s *epochState) Root() crypto.Hash { return crypto.ZeroValueHash }
+
+func (s *epochState) RootAfter(v MutatingState, token crypto.Token) crypto.Hash {
+	return crypto.ZeroValueHash
+}
+
+func (s *epochState) Rollback(epoch uint64) error {
+	s.epoch = epoch
+	return nil
+}
+
+func (s *epochState) Shutdown() {}
+
+func TestForkChoice(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	genesis := crypto.Hasher([]byte("genesis"))
+	blockchain := NewChainFromGenesis(key, &epochState{}, genesis)
+	defer blockchain.Shutdown()
+	if err := blockchain.NextBlock(1, 0, genesis, token); err != nil {
+		t.Fatal(err)
+	}
+	own := blockchain.SealOwnBlock()
+
+	otherToken, otherKey := crypto.RandomAsymetricKey()
+	propose := func(epoch, checkpoint uint64, checkpointHash crypto.Hash) *Block {
+		block := &Block{Epoch: epoch, CheckPoint: checkpoint, CheckpointHash: checkpointHash, Proposer: otherToken}
+		block.Seal(otherKey)
+		return block
+	}
+	competing := propose(1, 0, genesis)
+	if err := blockchain.AddCandidate(competing); err != nil {
+		t.Fatal(err)
+	}
+	if len(blockchain.Candidates[1]) != 2 {
+		t.Fatalf("unexpected candidates: %v", len(blockchain.Candidates[1]))
+	}
+	lowest := LongestBranch{}.Prefer(Branch{competing}, Branch{own})
+	if chosen := blockchain.SealedBlocks[1]; chosen.Hash.Equal(competing.Hash) != lowest {
+		t.Fatal("tie not broken by lowest hash")
+	}
+
+	// a block on top of the other candidate makes its branch the longest
+	loser, winner := competing, own
+	if lowest {
+		loser, winner = own, competing
+	}
+	next := propose(2, 1, loser.Hash)
+	if err := blockchain.AddCandidate(next); err != nil {
+		t.Fatal(err)
+	}
+	if !blockchain.SealedBlocks[1].Hash.Equal(loser.Hash) || blockchain.SealedBlocks[2] != next {
+		t.Fatal("chain did not follow the longest branch")
+	}
+	if err := blockchain.AddCandidate(propose(3, 1, crypto.Hasher([]byte("unknown")))); err == nil {
+		t.Fatal("candidate upon unknown checkpoint accepted")
+	}
+	stray := propose(1, 0, crypto.Hasher([]byte("unknown")))
+	blockchain.candidate(stray)
+	if blockchain.ChooseBlock(1, stray.Hash) == nil || len(blockchain.Candidates[1]) != 3 || blockchain.SealedBlocks[2] != next {
+		t.Fatal("failed choice discarded competing candidates")
+	}
+	delete(blockchain.Candidates[1], stray.Hash)
+
+	// a commit of the shorter branch rolls the chain back to it
+	if err := blockchain.CommitBlock(1, winner.Hash, genesis, nil, crypto.ZeroValueHash, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !blockchain.LastCommitHash.Equal(winner.Hash) || len(blockchain.SealedBlocks) != 2 || len(blockchain.Candidates) != 0 {
+		t.Fatal("chain not rolled back to the commited branch")
+	}
+}
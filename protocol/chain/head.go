@@ -0,0 +1,131 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// HeadFile persists the last commited block of a chain, the rolling hash of
+// commited blocks up to it and the epoch of the last checkpoint the chain
+// recovered to, so that a node can resume the chain on restart.
+type HeadFile struct {
+	file *os.File
+}
+
+func (h *HeadFile) Save(c *Chain) error {
+	bytes := make([]byte, 0)
+	util.PutUint64(c.LastCommitEpoch, &bytes)
+	util.PutHash(c.LastCommitHash, &bytes)
+	util.PutHash(c.RollingHash, &bytes)
+	util.PutUint64(c.Recovered, &bytes)
+	if _, err := h.file.WriteAt(bytes, 0); err != nil {
+		return fmt.Errorf("could not persist chain head: %v", err)
+	}
+	return nil
+}
+
+func (h *HeadFile) load(c *Chain) error {
+	data, err := os.ReadFile(h.file.Name())
+	if err != nil {
+		return fmt.Errorf("could not read chain head: %v", err)
+	}
+	position := 0
+	c.LastCommitEpoch, position = util.ParseUint64(data, position)
+	c.LastCommitHash, position = util.ParseHash(data, position)
+	c.RollingHash, position = util.ParseHash(data, position)
+	c.Recovered, position = util.ParseUint64(data, position)
+	if position != len(data) {
+		return errors.New("corrupted chain head")
+	}
+	return nil
+}
+
+func (h *HeadFile) Close() error {
+	return h.file.Close()
+}
+
+// OpenChain resumes the chain persisted on filePath over its commited state.
+// If filePath holds no chain a new chain is started from genesis and persisted
+// there. With an empty filePath the chain is kept in memory. The head of the
+// chain, its checkpoints and the actions it incorporated are persisted on
+// filePath at every commit, so that a resumed chain keeps rejecting actions
+// incorporated within their validity window before the restart. A chain
+// imported from a snapshot knows no action incorporated before the snapshot.
+func OpenChain(credentials crypto.PrivateKey, commitState State, genesisHash crypto.Hash, filePath string) (*Chain, error) {
+	c := NewChainFromGenesis(credentials, commitState, genesisHash)
+	if filePath == "" {
+		return c, nil
+	}
+	headPath := fmt.Sprintf("%vchain.dat", filePath)
+	_, err := os.Stat(headPath)
+	fresh := os.IsNotExist(err)
+	file, err := os.OpenFile(headPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open chain head: %v", err)
+	}
+	c.Head = &HeadFile{file: file}
+	if c.Checkpoints, err = OpenCheckpointLog(fmt.Sprintf("%vcheckpoint.dat", filePath)); err != nil {
+		return nil, err
+	}
+	if c.IncorporatedLog, err = OpenIncorporatedLog(fmt.Sprintf("%vincorporated.dat", filePath)); err != nil {
+		return nil, err
+	}
+	if fresh {
+		return c, c.Head.Save(c)
+	}
+	if err := c.Head.load(c); err != nil {
+		return nil, err
+	}
+	if commitState.NewMutations().GetEpoch() != c.LastCommitEpoch+1 {
+		return nil, errors.New("commited state and chain head are out of sync")
+	}
+	checkpoints, err := c.Checkpoints.All()
+	if err != nil {
+		return nil, err
+	}
+	if len(checkpoints) > 0 {
+		c.LastCheckpoint = checkpoints[len(checkpoints)-1]
+	}
+	if c.Incorporated, err = c.IncorporatedLog.Load(c.LastCommitEpoch); err != nil {
+		return nil, err
+	}
+	c.compactIncorporated()
+	c.SealedBlocks = map[uint64]*Block{c.LastCommitEpoch: {Epoch: c.LastCommitEpoch, Hash: c.LastCommitHash}}
+	c.Candidates = make(map[uint64]map[crypto.Hash]*Block)
+	return c, nil
+}
+
+// ImportCheckpoint persists on filePath a chain whose head is the block of a
+// checkpoint, as for a node that joins the network out of a snapshot of the
+// state at the checkpoint. filePath must not hold a chain. OpenChain resumes
+// the chain over the imported state.
+func ImportCheckpoint(checkpoint *Checkpoint, filePath string) error {
+	headPath := fmt.Sprintf("%vchain.dat", filePath)
+	if _, err := os.Stat(headPath); !os.IsNotExist(err) {
+		return errors.New("a chain already exists on the path")
+	}
+	file, err := os.OpenFile(headPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open chain head: %v", err)
+	}
+	head := &HeadFile{file: file}
+	defer head.Close()
+	checkpoints, err := OpenCheckpointLog(fmt.Sprintf("%vcheckpoint.dat", filePath))
+	if err != nil {
+		return err
+	}
+	defer checkpoints.Close()
+	if err := checkpoints.Append(checkpoint); err != nil {
+		return err
+	}
+	c := &Chain{
+		LastCommitEpoch: checkpoint.Epoch,
+		LastCommitHash:  checkpoint.BlockHash,
+		RollingHash:     checkpoint.ChainHash,
+	}
+	return head.Save(c)
+}
@@ -0,0 +1,111 @@
+package chain
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Liveness counts the participation of a validator in block formation within a
+// checkpoint window: blocks it proposed and sealed, epochs handed over to
+// another proposer after it stalled, and actions invalidated on the commit of
+// its blocks.
+type Liveness struct {
+	Proposed    uint64
+	Sealed      uint64
+	Missed      uint64
+	Invalidated uint64
+}
+
+// LivenessReport is the liveness of every validator seen by a node within a
+// checkpoint window, in token order.
+type LivenessReport struct {
+	Window     uint64
+	Validators []crypto.Token
+	Liveness   []Liveness
+}
+
+func (l *LivenessReport) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(l.Window, &bytes)
+	util.PutTokenArray(l.Validators, &bytes)
+	for _, liveness := range l.Liveness {
+		util.PutUint64(liveness.Proposed, &bytes)
+		util.PutUint64(liveness.Sealed, &bytes)
+		util.PutUint64(liveness.Missed, &bytes)
+		util.PutUint64(liveness.Invalidated, &bytes)
+	}
+	return bytes
+}
+
+func ParseLivenessReport(data []byte) *LivenessReport {
+	position := 0
+	var report LivenessReport
+	report.Window, position = util.ParseUint64(data, position)
+	report.Validators, position = util.ParseTokenArray(data, position)
+	report.Liveness = make([]Liveness, len(report.Validators))
+	for n := range report.Liveness {
+		liveness := &report.Liveness[n]
+		liveness.Proposed, position = util.ParseUint64(data, position)
+		liveness.Sealed, position = util.ParseUint64(data, position)
+		liveness.Missed, position = util.ParseUint64(data, position)
+		liveness.Invalidated, position = util.ParseUint64(data, position)
+	}
+	if position != len(data) {
+		return nil
+	}
+	return &report
+}
+
+// live returns the liveness of a validator in the window of the given epoch.
+// Only the window of the epoch and the preceding one are kept.
+func (c *Chain) live(epoch uint64, token crypto.Token) *Liveness {
+	window := CheckpointWindow(epoch)
+	if c.liveness == nil {
+		c.liveness = make(map[uint64]map[crypto.Token]*Liveness)
+	}
+	validators, ok := c.liveness[window]
+	if !ok {
+		validators = make(map[crypto.Token]*Liveness)
+		c.liveness[window] = validators
+		for old := range c.liveness {
+			if old+1 < window {
+				delete(c.liveness, old)
+			}
+		}
+	}
+	liveness, ok := validators[token]
+	if !ok {
+		liveness = &Liveness{}
+		validators[token] = liveness
+	}
+	return liveness
+}
+
+// LivenessReport returns a copy of the liveness recorded for the given window
+// or nil if the window is not kept. Liveness is recorded as the chain forms
+// blocks and is not persisted: the report of a window a node restarted in only
+// counts the blocks formed since the restart.
+func (c *Chain) LivenessReport(window uint64) *LivenessReport {
+	validators, ok := c.liveness[window]
+	if !ok {
+		return nil
+	}
+	report := &LivenessReport{
+		Window:     window,
+		Validators: make([]crypto.Token, 0, len(validators)),
+		Liveness:   make([]Liveness, 0, len(validators)),
+	}
+	for token := range validators {
+		report.Validators = append(report.Validators, token)
+	}
+	sort.Slice(report.Validators, func(i, j int) bool {
+		return bytes.Compare(report.Validators[i][:], report.Validators[j][:]) < 0
+	})
+	for _, token := range report.Validators {
+		report.Liveness = append(report.Liveness, *validators[token])
+	}
+	return report
+}
@@ -0,0 +1,33 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestLivenessReport(t *testing.T) {
+	if CheckpointWindow(CheckpointInterval-1) != 0 || CheckpointWindow(CheckpointInterval) != 1 {
+		t.Fatal("checkpoint epoch out of the window it opens")
+	}
+	tokens := make([]crypto.Token, 3)
+	for n := range tokens {
+		tokens[n], _ = crypto.RandomAsymetricKey()
+	}
+	var chain Chain
+	chain.live(1, tokens[0]).Proposed += 2
+	chain.live(2, tokens[1]).Missed += 1
+	chain.live(CheckpointInterval, tokens[2]).Sealed += 1
+	chain.live(2*CheckpointInterval, tokens[2]).Invalidated += 3
+	if chain.LivenessReport(0) != nil {
+		t.Fatal("liveness of old window kept")
+	}
+	report := chain.LivenessReport(2)
+	if report == nil || len(report.Validators) != 1 || report.Liveness[0].Invalidated != 3 {
+		t.Fatal("liveness not recorded")
+	}
+	parsed := ParseLivenessReport(report.Serialize())
+	if parsed == nil || parsed.Window != 2 || !parsed.Validators[0].Equal(tokens[2]) || parsed.Liveness[0] != report.Liveness[0] {
+		t.Fatal("liveness report serialization failed")
+	}
+}
@@ -0,0 +1,205 @@
+package chain
+
+import (
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Actions of a block are committed on its header by the root of a Merkle tree
+// over the hashes of the actions in block order. Leaves and inner nodes are
+// hashed with distinct prefixes, so that an inner node cannot be presented as
+// a leaf. A node left without a sibling on an odd level is promoted unchanged
+// to the level above. The root of a block with no actions is crypto.ZeroHash.
+
+func leafHash(action crypto.Hash) crypto.Hash {
+	return crypto.Hasher(append([]byte{0}, action[:]...))
+}
+
+func nodeHash(left, right crypto.Hash) crypto.Hash {
+	data := make([]byte, 0, 1+2*crypto.Size)
+	data = append(data, 1)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	return crypto.Hasher(data)
+}
+
+// nextLevel hashes a level of the tree into the level above.
+func nextLevel(level []crypto.Hash) []crypto.Hash {
+	next := make([]crypto.Hash, 0, (len(level)+1)/2)
+	for n := 0; n+1 < len(level); n += 2 {
+		next = append(next, nodeHash(level[n], level[n+1]))
+	}
+	if len(level)%2 == 1 {
+		next = append(next, level[len(level)-1])
+	}
+	return next
+}
+
+func leaves(actions [][]byte) []crypto.Hash {
+	level := make([]crypto.Hash, len(actions))
+	for n, action := range actions {
+		level[n] = leafHash(crypto.Hasher(action))
+	}
+	return level
+}
+
+func root(level []crypto.Hash) crypto.Hash {
+	if len(level) == 0 {
+		return crypto.ZeroHash
+	}
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+// ActionsRoot returns the Merkle root of the given actions.
+func ActionsRoot(actions [][]byte) crypto.Hash {
+	return root(leaves(actions))
+}
+
+// MerkleProof proves the inclusion of an action in a block. Index is the
+// position of the action on the block, Size the number of actions of the block
+// and Path the siblings of the nodes from the leaf to the root.
+type MerkleProof struct {
+	Index uint32
+	Size  uint32
+	Path  []crypto.Hash
+}
+
+// ProofFor returns the proof of inclusion of the action with the given hash on
+// the block, or nil if the action is not on the block.
+func (b *Block) ProofFor(action crypto.Hash) *MerkleProof {
+	level := leaves(b.Actions)
+	leaf := leafHash(action)
+	index := -1
+	for n, hash := range level {
+		if hash.Equal(leaf) {
+			index = n
+			break
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+	proof := &MerkleProof{Index: uint32(index), Size: uint32(len(level)), Path: make([]crypto.Hash, 0)}
+	for len(level) > 1 {
+		if sibling := index ^ 1; sibling < len(level) {
+			proof.Path = append(proof.Path, level[sibling])
+		}
+		level = nextLevel(level)
+		index = index / 2
+	}
+	return proof
+}
+
+// VerifyInclusion checks that proof proves the inclusion of the action with
+// the given hash on a block whose header carries the given actions root.
+func VerifyInclusion(root, action crypto.Hash, proof *MerkleProof) bool {
+	if proof == nil || proof.Index >= proof.Size {
+		return false
+	}
+	hash := leafHash(action)
+	index, size := proof.Index, proof.Size
+	path := proof.Path
+	for size > 1 {
+		if index%2 == 1 || index+1 < size {
+			if len(path) == 0 {
+				return false
+			}
+			if index%2 == 1 {
+				hash = nodeHash(path[0], hash)
+			} else {
+				hash = nodeHash(hash, path[0])
+			}
+			path = path[1:]
+		}
+		index, size = index/2, (size+1)/2
+	}
+	return len(path) == 0 && hash.Equal(root)
+}
+
+func (p *MerkleProof) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint32(p.Index, &bytes)
+	util.PutUint32(p.Size, &bytes)
+	util.PutHashArray(p.Path, &bytes)
+	return bytes
+}
+
+func ParseMerkleProof(data []byte) *MerkleProof {
+	position := 0
+	proof := MerkleProof{}
+	proof.Index, position = util.ParseUint32(data, position)
+	proof.Size, position = util.ParseUint32(data, position)
+	proof.Path, position = util.ParseHashArray(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &proof
+}
+
+// FilterProof proves that the actions of a block filtered from a breeze block
+// are on the breeze block. Positions are the positions of the actions of the
+// filtered block on the breeze block and Omitted the hashes of the remaining
+// actions of the breeze block, in order. Together with the actions of the
+// filtered block they rebuild the actions root of the breeze block.
+type FilterProof struct {
+	Positions []uint32
+	Omitted   []crypto.Hash
+}
+
+// Root returns the actions root of the breeze block the given actions were
+// filtered from. It returns false if the proof does not fit the actions.
+func (p *FilterProof) Root(actions [][]byte) (crypto.Hash, bool) {
+	if len(p.Positions) != len(actions) {
+		return crypto.ZeroHash, false
+	}
+	level := make([]crypto.Hash, len(actions)+len(p.Omitted))
+	kept, omitted := 0, 0
+	for n := range level {
+		if kept < len(p.Positions) && p.Positions[kept] == uint32(n) {
+			level[n] = leafHash(crypto.Hasher(actions[kept]))
+			kept++
+		} else if omitted < len(p.Omitted) {
+			level[n] = leafHash(p.Omitted[omitted])
+			omitted++
+		} else {
+			return crypto.ZeroHash, false
+		}
+	}
+	return root(level), true
+}
+
+func putFilterProof(proof *FilterProof, data *[]byte) {
+	if proof == nil {
+		util.PutBool(false, data)
+		return
+	}
+	util.PutBool(true, data)
+	util.PutUint32(uint32(len(proof.Positions)), data)
+	for _, position := range proof.Positions {
+		util.PutUint32(position, data)
+	}
+	util.PutHashArray(proof.Omitted, data)
+}
+
+func parseFilterProof(data []byte, position int) (*FilterProof, int) {
+	var present bool
+	present, position = util.ParseBool(data, position)
+	if !present {
+		return nil, position
+	}
+	proof := FilterProof{}
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if position+4*int(count) > len(data) {
+		return nil, len(data) + 1
+	}
+	proof.Positions = make([]uint32, count)
+	for n := range proof.Positions {
+		proof.Positions[n], position = util.ParseUint32(data, position)
+	}
+	proof.Omitted, position = util.ParseHashArray(data, position)
+	return &proof, position
+}
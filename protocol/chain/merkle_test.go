@@ -0,0 +1,50 @@
+package chain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestMerkleProof(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		block := &Block{Actions: make([][]byte, size)}
+		for n := range block.Actions {
+			block.Actions[n] = []byte(fmt.Sprintf("action %v", n))
+		}
+		root := ActionsRoot(block.Actions)
+		for n, action := range block.Actions {
+			hash := crypto.Hasher(action)
+			proof := ParseMerkleProof(block.ProofFor(hash).Serialize())
+			if proof == nil || !VerifyInclusion(root, hash, proof) {
+				t.Fatalf("valid proof of action %v of %v rejected", n, size)
+			}
+			if VerifyInclusion(root, crypto.Hasher([]byte("other")), proof) {
+				t.Fatalf("proof of action %v of %v accepted for another action", n, size)
+			}
+			if size > 1 {
+				proof.Index = (proof.Index + 1) % proof.Size
+				if VerifyInclusion(root, hash, proof) {
+					t.Fatalf("proof of action %v of %v accepted on another position", n, size)
+				}
+			}
+		}
+		if block.ProofFor(crypto.Hasher([]byte("other"))) != nil {
+			t.Fatal("proof returned for action not on block")
+		}
+	}
+}
+
+func TestParseBlockActionsRoot(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	block := &Block{Epoch: 1, Proposer: token, Actions: [][]byte{[]byte("first"), []byte("second")}}
+	block.Seal(key)
+	parsed := ParseBlock(block.Serialize())
+	if parsed == nil || !parsed.ActionsRoot.Equal(ActionsRoot(block.Actions)) || !parsed.Hash.Equal(block.Hash) {
+		t.Fatal("could not parse sealed block")
+	}
+	if !VerifyInclusion(parsed.ActionsRoot, crypto.Hasher([]byte("second")), parsed.ProofFor(crypto.Hasher([]byte("second")))) {
+		t.Fatal("could not prove inclusion on parsed block")
+	}
+}
@@ -0,0 +1,283 @@
+package chain
+
+import (
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Committee provides the tokens of the validators entitled to vote on the
+// block of a given epoch.
+type Committee interface {
+	Members(epoch uint64) []crypto.Token
+}
+
+// StaticCommittee is a committee that does not change with epochs.
+type StaticCommittee []crypto.Token
+
+func (s StaticCommittee) Members(epoch uint64) []crypto.Token {
+	return s
+}
+
+// Vote is the signature of a validator over the commit of a sealed block: the
+// hash of the block and the digest of the outcome of its commit.
+type Vote struct {
+	Epoch     uint64
+	Hash      crypto.Hash
+	Commit    crypto.Hash // CommitHash of the outcome of the commit
+	Token     crypto.Token
+	Signature crypto.Signature
+}
+
+// CommitHash is the digest of the outcome of the commit of a block: the hash
+// of the previously commited block, the hashes of the actions invalidated by
+// the commit and the root of the state after it.
+func CommitHash(previous crypto.Hash, invalidated []crypto.Hash, root crypto.Hash) crypto.Hash {
+	bytes := make([]byte, 0)
+	util.PutHash(previous, &bytes)
+	util.PutHashArray(invalidated, &bytes)
+	util.PutHash(root, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+func voteMessage(epoch uint64, hash, commit crypto.Hash) []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(epoch, &bytes)
+	util.PutHash(hash, &bytes)
+	util.PutHash(commit, &bytes)
+	return bytes
+}
+
+func NewVote(epoch uint64, hash, commit crypto.Hash, credentials crypto.PrivateKey) *Vote {
+	return &Vote{
+		Epoch:     epoch,
+		Hash:      hash,
+		Commit:    commit,
+		Token:     credentials.PublicKey(),
+		Signature: credentials.Sign(voteMessage(epoch, hash, commit)),
+	}
+}
+
+func (v *Vote) Verify() bool {
+	return v.Token.Verify(voteMessage(v.Epoch, v.Hash, v.Commit), v.Signature)
+}
+
+func (v *Vote) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(v.Epoch, &bytes)
+	util.PutHash(v.Hash, &bytes)
+	util.PutHash(v.Commit, &bytes)
+	util.PutToken(v.Token, &bytes)
+	util.PutSignature(v.Signature, &bytes)
+	return bytes
+}
+
+func ParseVote(data []byte) *Vote {
+	position := 0
+	var vote Vote
+	vote.Epoch, position = util.ParseUint64(data, position)
+	vote.Hash, position = util.ParseHash(data, position)
+	vote.Commit, position = util.ParseHash(data, position)
+	vote.Token, position = util.ParseToken(data, position)
+	vote.Signature, position = util.ParseSignature(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &vote
+}
+
+// QuorumCertificate aggregates votes of validators over the same commit of a
+// sealed block. A certificate signed by more than two thirds of the committee
+// of the epoch is a proof of finality of the block and of the outcome of its
+// commit.
+type QuorumCertificate struct {
+	Epoch  uint64
+	Hash   crypto.Hash
+	Commit crypto.Hash
+	Votes  []Vote
+}
+
+func NewQuorumCertificate(epoch uint64, hash, commit crypto.Hash) *QuorumCertificate {
+	return &QuorumCertificate{
+		Epoch:  epoch,
+		Hash:   hash,
+		Commit: commit,
+		Votes:  make([]Vote, 0),
+	}
+}
+
+// Append incorporates a valid vote over the certified commit. Repeated votes
+// of the same token are ignored.
+func (q *QuorumCertificate) Append(vote *Vote) bool {
+	if vote.Epoch != q.Epoch || !vote.Hash.Equal(q.Hash) || !vote.Commit.Equal(q.Commit) {
+		return false
+	}
+	for _, existing := range q.Votes {
+		if existing.Token.Equal(vote.Token) {
+			return false
+		}
+	}
+	if !vote.Verify() {
+		return false
+	}
+	q.Votes = append(q.Votes, *vote)
+	return true
+}
+
+// Verify checks if the certificate holds valid votes of more than two thirds
+// of the members of the committee.
+func (q *QuorumCertificate) Verify(committee Committee) bool {
+	members := committee.Members(q.Epoch)
+	if len(members) == 0 {
+		return false
+	}
+	voted := make(map[crypto.Token]struct{})
+	for _, vote := range q.Votes {
+		if vote.Epoch != q.Epoch || !vote.Hash.Equal(q.Hash) || !vote.Commit.Equal(q.Commit) {
+			return false
+		}
+		if _, ok := voted[vote.Token]; ok {
+			continue
+		}
+		if vote.Verify() {
+			voted[vote.Token] = struct{}{}
+		}
+	}
+	return hasQuorum(members, voted)
+}
+
+// hasQuorum checks if more than two thirds of the members voted.
+func hasQuorum(members []crypto.Token, voted map[crypto.Token]struct{}) bool {
+	count := 0
+	for _, member := range members {
+		if _, ok := voted[member]; ok {
+			count += 1
+		}
+	}
+	return 3*count > 2*len(members)
+}
+
+// Certifies checks if the certificate is a valid proof of finality of the
+// block with given epoch and hash commited with the given CommitHash. It is
+// safe to call on a nil certificate.
+func (q *QuorumCertificate) Certifies(epoch uint64, hash, commit crypto.Hash, committee Committee) bool {
+	if q == nil || q.Epoch != epoch || !q.Hash.Equal(hash) || !q.Commit.Equal(commit) {
+		return false
+	}
+	return q.Verify(committee)
+}
+
+func (q *QuorumCertificate) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(q.Epoch, &bytes)
+	util.PutHash(q.Hash, &bytes)
+	util.PutHash(q.Commit, &bytes)
+	util.PutUint32(uint32(len(q.Votes)), &bytes)
+	for _, vote := range q.Votes {
+		util.PutToken(vote.Token, &bytes)
+		util.PutSignature(vote.Signature, &bytes)
+	}
+	return bytes
+}
+
+func ParseQuorumCertificate(data []byte, position int) (*QuorumCertificate, int) {
+	var certificate QuorumCertificate
+	var count uint32
+	certificate.Epoch, position = util.ParseUint64(data, position)
+	certificate.Hash, position = util.ParseHash(data, position)
+	certificate.Commit, position = util.ParseHash(data, position)
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.TokenSize+crypto.SignatureSize) > len(data) {
+		return nil, len(data) + 1
+	}
+	certificate.Votes = make([]Vote, int(count))
+	for n := 0; n < int(count); n++ {
+		vote := Vote{Epoch: certificate.Epoch, Hash: certificate.Hash, Commit: certificate.Commit}
+		vote.Token, position = util.ParseToken(data, position)
+		vote.Signature, position = util.ParseSignature(data, position)
+		certificate.Votes[n] = vote
+	}
+	return &certificate, position
+}
+
+// PutQuorumCertificate appends an optional certificate to data.
+func PutQuorumCertificate(certificate *QuorumCertificate, data *[]byte) {
+	if certificate == nil {
+		util.PutBool(false, data)
+		return
+	}
+	util.PutBool(true, data)
+	*data = append(*data, certificate.Serialize()...)
+}
+
+// ParseOptionalQuorumCertificate parses a certificate appended by
+// PutQuorumCertificate.
+func ParseOptionalQuorumCertificate(data []byte, position int) (*QuorumCertificate, int) {
+	var present bool
+	present, position = util.ParseBool(data, position)
+	if !present {
+		return nil, position
+	}
+	return ParseQuorumCertificate(data, position)
+}
+
+// CertifiedCommit is the outcome of the commit of a block together with the
+// quorum certificate of the committee over it. It proves the state root after
+// the commit to anyone who trusts the committee.
+type CertifiedCommit struct {
+	Epoch        uint64
+	Hash         crypto.Hash
+	PreviousHash crypto.Hash
+	Invalidate   []crypto.Hash
+	StateRoot    crypto.Hash
+	Certificate  *QuorumCertificate
+}
+
+// NewCertifiedCommit returns the certified outcome of a commited block, or nil
+// if the block was commited without a certificate.
+func NewCertifiedCommit(block *Block) *CertifiedCommit {
+	if block.Certificate == nil {
+		return nil
+	}
+	return &CertifiedCommit{
+		Epoch:        block.Epoch,
+		Hash:         block.Hash,
+		PreviousHash: block.PreviousHash,
+		Invalidate:   block.Invalidate,
+		StateRoot:    block.StateRoot,
+		Certificate:  block.Certificate,
+	}
+}
+
+// Verify checks if the certificate is a quorum of the committee on the
+// outcome of the commit. It is safe to call on a nil commit.
+func (c *CertifiedCommit) Verify(committee Committee) bool {
+	if c == nil || committee == nil {
+		return false
+	}
+	return c.Certificate.Certifies(c.Epoch, c.Hash, CommitHash(c.PreviousHash, c.Invalidate, c.StateRoot), committee)
+}
+
+func (c *CertifiedCommit) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(c.Epoch, &bytes)
+	util.PutHash(c.Hash, &bytes)
+	util.PutHash(c.PreviousHash, &bytes)
+	util.PutHashArray(c.Invalidate, &bytes)
+	util.PutHash(c.StateRoot, &bytes)
+	return append(bytes, c.Certificate.Serialize()...)
+}
+
+func ParseCertifiedCommit(data []byte) *CertifiedCommit {
+	position := 0
+	var commit CertifiedCommit
+	commit.Epoch, position = util.ParseUint64(data, position)
+	commit.Hash, position = util.ParseHash(data, position)
+	commit.PreviousHash, position = util.ParseHash(data, position)
+	commit.Invalidate, position = util.ParseHashArray(data, position)
+	commit.StateRoot, position = util.ParseHash(data, position)
+	commit.Certificate, position = ParseQuorumCertificate(data, position)
+	if commit.Certificate == nil || position != len(data) {
+		return nil
+	}
+	return &commit
+}
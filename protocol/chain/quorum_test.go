@@ -0,0 +1,113 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestQuorumCertificate(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	committee := make(StaticCommittee, 4)
+	for n := range keys {
+		committee[n], keys[n] = crypto.RandomAsymetricKey()
+	}
+	hash := crypto.Hasher([]byte("block"))
+	commit := CommitHash(crypto.Hasher([]byte("previous")), nil, crypto.Hasher([]byte("root")))
+	certificate := NewQuorumCertificate(10, hash, commit)
+	for n := 0; n < 2; n++ {
+		if !certificate.Append(NewVote(10, hash, commit, keys[n])) {
+			t.Fatalf("valid vote not appended")
+		}
+	}
+	if certificate.Append(NewVote(10, hash, commit, keys[0])) {
+		t.Errorf("repeated vote appended")
+	}
+	if certificate.Append(NewVote(11, hash, commit, keys[2])) {
+		t.Errorf("vote on another epoch appended")
+	}
+	if certificate.Append(NewVote(10, hash, crypto.ZeroHash, keys[2])) {
+		t.Errorf("vote on another commit appended")
+	}
+	if certificate.Certifies(10, hash, commit, committee) {
+		t.Errorf("certificate with half of the votes should not certify")
+	}
+	certificate.Append(NewVote(10, hash, commit, keys[2]))
+	if !certificate.Certifies(10, hash, commit, committee) {
+		t.Errorf("certificate with three of four votes should certify")
+	}
+	data := make([]byte, 0)
+	PutQuorumCertificate(certificate, &data)
+	parsed, position := ParseOptionalQuorumCertificate(data, 0)
+	if position != len(data) || parsed == nil || !parsed.Certifies(10, hash, commit, committee) {
+		t.Errorf("certificate serialization failed")
+	}
+	var missing *QuorumCertificate
+	if missing.Certifies(10, hash, commit, committee) {
+		t.Errorf("nil certificate should not certify")
+	}
+}
+
+func TestCertifiedCommit(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	committee := make(StaticCommittee, 4)
+	for n := range keys {
+		committee[n], keys[n] = crypto.RandomAsymetricKey()
+	}
+	block := &Block{Epoch: 3, Proposer: committee[0], Actions: [][]byte{[]byte("valid"), []byte("invalid")}}
+	block.Seal(keys[0])
+	block.PreviousHash = crypto.Hasher([]byte("previous"))
+	block.Invalidate = []crypto.Hash{crypto.Hasher([]byte("invalid"))}
+	block.StateRoot = crypto.Hasher([]byte("root"))
+	block.Certificate = NewQuorumCertificate(block.Epoch, block.Hash, block.CommitHash())
+	for _, key := range keys[:3] {
+		block.Certificate.Append(NewVote(block.Epoch, block.Hash, block.CommitHash(), key))
+	}
+	parsed := ParseBlock(block.Serialize())
+	if parsed == nil || !parsed.Certificate.Certifies(parsed.Epoch, parsed.Hash, parsed.CommitHash(), committee) {
+		t.Fatal("certified commit not verified")
+	}
+	parsed.Invalidate = append(parsed.Invalidate, crypto.Hasher([]byte("valid")))
+	if parsed.Certificate.Certifies(parsed.Epoch, parsed.Hash, parsed.CommitHash(), committee) {
+		t.Error("commit with tampered invalidated actions certified")
+	}
+	parsed.Invalidate = nil
+	if parsed.Certificate.Certifies(parsed.Epoch, parsed.Hash, parsed.CommitHash(), committee) {
+		t.Error("commit with dropped invalidated actions certified")
+	}
+	parsed.Invalidate = block.Invalidate
+	parsed.PreviousHash = crypto.Hasher([]byte("fork"))
+	if parsed.Certificate.Certifies(parsed.Epoch, parsed.Hash, parsed.CommitHash(), committee) {
+		t.Error("commit with tampered previous hash certified")
+	}
+	parsed.PreviousHash = block.PreviousHash
+	parsed.StateRoot = crypto.Hasher([]byte("forged root"))
+	if parsed.Certificate.Certifies(parsed.Epoch, parsed.Hash, parsed.CommitHash(), committee) {
+		t.Error("commit with tampered state root certified")
+	}
+}
+
+func TestViewCertificate(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	committee := make(StaticCommittee, 4)
+	for n := range keys {
+		committee[n], keys[n] = crypto.RandomAsymetricKey()
+	}
+	certificate := NewViewCertificate(7, 1)
+	if certificate.Append(NewViewChange(7, 2, keys[0])) {
+		t.Errorf("request for another view appended")
+	}
+	for n := 0; n < 3; n++ {
+		change := ParseViewChange(NewViewChange(7, 1, keys[n]).Serialize())
+		if change == nil || !certificate.Append(change) {
+			t.Fatalf("valid view change not appended")
+		}
+		if certificate.Verify(committee) != (n == 2) {
+			t.Fatalf("certificate with %v of four requests", n+1)
+		}
+	}
+	parsed := ParseViewCertificate(certificate.Serialize())
+	if parsed == nil || parsed.View != 1 || !parsed.Verify(committee) {
+		t.Errorf("view certificate serialization failed")
+	}
+}
@@ -0,0 +1,169 @@
+package chain
+
+import (
+	"errors"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// RecoveryRequest is the request of a validator to restore the chain to a
+// checkpoint certified by a quorum. Checkpoint is the hash of the checkpoint
+// contents. Validators only request recoveries to their own last checkpoint.
+type RecoveryRequest struct {
+	Epoch      uint64
+	Checkpoint crypto.Hash
+	Token      crypto.Token
+	Signature  crypto.Signature
+}
+
+func recoveryMessage(epoch uint64, checkpoint crypto.Hash) []byte {
+	bytes := []byte("recovery")
+	util.PutUint64(epoch, &bytes)
+	util.PutHash(checkpoint, &bytes)
+	return bytes
+}
+
+func NewRecoveryRequest(checkpoint *Checkpoint, credentials crypto.PrivateKey) *RecoveryRequest {
+	hash := checkpoint.Hash()
+	return &RecoveryRequest{
+		Epoch:      checkpoint.Epoch,
+		Checkpoint: hash,
+		Token:      credentials.PublicKey(),
+		Signature:  credentials.Sign(recoveryMessage(checkpoint.Epoch, hash)),
+	}
+}
+
+func (r *RecoveryRequest) Verify() bool {
+	return r.Token.Verify(recoveryMessage(r.Epoch, r.Checkpoint), r.Signature)
+}
+
+func (r *RecoveryRequest) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(r.Epoch, &bytes)
+	util.PutHash(r.Checkpoint, &bytes)
+	util.PutToken(r.Token, &bytes)
+	util.PutSignature(r.Signature, &bytes)
+	return bytes
+}
+
+func ParseRecoveryRequest(data []byte) *RecoveryRequest {
+	position := 0
+	var request RecoveryRequest
+	request.Epoch, position = util.ParseUint64(data, position)
+	request.Checkpoint, position = util.ParseHash(data, position)
+	request.Token, position = util.ParseToken(data, position)
+	request.Signature, position = util.ParseSignature(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &request
+}
+
+// RecoveryCertificate aggregates recovery requests of validators for the same
+// checkpoint. A certificate signed by more than two thirds of the committee of
+// the checkpoint epoch is the decision of the network to restore the chain to
+// the checkpoint. Checkpoint certificates, produced at every checkpoint, are
+// no such decision.
+type RecoveryCertificate struct {
+	Epoch      uint64
+	Checkpoint crypto.Hash
+	Requests   []RecoveryRequest
+}
+
+func NewRecoveryCertificate(epoch uint64, checkpoint crypto.Hash) *RecoveryCertificate {
+	return &RecoveryCertificate{
+		Epoch:      epoch,
+		Checkpoint: checkpoint,
+		Requests:   make([]RecoveryRequest, 0),
+	}
+}
+
+// Append incorporates a valid request for the certified checkpoint. Repeated
+// requests of the same token are ignored.
+func (r *RecoveryCertificate) Append(request *RecoveryRequest) bool {
+	if request.Epoch != r.Epoch || !request.Checkpoint.Equal(r.Checkpoint) {
+		return false
+	}
+	for _, existing := range r.Requests {
+		if existing.Token.Equal(request.Token) {
+			return false
+		}
+	}
+	if !request.Verify() {
+		return false
+	}
+	r.Requests = append(r.Requests, *request)
+	return true
+}
+
+// Verify checks if the certificate holds valid requests of more than two
+// thirds of the members of the committee. It is safe to call on a nil
+// certificate.
+func (r *RecoveryCertificate) Verify(committee Committee) bool {
+	if r == nil || committee == nil {
+		return false
+	}
+	members := committee.Members(r.Epoch)
+	if len(members) == 0 {
+		return false
+	}
+	requested := make(map[crypto.Token]struct{})
+	for _, request := range r.Requests {
+		if request.Epoch != r.Epoch || !request.Checkpoint.Equal(r.Checkpoint) {
+			return false
+		}
+		if request.Verify() {
+			requested[request.Token] = struct{}{}
+		}
+	}
+	return hasQuorum(members, requested)
+}
+
+func (r *RecoveryCertificate) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(r.Epoch, &bytes)
+	util.PutHash(r.Checkpoint, &bytes)
+	util.PutUint32(uint32(len(r.Requests)), &bytes)
+	for _, request := range r.Requests {
+		util.PutToken(request.Token, &bytes)
+		util.PutSignature(request.Signature, &bytes)
+	}
+	return bytes
+}
+
+func ParseRecoveryCertificate(data []byte) *RecoveryCertificate {
+	position := 0
+	var certificate RecoveryCertificate
+	var count uint32
+	certificate.Epoch, position = util.ParseUint64(data, position)
+	certificate.Checkpoint, position = util.ParseHash(data, position)
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.TokenSize+crypto.SignatureSize) != len(data) {
+		return nil
+	}
+	certificate.Requests = make([]RecoveryRequest, int(count))
+	for n := 0; n < int(count); n++ {
+		request := RecoveryRequest{Epoch: certificate.Epoch, Checkpoint: certificate.Checkpoint}
+		request.Token, position = util.ParseToken(data, position)
+		request.Signature, position = util.ParseSignature(data, position)
+		certificate.Requests[n] = request
+	}
+	return &certificate
+}
+
+// RecoveryRequest returns the request of the node to restore the chain to its
+// last checkpoint, which must be certified by a quorum of the committee.
+func (c *Chain) RecoveryRequest() (*RecoveryRequest, error) {
+	checkpoint := c.LastCheckpoint
+	if checkpoint == nil {
+		return nil, errors.New("no checkpoint to recover to")
+	}
+	if c.Committee == nil || !c.Certified.Certifies(checkpoint, c.Committee) {
+		return nil, errors.New("last checkpoint is not certified by a quorum")
+	}
+	if checkpoint.Epoch <= c.Recovered {
+		return nil, errors.New("chain already recovered to the last checkpoint")
+	}
+	return NewRecoveryRequest(checkpoint, c.Credentials), nil
+}
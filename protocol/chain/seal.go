@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+)
+
+var (
+	// ErrInvalidSealSignature is the reason of a seal not signed by the
+	// proposer of the block. Such a seal is not to be trusted.
+	ErrInvalidSealSignature = errors.New("seal signature does not match block proposer")
+	// ErrDivergentSeal is the reason of a seal signed by the proposer whose
+	// hash differs from the hash of the live block: the actions received by the
+	// node differ from those sealed by the proposer and the block must be
+	// resynchronized.
+	ErrDivergentSeal = errors.New("seal hash diverges from live block")
+)
+
+// SealError is the error of a seal rejected by Chain.SealBlock. Hash is the
+// hash claimed by the seal and Expected the hash computed from the live block,
+// known only if the seal signature is valid.
+type SealError struct {
+	Epoch    uint64
+	Hash     crypto.Hash
+	Expected crypto.Hash
+	Err      error
+}
+
+func (e *SealError) Error() string {
+	if e.Err == ErrDivergentSeal {
+		return fmt.Sprintf("block %v: %v: sealed %v, computed %v", e.Epoch, e.Err, crypto.EncodeHash(e.Hash), crypto.EncodeHash(e.Expected))
+	}
+	return fmt.Sprintf("block %v: %v", e.Epoch, e.Err)
+}
+
+func (e *SealError) Unwrap() error {
+	return e.Err
+}
+
+// SealTail returns the seal of the block as carried by double sign evidence.
+func (b *Block) SealTail() actions.SealTail {
+	return actions.SealTail{
+		Checkpoint:     b.CheckPoint,
+		CheckpointHash: b.CheckpointHash,
+		Timestamp:      b.ProposedAt,
+		ActionsRoot:    b.ActionsRoot,
+		Signature:      b.SealSignature,
+	}
+}
+
+// DoubleSign returns the evidence that the proposer of two sealed blocks of the
+// same epoch signed both, or nil if the blocks do not conflict. The evidence is
+// to be completed with its reporter and epoch and signed by the reporter.
+func DoubleSign(first, second *Block) *actions.DoubleSign {
+	if first.Epoch != second.Epoch || !first.Proposer.Equal(second.Proposer) || first.Hash.Equal(second.Hash) {
+		return nil
+	}
+	if !first.VerifySeal() || !second.VerifySeal() {
+		return nil
+	}
+	return &actions.DoubleSign{
+		Offender:   first.Proposer,
+		BlockEpoch: first.Epoch,
+		First:      first.SealTail(),
+		Second:     second.SealTail(),
+	}
+}
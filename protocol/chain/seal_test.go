@@ -0,0 +1,39 @@
+package chain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestSealBlock(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	sealed := &Block{Epoch: 1, Proposer: token, Actions: [][]byte{[]byte("first"), []byte("second")}}
+	sealed.Seal(key)
+	chain := &Chain{SealedBlocks: map[uint64]*Block{0: {}}}
+
+	chain.LiveBlock = &Block{Epoch: 1, Proposer: token, Actions: [][]byte{[]byte("first")}}
+	err := chain.SealBlock(sealed.ProposedAt, 0, sealed.Hash, sealed.SealSignature)
+	var sealErr *SealError
+	if !errors.As(err, &sealErr) || !errors.Is(err, ErrDivergentSeal) || sealErr.Epoch != 1 {
+		t.Fatalf("divergent seal not rejected: %v", err)
+	}
+	if chain.LiveBlock == nil || len(chain.SealedBlocks) != 1 {
+		t.Fatal("live block sealed on divergent seal")
+	}
+
+	chain.LiveBlock.Actions = sealed.Actions
+	_, other := crypto.RandomAsymetricKey()
+	forged := other.Sign(sealed.Hash[:])
+	if err := chain.SealBlock(sealed.ProposedAt, 0, sealed.Hash, forged); !errors.Is(err, ErrInvalidSealSignature) {
+		t.Fatalf("forged seal not rejected: %v", err)
+	}
+
+	if err := chain.SealBlock(sealed.ProposedAt, 0, sealed.Hash, sealed.SealSignature); err != nil {
+		t.Fatalf("valid seal rejected: %v", err)
+	}
+	if block, ok := chain.SealedBlocks[1]; !ok || !block.Hash.Equal(sealed.Hash) || chain.LiveBlock != nil {
+		t.Fatal("valid seal did not seal the live block")
+	}
+}
@@ -0,0 +1,336 @@
+package chain
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// SetRule selects the validator set among candidates by their deposits.
+// Candidates with a deposit below MinStake are left out, the remaining are
+// ranked by deposit with ties broken by the lowest token, and the first
+// MaxSize of them form the set. A zero MaxSize does not limit the set.
+type SetRule struct {
+	MinStake uint64
+	MaxSize  int
+}
+
+// ValidatorSet is the set of validators computed at a checkpoint epoch. It is
+// in charge of every block after Epoch up to the next checkpoint. Members are
+// ranked as by the SetRule and Stakes are their deposits at Epoch.
+type ValidatorSet struct {
+	Epoch   uint64
+	Members []crypto.Token
+	Stakes  []uint64
+}
+
+// NewValidatorSet selects the validator set of the given epoch among
+// candidates. stake returns the deposit of a token at the state commited at
+// the epoch.
+func NewValidatorSet(epoch uint64, candidates []crypto.Token, stake func(crypto.Token) uint64, rule SetRule) *ValidatorSet {
+	type ranked struct {
+		token crypto.Token
+		stake uint64
+	}
+	eligible := make([]ranked, 0, len(candidates))
+	seen := make(map[crypto.Token]struct{})
+	for _, token := range candidates {
+		if _, ok := seen[token]; ok {
+			continue
+		}
+		seen[token] = struct{}{}
+		if deposit := stake(token); deposit > 0 && deposit >= rule.MinStake {
+			eligible = append(eligible, ranked{token: token, stake: deposit})
+		}
+	}
+	sort.Slice(eligible, func(i, j int) bool {
+		if eligible[i].stake != eligible[j].stake {
+			return eligible[i].stake > eligible[j].stake
+		}
+		return bytes.Compare(eligible[i].token[:], eligible[j].token[:]) < 0
+	})
+	if rule.MaxSize > 0 && len(eligible) > rule.MaxSize {
+		eligible = eligible[:rule.MaxSize]
+	}
+	set := &ValidatorSet{
+		Epoch:   epoch,
+		Members: make([]crypto.Token, len(eligible)),
+		Stakes:  make([]uint64, len(eligible)),
+	}
+	for n, validator := range eligible {
+		set.Members[n] = validator.token
+		set.Stakes[n] = validator.stake
+	}
+	return set
+}
+
+func (v *ValidatorSet) IsMember(token crypto.Token) bool {
+	for _, member := range v.Members {
+		if member.Equal(token) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *ValidatorSet) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(v.Epoch, &bytes)
+	util.PutTokenArray(v.Members, &bytes)
+	for _, stake := range v.Stakes {
+		util.PutUint64(stake, &bytes)
+	}
+	return bytes
+}
+
+func ParseValidatorSet(data []byte) *ValidatorSet {
+	position := 0
+	var set ValidatorSet
+	set.Epoch, position = util.ParseUint64(data, position)
+	set.Members, position = util.ParseTokenArray(data, position)
+	set.Stakes = make([]uint64, len(set.Members))
+	for n := range set.Stakes {
+		set.Stakes[n], position = util.ParseUint64(data, position)
+	}
+	if position != len(data) {
+		return nil
+	}
+	return &set
+}
+
+// Rotation is the committee of a chain whose validator set is recomputed at
+// checkpoints. Sets are kept in epoch order and the set in charge of an epoch
+// is the last one computed before it. The first set is in charge from genesis.
+// A rotation may be shared by a listener appending announced sets and the
+// consumers of its blocks.
+type Rotation struct {
+	mu   sync.RWMutex
+	Sets []*ValidatorSet
+}
+
+func NewRotation(genesis *ValidatorSet) *Rotation {
+	return &Rotation{Sets: []*ValidatorSet{genesis}}
+}
+
+// Set returns the validator set in charge of the block of the given epoch.
+func (r *Rotation) Set(epoch uint64) *ValidatorSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for n := len(r.Sets) - 1; n > 0; n-- {
+		if r.Sets[n].Epoch < epoch {
+			return r.Sets[n]
+		}
+	}
+	return r.Sets[0]
+}
+
+// Last returns the most recent validator set.
+func (r *Rotation) Last() *ValidatorSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Sets[len(r.Sets)-1]
+}
+
+func (r *Rotation) Members(epoch uint64) []crypto.Token {
+	return r.Set(epoch).Members
+}
+
+// Append incorporates a set computed after the last one. It returns false if
+// the set is not more recent, as for sets announced more than once.
+func (r *Rotation) Append(set *ValidatorSet) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if set == nil || set.Epoch <= r.Sets[len(r.Sets)-1].Epoch {
+		return false
+	}
+	r.Sets = append(r.Sets, set)
+	return true
+}
+
+func (r *Rotation) Serialize() []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	bytes := make([]byte, 0)
+	for _, set := range r.Sets {
+		util.PutByteArray(set.Serialize(), &bytes)
+	}
+	return bytes
+}
+
+// ParseRotation parses the validator sets of a rotation, as persisted by
+// validators. It returns nil if there is no set.
+func ParseRotation(data []byte) *Rotation {
+	sets := make([]*ValidatorSet, 0)
+	position := 0
+	for position < len(data) {
+		var bytes []byte
+		bytes, position = util.ParseByteArray(data, position)
+		if position > len(data) {
+			return nil
+		}
+		set := ParseValidatorSet(bytes)
+		if set == nil {
+			return nil
+		}
+		sets = append(sets, set)
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	return &Rotation{Sets: sets}
+}
+
+// Hash of the set contents.
+func (v *ValidatorSet) Hash() crypto.Hash {
+	return crypto.Hasher(v.Serialize())
+}
+
+// SetEndorsement is the signature of a validator of the set in charge of a
+// checkpoint epoch on the validator set computed at the checkpoint.
+type SetEndorsement struct {
+	Epoch     uint64
+	Set       crypto.Hash
+	Token     crypto.Token
+	Signature crypto.Signature
+}
+
+func setEndorsementMessage(epoch uint64, set crypto.Hash) []byte {
+	bytes := []byte("validators")
+	util.PutUint64(epoch, &bytes)
+	util.PutHash(set, &bytes)
+	return bytes
+}
+
+func NewSetEndorsement(set *ValidatorSet, credentials crypto.PrivateKey) *SetEndorsement {
+	hash := set.Hash()
+	return &SetEndorsement{
+		Epoch:     set.Epoch,
+		Set:       hash,
+		Token:     credentials.PublicKey(),
+		Signature: credentials.Sign(setEndorsementMessage(set.Epoch, hash)),
+	}
+}
+
+func (s *SetEndorsement) Verify() bool {
+	return s.Token.Verify(setEndorsementMessage(s.Epoch, s.Set), s.Signature)
+}
+
+func (s *SetEndorsement) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(s.Epoch, &bytes)
+	util.PutHash(s.Set, &bytes)
+	util.PutToken(s.Token, &bytes)
+	util.PutSignature(s.Signature, &bytes)
+	return bytes
+}
+
+func ParseSetEndorsement(data []byte) *SetEndorsement {
+	position := 0
+	var endorsement SetEndorsement
+	endorsement.Epoch, position = util.ParseUint64(data, position)
+	endorsement.Set, position = util.ParseHash(data, position)
+	endorsement.Token, position = util.ParseToken(data, position)
+	endorsement.Signature, position = util.ParseSignature(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &endorsement
+}
+
+// SetCertificate aggregates endorsements of a validator set. A certificate
+// signed by more than two thirds of the set in charge of the checkpoint epoch,
+// the outgoing set, hands the chain over to the new set: it is the proof
+// listeners require before following a rotation.
+type SetCertificate struct {
+	Set          *ValidatorSet
+	Endorsements []SetEndorsement
+}
+
+func NewSetCertificate(set *ValidatorSet) *SetCertificate {
+	return &SetCertificate{
+		Set:          set,
+		Endorsements: make([]SetEndorsement, 0),
+	}
+}
+
+// Append incorporates a valid endorsement of the certified set. Repeated
+// endorsements of the same token are ignored.
+func (s *SetCertificate) Append(endorsement *SetEndorsement) bool {
+	if endorsement.Epoch != s.Set.Epoch || !endorsement.Set.Equal(s.Set.Hash()) {
+		return false
+	}
+	for _, existing := range s.Endorsements {
+		if existing.Token.Equal(endorsement.Token) {
+			return false
+		}
+	}
+	if !endorsement.Verify() {
+		return false
+	}
+	s.Endorsements = append(s.Endorsements, *endorsement)
+	return true
+}
+
+// Verify checks if the certificate holds valid endorsements of more than two
+// thirds of the members of the committee in charge of the checkpoint epoch. It
+// is safe to call on a nil certificate.
+func (s *SetCertificate) Verify(committee Committee) bool {
+	if s == nil || s.Set == nil || committee == nil {
+		return false
+	}
+	members := committee.Members(s.Set.Epoch)
+	if len(members) == 0 {
+		return false
+	}
+	hash := s.Set.Hash()
+	endorsed := make(map[crypto.Token]struct{})
+	for _, endorsement := range s.Endorsements {
+		if endorsement.Epoch != s.Set.Epoch || !endorsement.Set.Equal(hash) {
+			return false
+		}
+		if endorsement.Verify() {
+			endorsed[endorsement.Token] = struct{}{}
+		}
+	}
+	return hasQuorum(members, endorsed)
+}
+
+func (s *SetCertificate) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutByteArray(s.Set.Serialize(), &bytes)
+	util.PutUint32(uint32(len(s.Endorsements)), &bytes)
+	for _, endorsement := range s.Endorsements {
+		util.PutToken(endorsement.Token, &bytes)
+		util.PutSignature(endorsement.Signature, &bytes)
+	}
+	return bytes
+}
+
+func ParseSetCertificate(data []byte) *SetCertificate {
+	var certificate SetCertificate
+	var set []byte
+	var count uint32
+	set, position := util.ParseByteArray(data, 0)
+	if position > len(data) {
+		return nil
+	}
+	if certificate.Set = ParseValidatorSet(set); certificate.Set == nil {
+		return nil
+	}
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.TokenSize+crypto.SignatureSize) != len(data) {
+		return nil
+	}
+	hash := certificate.Set.Hash()
+	certificate.Endorsements = make([]SetEndorsement, int(count))
+	for n := 0; n < int(count); n++ {
+		endorsement := SetEndorsement{Epoch: certificate.Set.Epoch, Set: hash}
+		endorsement.Token, position = util.ParseToken(data, position)
+		endorsement.Signature, position = util.ParseSignature(data, position)
+		certificate.Endorsements[n] = endorsement
+	}
+	return &certificate
+}
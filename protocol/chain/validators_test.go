@@ -0,0 +1,77 @@
+package chain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestValidatorSet(t *testing.T) {
+	tokens := make([]crypto.Token, 5)
+	for n := range tokens {
+		tokens[n], _ = crypto.RandomAsymetricKey()
+	}
+	deposits := map[crypto.Token]uint64{tokens[0]: 50, tokens[1]: 200, tokens[2]: 100, tokens[3]: 200, tokens[4]: 100}
+	stake := func(token crypto.Token) uint64 {
+		return deposits[token]
+	}
+	set := NewValidatorSet(CheckpointInterval, tokens, stake, SetRule{MinStake: 100, MaxSize: 3})
+	if len(set.Members) != 3 || set.IsMember(tokens[0]) {
+		t.Fatalf("unexpected validator set size: %v", len(set.Members))
+	}
+	first, second := tokens[1], tokens[3]
+	if bytes.Compare(first[:], second[:]) > 0 {
+		first, second = second, first
+	}
+	if !set.Members[0].Equal(first) || !set.Members[1].Equal(second) || set.Stakes[2] != 100 {
+		t.Fatal("validators not ranked by deposit and token")
+	}
+	parsed := ParseValidatorSet(set.Serialize())
+	if parsed == nil || parsed.Epoch != set.Epoch || len(parsed.Members) != 3 || !parsed.Members[2].Equal(set.Members[2]) {
+		t.Fatal("validator set serialization failed")
+	}
+
+	genesis := &ValidatorSet{Members: tokens}
+	rotation := NewRotation(genesis)
+	if !rotation.Append(set) || rotation.Append(parsed) {
+		t.Fatal("validator set appended out of order")
+	}
+	if len(rotation.Members(CheckpointInterval)) != 5 || len(rotation.Members(CheckpointInterval+1)) != 3 {
+		t.Fatal("validator set in charge before its checkpoint")
+	}
+}
+
+func TestSetCertificate(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	tokens := make([]crypto.Token, 4)
+	for n := range keys {
+		tokens[n], keys[n] = crypto.RandomAsymetricKey()
+	}
+	rotation := NewRotation(&ValidatorSet{Members: tokens[:3], Stakes: make([]uint64, 3)})
+	set := &ValidatorSet{Epoch: CheckpointInterval, Members: tokens[1:], Stakes: []uint64{1, 1, 1}}
+	certificate := NewSetCertificate(set)
+	// the incoming validator 3 does not count for the outgoing set
+	for _, n := range []int{0, 3} {
+		if !certificate.Append(NewSetEndorsement(set, keys[n])) {
+			t.Fatal("valid endorsement rejected")
+		}
+	}
+	if certificate.Verify(rotation) {
+		t.Fatal("set certified without a quorum of the outgoing set")
+	}
+	other := &ValidatorSet{Epoch: CheckpointInterval, Members: tokens[:1], Stakes: []uint64{1}}
+	if certificate.Append(NewSetEndorsement(other, keys[1])) {
+		t.Fatal("endorsement of another set appended")
+	}
+	certificate.Append(NewSetEndorsement(set, keys[1]))
+	certificate.Append(NewSetEndorsement(set, keys[2]))
+	parsed := ParseSetCertificate(certificate.Serialize())
+	if !parsed.Verify(rotation) || !rotation.Append(parsed.Set) {
+		t.Fatal("set not certified by a quorum of the outgoing set")
+	}
+	stranger, _ := crypto.RandomAsymetricKey()
+	if parsed.Verify(NewRotation(&ValidatorSet{Members: []crypto.Token{tokens[0], stranger}, Stakes: make([]uint64, 2)})) {
+		t.Fatal("set certified by another committee")
+	}
+}
@@ -0,0 +1,170 @@
+package chain
+
+import (
+	"errors"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// ViewChange is the request of a validator to replace the proposer of a
+// stalled epoch. View counts the proposers replaced for the epoch: the
+// proposer of view n is the n-th validator after the one scheduled.
+type ViewChange struct {
+	Epoch     uint64
+	View      uint64
+	Token     crypto.Token
+	Signature crypto.Signature
+}
+
+func viewChangeMessage(epoch, view uint64) []byte {
+	bytes := []byte("view")
+	util.PutUint64(epoch, &bytes)
+	util.PutUint64(view, &bytes)
+	return bytes
+}
+
+func NewViewChange(epoch, view uint64, credentials crypto.PrivateKey) *ViewChange {
+	return &ViewChange{
+		Epoch:     epoch,
+		View:      view,
+		Token:     credentials.PublicKey(),
+		Signature: credentials.Sign(viewChangeMessage(epoch, view)),
+	}
+}
+
+func (v *ViewChange) Verify() bool {
+	return v.Token.Verify(viewChangeMessage(v.Epoch, v.View), v.Signature)
+}
+
+func (v *ViewChange) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(v.Epoch, &bytes)
+	util.PutUint64(v.View, &bytes)
+	util.PutToken(v.Token, &bytes)
+	util.PutSignature(v.Signature, &bytes)
+	return bytes
+}
+
+func ParseViewChange(data []byte) *ViewChange {
+	position := 0
+	var change ViewChange
+	change.Epoch, position = util.ParseUint64(data, position)
+	change.View, position = util.ParseUint64(data, position)
+	change.Token, position = util.ParseToken(data, position)
+	change.Signature, position = util.ParseSignature(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &change
+}
+
+// ViewCertificate aggregates view change requests of validators for the same
+// epoch and view. A certificate signed by more than two thirds of the
+// committee of the epoch entitles the proposer of the view to replace the
+// scheduled one.
+type ViewCertificate struct {
+	Epoch   uint64
+	View    uint64
+	Changes []ViewChange
+}
+
+func NewViewCertificate(epoch, view uint64) *ViewCertificate {
+	return &ViewCertificate{
+		Epoch:   epoch,
+		View:    view,
+		Changes: make([]ViewChange, 0),
+	}
+}
+
+// Append incorporates a valid request for the certified view. Repeated
+// requests of the same token are ignored.
+func (v *ViewCertificate) Append(change *ViewChange) bool {
+	if change.Epoch != v.Epoch || change.View != v.View {
+		return false
+	}
+	for _, existing := range v.Changes {
+		if existing.Token.Equal(change.Token) {
+			return false
+		}
+	}
+	if !change.Verify() {
+		return false
+	}
+	v.Changes = append(v.Changes, *change)
+	return true
+}
+
+// Verify checks if the certificate holds valid requests of more than two
+// thirds of the members of the committee.
+func (v *ViewCertificate) Verify(committee Committee) bool {
+	members := committee.Members(v.Epoch)
+	if len(members) == 0 {
+		return false
+	}
+	requested := make(map[crypto.Token]struct{})
+	for _, change := range v.Changes {
+		if change.Epoch != v.Epoch || change.View != v.View {
+			return false
+		}
+		if change.Verify() {
+			requested[change.Token] = struct{}{}
+		}
+	}
+	return hasQuorum(members, requested)
+}
+
+func (v *ViewCertificate) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(v.Epoch, &bytes)
+	util.PutUint64(v.View, &bytes)
+	util.PutUint32(uint32(len(v.Changes)), &bytes)
+	for _, change := range v.Changes {
+		util.PutToken(change.Token, &bytes)
+		util.PutSignature(change.Signature, &bytes)
+	}
+	return bytes
+}
+
+func ParseViewCertificate(data []byte) *ViewCertificate {
+	position := 0
+	var certificate ViewCertificate
+	var count uint32
+	certificate.Epoch, position = util.ParseUint64(data, position)
+	certificate.View, position = util.ParseUint64(data, position)
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.TokenSize+crypto.SignatureSize) != len(data) {
+		return nil
+	}
+	certificate.Changes = make([]ViewChange, int(count))
+	for n := 0; n < int(count); n++ {
+		change := ViewChange{Epoch: certificate.Epoch, View: certificate.View}
+		change.Token, position = util.ParseToken(data, position)
+		change.Signature, position = util.ParseSignature(data, position)
+		certificate.Changes[n] = change
+	}
+	return &certificate
+}
+
+// ChangeView replaces stalled, the proposer of the epoch subsequent to the last
+// commit, by the proposer of the certified view. As on a rollover to the last
+// commit, the live block and the blocks sealed for the epoch are discarded. If
+// the chain has a committee the certificate must be signed by a quorum of it.
+func (c *Chain) ChangeView(certificate *ViewCertificate, stalled crypto.Token) error {
+	if certificate.Epoch != c.LastCommitEpoch+1 {
+		return errors.New("view change for an epoch other than the next commit")
+	}
+	if certificate.View <= c.View {
+		return errors.New("view change to a past view")
+	}
+	if c.Committee != nil && !certificate.Verify(c.Committee) {
+		return errors.New("view change without a quorum")
+	}
+	if err := c.RolloverBlock(c.LastCommitEpoch); err != nil {
+		return err
+	}
+	c.LiveBlock = nil
+	c.View = certificate.View
+	c.live(certificate.Epoch, stalled).Missed += 1
+	return nil
+}
@@ -0,0 +1,215 @@
+// Package genesis defines the specification of the genesis of a breeze
+// network: initial balances, initial validator set and protocol parameters.
+//
+// Every node of a network must share the same specification. Its hash
+// identifies the network: it is the hash of the genesis block and is checked
+// on the handshake of every connection.
+package genesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
+	"github.com/lienkolabs/breeze/util"
+)
+
+const (
+	DefaultBlockInterval    = 1000 // milliseconds
+	DefaultMaxProtocolEpoch = 100
+	DefaultUnbondingPeriod  = chain.CheckpointInterval // epochs
+)
+
+// Allocation is an initial wallet and deposit balance of a token.
+type Allocation struct {
+	Token   string `json:"token"`
+	Wallet  uint64 `json:"wallet"`
+	Deposit uint64 `json:"deposit"`
+}
+
+// Validator is a member of the initial validator set. Address is the
+// host:port of its block broadcast service and Peer the host:port of its
+// peer-to-peer service. Addresses are not part of the genesis hash.
+type Validator struct {
+	Token   string `json:"token"`
+	Address string `json:"address"`
+	Peer    string `json:"peer"`
+}
+
+// Rotation is the rule selecting the validator set among genesis validators
+// out of their deposits at each checkpoint. Validators with a deposit below
+// MinStake are left out and at most MaxSize of them, zero for no limit, are
+// selected.
+type Rotation struct {
+	MinStake uint64 `json:"minStake"`
+	MaxSize  int    `json:"maxSize"`
+}
+
+// Spec is the genesis specification. BlockInterval is in milliseconds.
+// Validators are ordered: proof-of-authority proposer duty follows their
+// order. Without Rotation every validator validates forever. UnbondingPeriod
+// is the number of epochs withdrawn deposits take to be credited back to
+// wallets, DefaultUnbondingPeriod if not set.
+type Spec struct {
+	Allocations      []Allocation `json:"allocations"`
+	Validators       []Validator  `json:"validators"`
+	BlockInterval    int          `json:"blockInterval"`
+	MaxProtocolEpoch uint64       `json:"maxProtocolEpoch"`
+	Rotation         *Rotation    `json:"rotation,omitempty"`
+	UnbondingPeriod  uint64       `json:"unbondingPeriod,omitempty"`
+}
+
+// Default returns the specification of a network where token holds every
+// initial balance and is the only validator.
+func Default(token crypto.Token) *Spec {
+	return &Spec{
+		Allocations:      []Allocation{{Token: token.String(), Wallet: 1e9, Deposit: 1e9}},
+		Validators:       []Validator{{Token: token.String()}},
+		BlockInterval:    DefaultBlockInterval,
+		MaxProtocolEpoch: DefaultMaxProtocolEpoch,
+	}
+}
+
+// Load reads and validates a specification from a JSON file. Missing protocol
+// parameters are set to their defaults.
+func Load(filePath string) (*Spec, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read genesis file: %v", err)
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("could not parse genesis file: %v", err)
+	}
+	if spec.BlockInterval == 0 {
+		spec.BlockInterval = DefaultBlockInterval
+	}
+	if spec.MaxProtocolEpoch == 0 {
+		spec.MaxProtocolEpoch = DefaultMaxProtocolEpoch
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+func validToken(token string) bool {
+	return !crypto.TokenFromString(token).Equal(crypto.ZeroToken)
+}
+
+// Validate checks that every token on the specification is valid and that
+// there is at least one validator.
+func (s *Spec) Validate() error {
+	if len(s.Validators) == 0 {
+		return errors.New("genesis must specify at least one validator")
+	}
+	if s.BlockInterval <= 0 {
+		return errors.New("invalid genesis block interval")
+	}
+	seen := make(map[string]struct{})
+	for _, validator := range s.Validators {
+		if !validToken(validator.Token) {
+			return fmt.Errorf("invalid genesis validator token: %v", validator.Token)
+		}
+		if _, ok := seen[validator.Token]; ok {
+			return fmt.Errorf("duplicate genesis validator: %v", validator.Token)
+		}
+		seen[validator.Token] = struct{}{}
+	}
+	for _, allocation := range s.Allocations {
+		if !validToken(allocation.Token) {
+			return fmt.Errorf("invalid genesis allocation token: %v", allocation.Token)
+		}
+	}
+	if s.Rotation != nil && s.Rotation.MaxSize < 0 {
+		return errors.New("invalid genesis rotation size")
+	}
+	return nil
+}
+
+// StateAllocations returns the initial balances in the format of the state.
+func (s *Spec) StateAllocations() []state.Allocation {
+	allocations := make([]state.Allocation, len(s.Allocations))
+	for n, allocation := range s.Allocations {
+		allocations[n] = state.Allocation{
+			Token:   crypto.TokenFromString(allocation.Token),
+			Wallet:  allocation.Wallet,
+			Deposit: allocation.Deposit,
+		}
+	}
+	return allocations
+}
+
+// SetRule returns the rotation rule of the validator set, or nil if the set
+// does not rotate.
+func (s *Spec) SetRule() *chain.SetRule {
+	if s.Rotation == nil {
+		return nil
+	}
+	return &chain.SetRule{MinStake: s.Rotation.MinStake, MaxSize: s.Rotation.MaxSize}
+}
+
+// Committee returns the genesis validators as the committee of the chain, or
+// nil if the validator set rotates: the committee of an epoch then depends on
+// the deposits commited before it.
+func (s *Spec) Committee() chain.Committee {
+	if s.Rotation != nil {
+		return nil
+	}
+	committee := make(chain.StaticCommittee, len(s.Validators))
+	for n, validator := range s.Validators {
+		committee[n] = crypto.TokenFromString(validator.Token)
+	}
+	return committee
+}
+
+// Unbonding returns the unbonding period of withdrawals in epochs.
+func (s *Spec) Unbonding() uint64 {
+	if s.UnbondingPeriod == 0 {
+		return DefaultUnbondingPeriod
+	}
+	return s.UnbondingPeriod
+}
+
+func (s *Spec) Interval() time.Duration {
+	return time.Duration(s.BlockInterval) * time.Millisecond
+}
+
+// Hash of the specification. Allocations are taken in token order, so that
+// their order on the file is irrelevant. Validator addresses are ignored. The
+// rotation rule, if any, and an unbonding period other than the default are
+// appended so that specifications without them keep their hash.
+func (s *Spec) Hash() crypto.Hash {
+	allocations := s.StateAllocations()
+	sort.Slice(allocations, func(i, j int) bool {
+		return bytes.Compare(allocations[i].Token[:], allocations[j].Token[:]) < 0
+	})
+	data := make([]byte, 0)
+	util.PutUint32(uint32(len(allocations)), &data)
+	for _, allocation := range allocations {
+		util.PutToken(allocation.Token, &data)
+		util.PutUint64(allocation.Wallet, &data)
+		util.PutUint64(allocation.Deposit, &data)
+	}
+	util.PutUint32(uint32(len(s.Validators)), &data)
+	for _, validator := range s.Validators {
+		util.PutToken(crypto.TokenFromString(validator.Token), &data)
+	}
+	util.PutUint64(uint64(s.BlockInterval), &data)
+	util.PutUint64(s.MaxProtocolEpoch, &data)
+	if s.Rotation != nil {
+		util.PutUint64(s.Rotation.MinStake, &data)
+		util.PutUint64(uint64(s.Rotation.MaxSize), &data)
+	}
+	if s.Unbonding() != DefaultUnbondingPeriod {
+		util.PutUint64(s.Unbonding(), &data)
+	}
+	return crypto.Hasher(data)
+}
@@ -0,0 +1,49 @@
+package genesis
+
+import (
+	"os"
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestHash(t *testing.T) {
+	first, _ := crypto.RandomAsymetricKey()
+	second, _ := crypto.RandomAsymetricKey()
+	spec := Default(first)
+	spec.Allocations = append(spec.Allocations, Allocation{Token: second.String(), Wallet: 10})
+	reordered := Default(first)
+	reordered.Allocations = []Allocation{spec.Allocations[1], spec.Allocations[0]}
+	reordered.Validators[0].Address = "localhost:5401"
+	if !spec.Hash().Equal(reordered.Hash()) {
+		t.Fatal("genesis hash depends on allocation order or validator address")
+	}
+	reordered.Allocations[0].Deposit = 1
+	if spec.Hash().Equal(reordered.Hash()) {
+		t.Fatal("genesis hash does not depend on allocations")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	token, _ := crypto.RandomAsymetricKey()
+	path := t.TempDir() + "/genesis.json"
+	data := `{"allocations":[{"token":"` + token.String() + `","wallet":5,"deposit":7}],"validators":[{"token":"` + token.String() + `"}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.BlockInterval != DefaultBlockInterval || spec.MaxProtocolEpoch != DefaultMaxProtocolEpoch {
+		t.Fatalf("defaults not applied: %+v", spec)
+	}
+	allocations := spec.StateAllocations()
+	if len(allocations) != 1 || !allocations[0].Token.Equal(token) || allocations[0].Deposit != 7 {
+		t.Fatalf("unexpected allocations: %+v", allocations)
+	}
+	spec.Validators = append(spec.Validators, spec.Validators[0])
+	if spec.Validate() == nil {
+		t.Fatal("duplicate validator accepted")
+	}
+}
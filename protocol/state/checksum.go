@@ -0,0 +1,101 @@
+package state
+
+import (
+	"encoding/binary"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// checksum is an order independent digest over a set of account balances. It
+// is the sum modulo 2^256 of the hash of every (account, balance) pair with
+// positive balance, so that it can be updated incrementally on every credit or
+// debit without traversing the whole wallet.
+type checksum [4]uint64
+
+func balanceTerm(hash crypto.Hash, balance uint64) [4]uint64 {
+	data := hash[:]
+	util.PutUint64(balance, &data)
+	digest := crypto.Hasher(data)
+	var term [4]uint64
+	for n := 0; n < 4; n++ {
+		term[n] = binary.LittleEndian.Uint64(digest[8*n : 8*n+8])
+	}
+	return term
+}
+
+func (c *checksum) add(hash crypto.Hash, balance uint64) {
+	if balance == 0 {
+		return
+	}
+	term := balanceTerm(hash, balance)
+	carry := uint64(0)
+	for n := 0; n < 4; n++ {
+		sum := c[n] + term[n]
+		next := uint64(0)
+		if sum < c[n] {
+			next = 1
+		}
+		sum += carry
+		if sum < carry {
+			next = 1
+		}
+		c[n], carry = sum, next
+	}
+}
+
+func (c *checksum) remove(hash crypto.Hash, balance uint64) {
+	if balance == 0 {
+		return
+	}
+	term := balanceTerm(hash, balance)
+	borrow := uint64(0)
+	for n := 0; n < 4; n++ {
+		diff := c[n] - term[n]
+		next := uint64(0)
+		if c[n] < term[n] {
+			next = 1
+		}
+		if diff < borrow {
+			next = 1
+		}
+		diff -= borrow
+		c[n], borrow = diff, next
+	}
+}
+
+// update replaces the balance of an account on the checksum.
+func (c *checksum) update(hash crypto.Hash, before, after uint64) {
+	if before == after {
+		return
+	}
+	c.remove(hash, before)
+	c.add(hash, after)
+}
+
+func (c checksum) Hash() crypto.Hash {
+	var hash crypto.Hash
+	for n := 0; n < 4; n++ {
+		binary.LittleEndian.PutUint64(hash[8*n:8*n+8], c[n])
+	}
+	return hash
+}
+
+// leavesChecksums returns the checksums of the wallets, the deposits and the
+// sequence numbers of the leaves of a state tree.
+func leavesChecksums(leaves []Leaf) (wallets, deposits, sequences checksum) {
+	for _, leaf := range leaves {
+		wallets.add(leaf.Account, leaf.Wallet)
+		deposits.add(leaf.Account, leaf.Deposit)
+		sequences.add(leaf.Account, leaf.Sequence)
+	}
+	return
+}
+
+func checksumFromHash(hash crypto.Hash) checksum {
+	var c checksum
+	for n := 0; n < 4; n++ {
+		c[n] = binary.LittleEndian.Uint64(hash[8*n : 8*n+8])
+	}
+	return c
+}
@@ -0,0 +1,50 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestChecksum(t *testing.T) {
+	a := crypto.Hasher([]byte("a"))
+	b := crypto.Hasher([]byte("b"))
+	var one, another checksum
+	one.update(a, 0, 10)
+	one.update(b, 0, 5)
+	one.update(a, 10, 7)
+	another.update(b, 0, 5)
+	another.update(a, 0, 7)
+	if one.Hash() != another.Hash() {
+		t.Fatal("checksum depends on the order of updates")
+	}
+	one.update(a, 7, 0)
+	one.update(b, 5, 0)
+	if one.Hash() != (checksum{}).Hash() {
+		t.Fatal("checksum of empty wallet is not zero")
+	}
+	one.update(b, 0, 5)
+	one.update(a, 0, 8)
+	if one.Hash() == another.Hash() {
+		t.Fatal("checksum does not depend on balances")
+	}
+}
+
+func TestWalletChecksum(t *testing.T) {
+	a := crypto.Hasher([]byte("a"))
+	b := crypto.Hasher([]byte("b"))
+	wallet := NewMemoryWalletStore(0, 8)
+	defer wallet.Close()
+	wallet.CreditHash(a, 10)
+	wallet.CreditHash(b, 4)
+	wallet.DebitHash(a, 3)
+	wallet.DebitHash(b, 5) // beyond the balance: ignored
+	wallet.DebitHash(b, 4) // deletes the account
+	wallet.CreditHash(b, 2)
+	var expected checksum
+	expected.update(a, 0, 7)
+	expected.update(b, 0, 2)
+	if wallet.Checksum() != expected.Hash() {
+		t.Fatal("wallet checksum does not match its balances")
+	}
+}
@@ -0,0 +1,160 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+func TestDoubleSignSlashing(t *testing.T) {
+	offender, offenderKey := crypto.RandomAsymetricKey()
+	reporter, reporterKey := crypto.RandomAsymetricKey()
+	s := NewGenesisStateWithAllocations([]Allocation{{Token: offender, Deposit: 1000}, {Token: reporter, Wallet: 10}}, "")
+	first := &chain.Block{Epoch: 1, Proposer: offender, Actions: [][]byte{[]byte("first")}}
+	first.Seal(offenderKey)
+	second := &chain.Block{Epoch: 1, Proposer: offender, Actions: [][]byte{[]byte("second")}}
+	second.Seal(offenderKey)
+	if chain.DoubleSign(first, first) != nil {
+		t.Fatal("evidence out of a single seal")
+	}
+	evidence := chain.DoubleSign(first, second)
+	evidence.TimeStamp = 1
+	evidence.Reporter = reporter
+	evidence.Fee = 1
+	evidence.Sign(reporterKey)
+	data := evidence.Serialize()
+	if actions.ParseDoubleSign(data) == nil {
+		t.Fatal("valid evidence not parsed")
+	}
+
+	validator := s.Validator(s.NewMutations(), 1)
+	if !validator.Validate(data) {
+		t.Fatal("valid evidence rejected")
+	}
+	forged := *evidence
+	forged.Second = forged.First
+	forged.Second.ActionsRoot = crypto.Hasher([]byte("forged"))
+	forged.Sign(reporterKey)
+	if validator.Validate(forged.Serialize()) {
+		t.Fatal("evidence with a forged seal accepted")
+	}
+	evidence.TimeStamp = 2
+	evidence.Sign(reporterKey)
+	if validator.Validate(evidence.Serialize()) {
+		t.Fatal("offender slashed twice")
+	}
+	s.Incorporate(validator, reporter)
+	if _, deposit := s.Deposits.Balance(offender); deposit != 0 {
+		t.Fatalf("unexpected offender deposit: %v", deposit)
+	}
+	if _, balance := s.Wallets.Balance(reporter); balance != 10-1+1000/SlashRewardDivisor {
+		t.Fatalf("unexpected reporter balance: %v", balance)
+	}
+	if !s.Slashed(crypto.HashToken(offender), 1) {
+		t.Fatal("offense not recorded")
+	}
+	if !s.Proof(crypto.HashToken(reporter)).Verify(s.Root()) {
+		t.Fatal("balance proof does not verify against the state root")
+	}
+}
+
+func TestDuplicateEvidence(t *testing.T) {
+	offender, offenderKey := crypto.RandomAsymetricKey()
+	reporter, reporterKey := crypto.RandomAsymetricKey()
+	s := NewGenesisStateWithAllocations([]Allocation{{Token: offender, Deposit: 1000}, {Token: reporter, Wallet: 10}}, "")
+	first := &chain.Block{Epoch: 1, Proposer: offender, Actions: [][]byte{[]byte("first")}}
+	first.Seal(offenderKey)
+	second := &chain.Block{Epoch: 1, Proposer: offender, Actions: [][]byte{[]byte("second")}}
+	second.Seal(offenderKey)
+	submit := func(epoch uint64) []byte {
+		evidence := chain.DoubleSign(first, second)
+		evidence.TimeStamp = epoch
+		evidence.Reporter = reporter
+		evidence.Sign(reporterKey)
+		return evidence.Serialize()
+	}
+
+	before := s.Checksum()
+	validator := s.Validator(s.NewMutations(), 1)
+	if !validator.Validate(submit(1)) {
+		t.Fatal("valid evidence rejected")
+	}
+	root := s.RootAfter(validator, reporter)
+	s.Incorporate(validator, reporter)
+	if s.Root() != root {
+		t.Fatal("state root differs from the root after the block")
+	}
+	if s.Checksum() == before {
+		t.Fatal("checksum unchanged by the slashing")
+	}
+
+	// the offender bonds again: the same evidence must not slash the new deposit
+	validator = s.Validator(s.NewMutations(), 2)
+	validator.(*MutatingState).Deposit(crypto.HashToken(offender), 500)
+	if validator.Validate(submit(2)) {
+		t.Fatal("duplicate evidence accepted")
+	}
+	s.Incorporate(validator, reporter)
+	if _, deposit := s.Deposits.Balance(offender); deposit != 500 {
+		t.Fatalf("unexpected offender deposit: %v", deposit)
+	}
+
+	// a rollback before the slashing clears the offense
+	if err := s.Rollback(0); err != nil {
+		t.Fatal(err)
+	}
+	if s.Slashed(crypto.HashToken(offender), 1) || s.Checksum() != before {
+		t.Fatal("offense not cleared by the rollback")
+	}
+}
+
+func TestSlashingUnbonding(t *testing.T) {
+	offender, offenderKey := crypto.RandomAsymetricKey()
+	reporter, reporterKey := crypto.RandomAsymetricKey()
+	hash := crypto.HashToken(offender)
+	s := NewGenesisStateWithAllocations([]Allocation{{Token: offender, Deposit: 1000}, {Token: reporter, Wallet: 10}}, "")
+	s.UnbondingPeriod = 5
+	first := &chain.Block{Epoch: 1, Proposer: offender, Actions: [][]byte{[]byte("first")}}
+	first.Seal(offenderKey)
+	second := &chain.Block{Epoch: 1, Proposer: offender, Actions: [][]byte{[]byte("second")}}
+	second.Seal(offenderKey)
+	evidence := chain.DoubleSign(first, second)
+	evidence.TimeStamp = 2
+	evidence.Reporter = offender
+	evidence.Sign(offenderKey)
+	if actions.ParseDoubleSign(evidence.Serialize()) != nil {
+		t.Fatal("evidence reported by the offender parsed")
+	}
+	evidence.Reporter = reporter
+	evidence.Sign(reporterKey)
+
+	// the offender withdraws part of its deposit before the evidence
+	validator := s.Validator(s.NewMutations(), 1).(*MutatingState)
+	validator.Unbond(hash, 300)
+	s.Incorporate(validator, reporter)
+	validator = s.Validator(s.NewMutations(), 2).(*MutatingState)
+	validator.Unbond(hash, 200)
+	s.Scheduled = func(epoch uint64, token crypto.Token) bool { return false }
+	if validator.Validate(evidence.Serialize()) {
+		t.Fatal("evidence against a proposer out of schedule accepted")
+	}
+	s.Scheduled = func(epoch uint64, token crypto.Token) bool { return epoch == 1 && token.Equal(offender) }
+	if !validator.Validate(evidence.Serialize()) {
+		t.Fatal("valid evidence rejected")
+	}
+	s.Incorporate(validator, reporter)
+	if _, deposit := s.Deposits.Balance(offender); deposit != 0 || s.Unbonding(hash) != 0 {
+		t.Fatalf("unexpected offender deposit %v and unbonding %v", deposit, s.Unbonding(hash))
+	}
+	if _, balance := s.Wallets.Balance(reporter); balance != 10+1000/SlashRewardDivisor {
+		t.Fatalf("unexpected reporter balance: %v", balance)
+	}
+	for epoch := uint64(3); epoch <= 8; epoch++ {
+		s.Incorporate(s.Validator(s.NewMutations(), epoch), reporter)
+	}
+	if _, balance := s.Wallets.Balance(offender); balance != 0 {
+		t.Fatalf("confiscated withdrawals credited: %v", balance)
+	}
+}
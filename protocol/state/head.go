@@ -0,0 +1,97 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// head is the file where the epoch of the state, the checksums of its wallets
+// and sequence numbers, the withdrawals on their unbonding period and the
+// offenses slashed are persisted after every commit. Balances themselves are
+// persisted by the wallet stores.
+type head struct {
+	file *os.File
+}
+
+func (h *head) save(s *State) error {
+	bytes := make([]byte, 0)
+	util.PutUint64(s.Epoch, &bytes)
+	util.PutHash(s.Wallets.Checksum(), &bytes)
+	util.PutHash(s.Deposits.Checksum(), &bytes)
+	util.PutHash(s.Sequences.Checksum(), &bytes)
+	putUnbonds(s.unbonding, &bytes)
+	putOffenses(s.slashed, &bytes)
+	if err := h.file.Truncate(int64(len(bytes))); err != nil {
+		return fmt.Errorf("could not persist state head: %v", err)
+	}
+	if _, err := h.file.WriteAt(bytes, 0); err != nil {
+		return fmt.Errorf("could not persist state head: %v", err)
+	}
+	return nil
+}
+
+func (h *head) load(s *State) error {
+	data, err := os.ReadFile(h.file.Name())
+	if err != nil {
+		return fmt.Errorf("could not read state head: %v", err)
+	}
+	var wallets, deposits, sequences crypto.Hash
+	position := 0
+	s.Epoch, position = util.ParseUint64(data, position)
+	wallets, position = util.ParseHash(data, position)
+	deposits, position = util.ParseHash(data, position)
+	sequences, position = util.ParseHash(data, position)
+	s.unbonding, position = parseUnbonds(data, position)
+	s.slashed, position = parseOffenses(data, position)
+	if position != len(data) {
+		return errors.New("corrupted state head")
+	}
+	s.Wallets.checksum = checksumFromHash(wallets)
+	s.Deposits.checksum = checksumFromHash(deposits)
+	s.Sequences.checksum = checksumFromHash(sequences)
+	return nil
+}
+
+// OpenState resumes the state persisted on filePath. If filePath holds no
+// state a genesis state with the given allocations is created and persisted
+// there. With an empty filePath the genesis state is kept in memory.
+func OpenState(allocations []Allocation, filePath string) (*State, error) {
+	if filePath == "" {
+		return NewGenesisStateWithAllocations(allocations, ""), nil
+	}
+	headPath := fmt.Sprintf("%vstate.dat", filePath)
+	if _, err := os.Stat(headPath); os.IsNotExist(err) {
+		state := NewGenesisStateWithAllocations(allocations, filePath)
+		file, err := os.Create(headPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not create state head: %v", err)
+		}
+		state.head = &head{file: file}
+		return state, state.head.save(state)
+	}
+	file, err := os.OpenFile(headPath, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open state head: %v", err)
+	}
+	state := &State{
+		Wallets:   NewFileWalletStore(fmt.Sprintf("%vwallet.dat", filePath), 0, 8),
+		Deposits:  NewFileWalletStore(fmt.Sprintf("%vdeposit.dat", filePath), 0, 8),
+		Sequences: NewFileWalletStore(fmt.Sprintf("%vsequence.dat", filePath), 0, 8),
+		head:      &head{file: file},
+	}
+	if err := state.head.load(state); err != nil {
+		return nil, err
+	}
+	if state.journal, err = openJournal(fmt.Sprintf("%vjournal.dat", filePath)); err != nil {
+		return nil, err
+	}
+	state.treePath = fmt.Sprintf("%vtree.dat", filePath)
+	if err := state.loadTree(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
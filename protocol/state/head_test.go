@@ -0,0 +1,37 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+)
+
+func TestOpenState(t *testing.T) {
+	path := t.TempDir() + "/"
+	token, _ := crypto.RandomAsymetricKey()
+	s, err := OpenState([]Allocation{{Token: token, Wallet: 1e9}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for epoch := uint64(1); epoch <= 5; epoch++ {
+		ms := s.Validator(s.NewMutations(), epoch).(*MutatingState)
+		ms.mutations.DeltaWallets[crypto.HashToken(token)] = -1
+		s.Incorporate(ms, token)
+	}
+	checksum := s.Checksum()
+	s.Shutdown()
+	resumed, err := OpenState([]Allocation{{Token: token, Wallet: 1e9}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Shutdown()
+	if resumed.Epoch != 5 {
+		t.Fatalf("unexpected resumed epoch: %v", resumed.Epoch)
+	}
+	if resumed.Checksum() != checksum {
+		t.Fatal("resumed state checksum does not match")
+	}
+	if len(resumed.journal.entries) != 5 {
+		t.Fatalf("unexpected resumed journal length: %v", len(resumed.journal.entries))
+	}
+}
@@ -0,0 +1,205 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// BalanceChange is the balance of an account after the commit of the block of
+// an epoch.
+type BalanceChange struct {
+	Epoch   uint64
+	Wallet  uint64
+	Deposit uint64
+}
+
+type historyEntry struct {
+	epoch  uint64
+	offset int64 // position of the deltas of the epoch on the file
+}
+
+// History keeps the wallet and deposit deltas of every commited block since a
+// base epoch, so that balances can be queried at any epoch after it. The base
+// is the balance of every account at the epoch the history was opened, genesis
+// or the epoch of an imported snapshot. Deltas are persisted block by block on
+// a file and indexed by account in memory.
+type History struct {
+	entries []historyEntry
+	changes map[crypto.Hash][]BalanceChange // by account, ordered by epoch
+	file    *os.File
+	size    int64
+}
+
+// OpenHistory keeps the balance history of the state on filePath, in memory if
+// filePath is empty. A new history starts at the epoch of the state. A
+// persisted history must be at the epoch of the state: it is then extended on
+// every incorporated block.
+func (s *State) OpenHistory(filePath string) error {
+	h := &History{changes: make(map[crypto.Hash][]BalanceChange)}
+	if filePath != "" {
+		if _, err := os.Stat(filePath); err == nil {
+			if err := h.load(filePath); err != nil {
+				return err
+			}
+			if last := h.entries[len(h.entries)-1].epoch; last != s.Epoch {
+				h.file.Close()
+				return fmt.Errorf("balance history at epoch %v, state at epoch %v", last, s.Epoch)
+			}
+			s.History = h
+			return nil
+		}
+		file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open balance history: %v", err)
+		}
+		h.file = file
+	}
+	wallets, deposits := make(map[crypto.Hash]int), make(map[crypto.Hash]int)
+	for _, leaf := range s.tree.Leaves() {
+		wallets[leaf.Account] = int(leaf.Wallet)
+		deposits[leaf.Account] = int(leaf.Deposit)
+	}
+	if err := h.append(s.Epoch, wallets, deposits); err != nil {
+		return err
+	}
+	s.History = h
+	return nil
+}
+
+func (h *History) load(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("could not read balance history: %v", err)
+	}
+	position := 0
+	for position < len(data) {
+		offset := int64(position)
+		var epoch uint64
+		var wallets, deposits map[crypto.Hash]int
+		epoch, position = util.ParseUint64(data, position)
+		if wallets, position = parseDeltas(data, position); wallets == nil {
+			return errors.New("corrupted balance history")
+		}
+		if deposits, position = parseDeltas(data, position); deposits == nil {
+			return errors.New("corrupted balance history")
+		}
+		if len(h.entries) > 0 && epoch <= h.entries[len(h.entries)-1].epoch {
+			return errors.New("corrupted balance history")
+		}
+		h.entries = append(h.entries, historyEntry{epoch: epoch, offset: offset})
+		h.index(epoch, wallets, deposits)
+	}
+	if position != len(data) || len(h.entries) == 0 {
+		return errors.New("corrupted balance history")
+	}
+	if h.file, err = os.OpenFile(filePath, os.O_RDWR, 0644); err != nil {
+		return fmt.Errorf("could not open balance history: %v", err)
+	}
+	h.size = int64(len(data))
+	return nil
+}
+
+// index records the balances of the accounts changed at the epoch.
+func (h *History) index(epoch uint64, wallets, deposits map[crypto.Hash]int) {
+	changed := make(map[crypto.Hash]struct{})
+	for hash := range wallets {
+		changed[hash] = struct{}{}
+	}
+	for hash := range deposits {
+		changed[hash] = struct{}{}
+	}
+	for hash := range changed {
+		var last BalanceChange
+		if changes := h.changes[hash]; len(changes) > 0 {
+			last = changes[len(changes)-1]
+		}
+		change := BalanceChange{
+			Epoch:   epoch,
+			Wallet:  uint64(int(last.Wallet) + wallets[hash]),
+			Deposit: uint64(int(last.Deposit) + deposits[hash]),
+		}
+		h.changes[hash] = append(h.changes[hash], change)
+	}
+}
+
+// append records the deltas of the block of an epoch.
+func (h *History) append(epoch uint64, wallets, deposits map[crypto.Hash]int) error {
+	h.entries = append(h.entries, historyEntry{epoch: epoch, offset: h.size})
+	h.index(epoch, wallets, deposits)
+	if h.file == nil {
+		return nil
+	}
+	bytes := make([]byte, 0)
+	util.PutUint64(epoch, &bytes)
+	putDeltas(wallets, &bytes)
+	putDeltas(deposits, &bytes)
+	if _, err := h.file.WriteAt(bytes, h.size); err != nil {
+		return fmt.Errorf("could not persist balance history: %v", err)
+	}
+	h.size += int64(len(bytes))
+	return nil
+}
+
+// truncate drops the deltas of the blocks after the given epoch. The base of
+// the history is never dropped.
+func (h *History) truncate(epoch uint64) error {
+	n := len(h.entries)
+	for n > 1 && h.entries[n-1].epoch > epoch {
+		n--
+	}
+	if n == len(h.entries) {
+		return nil
+	}
+	h.size = h.entries[n].offset
+	h.entries = h.entries[:n]
+	for hash, changes := range h.changes {
+		kept := len(changes)
+		for kept > 0 && changes[kept-1].Epoch > epoch {
+			kept--
+		}
+		if kept == 0 {
+			delete(h.changes, hash)
+		} else {
+			h.changes[hash] = changes[:kept]
+		}
+	}
+	if h.file == nil {
+		return nil
+	}
+	if err := h.file.Truncate(h.size); err != nil {
+		return fmt.Errorf("could not persist balance history: %v", err)
+	}
+	return nil
+}
+
+// Epochs returns the first and the last epoch on the history.
+func (h *History) Epochs() (uint64, uint64) {
+	return h.entries[0].epoch, h.entries[len(h.entries)-1].epoch
+}
+
+// Balance returns the wallet and deposit balance of the account with the
+// given hash after the commit of the block of the given epoch.
+func (h *History) Balance(hash crypto.Hash, epoch uint64) (uint64, uint64, error) {
+	if first, last := h.Epochs(); epoch < first || epoch > last {
+		return 0, 0, fmt.Errorf("epoch %v out of balance history from %v to %v", epoch, first, last)
+	}
+	changes := h.changes[hash]
+	n := sort.Search(len(changes), func(i int) bool {
+		return changes[i].Epoch > epoch
+	})
+	if n == 0 {
+		return 0, 0, nil
+	}
+	return changes[n-1].Wallet, changes[n-1].Deposit, nil
+}
+
+func (h *History) close() {
+	if h.file != nil {
+		h.file.Close()
+	}
+}
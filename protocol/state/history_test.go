@@ -0,0 +1,77 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+func TestHistory(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	proposer, _ := crypto.RandomAsymetricKey()
+	path := t.TempDir() + "/"
+	s, err := OpenState([]Allocation{{Token: token, Wallet: 1000, Deposit: 100}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.OpenHistory(path + "history.dat"); err != nil {
+		t.Fatal(err)
+	}
+	block := func(epoch uint64, value uint64) *chain.Block {
+		transfer := actions.Transfer{TimeStamp: epoch, From: token, To: []crypto.TokenValue{{Token: receiver, Value: value}}, Fee: 1}
+		transfer.Sign(key)
+		return &chain.Block{Epoch: epoch, Proposer: proposer, Actions: [][]byte{transfer.Serialize()}}
+	}
+	for epoch := uint64(1); epoch <= 5; epoch++ {
+		if err := s.Replay(block(epoch, 10*epoch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, receiverHash := crypto.HashToken(token), crypto.HashToken(receiver)
+	check := func(history *History) {
+		for epoch := uint64(0); epoch <= 5; epoch++ {
+			received := 5 * epoch * (epoch + 1)
+			if wallet, deposit, err := history.Balance(hash, epoch); err != nil || wallet != 1000-received-epoch || deposit != 100 {
+				t.Fatalf("unexpected balance at epoch %v: %v %v %v", epoch, wallet, deposit, err)
+			}
+			if wallet, _, _ := history.Balance(receiverHash, epoch); wallet != received {
+				t.Fatalf("unexpected receiver balance at epoch %v: %v", epoch, wallet)
+			}
+		}
+		if _, _, err := history.Balance(hash, 6); err == nil {
+			t.Fatal("balance known after the last epoch")
+		}
+	}
+	check(s.History)
+
+	invalid := block(6, 1)
+	invalid.StateRoot = crypto.Hasher([]byte("root"))
+	if s.Replay(invalid) == nil {
+		t.Fatal("block with a wrong state root replayed")
+	}
+	if s.Epoch != 5 {
+		t.Fatalf("state not reverted: epoch %v", s.Epoch)
+	}
+	check(s.History)
+	if err := s.Replay(block(6, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rollback(5); err != nil {
+		t.Fatal(err)
+	}
+	check(s.History)
+	s.Shutdown()
+
+	resumed, err := OpenState(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Shutdown()
+	if err := resumed.OpenHistory(path + "history.dat"); err != nil {
+		t.Fatal(err)
+	}
+	check(resumed.History)
+}
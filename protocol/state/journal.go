@@ -0,0 +1,189 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// journal keeps the mutations incorporated into the state since the last
+// checkpoint epoch. Together with the current state it amounts to a snapshot
+// of the state at the checkpoint: reverting the journal restores it. If a file
+// is provided the journal is persisted alongside the wallet stores.
+type journal struct {
+	checkpoint uint64
+	entries    []*Mutations
+	file       *os.File
+}
+
+func newJournal(filePath string) (*journal, error) {
+	j := &journal{entries: make([]*Mutations, 0)}
+	if filePath == "" {
+		return j, nil
+	}
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open state journal: %v", err)
+	}
+	j.file = file
+	if err := j.persist(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// openJournal loads a journal persisted on filePath.
+func openJournal(filePath string) (*journal, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read state journal: %v", err)
+	}
+	j := &journal{entries: make([]*Mutations, 0)}
+	position := 0
+	j.checkpoint, position = util.ParseUint64(data, position)
+	for position < len(data) {
+		var m *Mutations
+		if m, position = parseMutations(data, position); m == nil {
+			return nil, errors.New("corrupted state journal")
+		}
+		j.entries = append(j.entries, m)
+	}
+	if position != len(data) {
+		return nil, errors.New("corrupted state journal")
+	}
+	if j.file, err = os.OpenFile(filePath, os.O_RDWR, 0644); err != nil {
+		return nil, fmt.Errorf("could not open state journal: %v", err)
+	}
+	if _, err := j.file.Seek(0, 2); err != nil {
+		return nil, fmt.Errorf("could not open state journal: %v", err)
+	}
+	return j, nil
+}
+
+// append records the mutations incorporated at an epoch. At checkpoint epochs
+// the journal is reset since the state itself is the new snapshot.
+func (j *journal) append(m *Mutations) error {
+	if chain.IsCheckpoint(m.Epoch) {
+		j.checkpoint = m.Epoch
+		j.entries = make([]*Mutations, 0)
+		return j.persist()
+	}
+	j.entries = append(j.entries, m)
+	if j.file == nil {
+		return nil
+	}
+	if _, err := j.file.Write(m.Serialize()); err != nil {
+		return fmt.Errorf("could not persist state journal: %v", err)
+	}
+	return nil
+}
+
+// revert returns the journal entries after the given epoch, latest first, and
+// drops them from the journal.
+func (j *journal) revert(epoch uint64) ([]*Mutations, error) {
+	if epoch < j.checkpoint {
+		return nil, errors.New("cannot revert state before the last checkpoint")
+	}
+	reverted := make([]*Mutations, 0)
+	for len(j.entries) > 0 && j.entries[len(j.entries)-1].Epoch > epoch {
+		reverted = append(reverted, j.entries[len(j.entries)-1])
+		j.entries = j.entries[:len(j.entries)-1]
+	}
+	return reverted, j.persist()
+}
+
+func (j *journal) persist() error {
+	if j.file == nil {
+		return nil
+	}
+	bytes := make([]byte, 0)
+	util.PutUint64(j.checkpoint, &bytes)
+	for _, entry := range j.entries {
+		bytes = append(bytes, entry.Serialize()...)
+	}
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("could not persist state journal: %v", err)
+	}
+	if _, err := j.file.Seek(0, 0); err != nil {
+		return fmt.Errorf("could not persist state journal: %v", err)
+	}
+	if _, err := j.file.Write(bytes); err != nil {
+		return fmt.Errorf("could not persist state journal: %v", err)
+	}
+	return nil
+}
+
+func (j *journal) close() {
+	if j.file != nil {
+		j.file.Close()
+	}
+}
+
+func putDeltas(deltas map[crypto.Hash]int, data *[]byte) {
+	util.PutUint32(uint32(len(deltas)), data)
+	for hash, delta := range deltas {
+		util.PutHash(hash, data)
+		util.PutUint64(uint64(int64(delta)), data)
+	}
+}
+
+func (m *Mutations) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(m.Epoch, &bytes)
+	putDeltas(m.DeltaWallets, &bytes)
+	putDeltas(m.DeltaDeposits, &bytes)
+	putDeltas(m.DeltaSequences, &bytes)
+	putUnbonds(m.Unbonds, &bytes)
+	putUnbonds(m.Released, &bytes)
+	putOffenses(m.Slashed, &bytes)
+	putOffenses(m.Pardoned, &bytes)
+	return bytes
+}
+
+func parseDeltas(data []byte, position int) (map[crypto.Hash]int, int) {
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.Size+8) > len(data) {
+		return nil, len(data) + 1
+	}
+	deltas := make(map[crypto.Hash]int, int(count))
+	for n := 0; n < int(count); n++ {
+		var hash crypto.Hash
+		var delta uint64
+		hash, position = util.ParseHash(data, position)
+		delta, position = util.ParseUint64(data, position)
+		deltas[hash] = int(int64(delta))
+	}
+	return deltas, position
+}
+
+func parseMutations(data []byte, position int) (*Mutations, int) {
+	m := &Mutations{}
+	m.Epoch, position = util.ParseUint64(data, position)
+	if m.DeltaWallets, position = parseDeltas(data, position); m.DeltaWallets == nil {
+		return nil, position
+	}
+	if m.DeltaDeposits, position = parseDeltas(data, position); m.DeltaDeposits == nil {
+		return nil, position
+	}
+	if m.DeltaSequences, position = parseDeltas(data, position); m.DeltaSequences == nil {
+		return nil, position
+	}
+	if m.Unbonds, position = parseUnbonds(data, position); m.Unbonds == nil {
+		return nil, position
+	}
+	if m.Released, position = parseUnbonds(data, position); m.Released == nil {
+		return nil, position
+	}
+	if m.Slashed, position = parseOffenses(data, position); m.Slashed == nil {
+		return nil, position
+	}
+	if m.Pardoned, position = parseOffenses(data, position); m.Pardoned == nil {
+		return nil, position
+	}
+	return m, position
+}
@@ -0,0 +1,37 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+func TestRollback(t *testing.T) {
+	s, key := NewGenesisState()
+	defer s.Shutdown()
+	token := key.PublicKey()
+	other := crypto.Hasher([]byte("other"))
+	var checksum crypto.Hash
+	for epoch := uint64(1); epoch <= chain.CheckpointInterval+10; epoch++ {
+		ms := s.Validator(s.NewMutations(), epoch).(*MutatingState)
+		ms.mutations.DeltaWallets[crypto.HashToken(token)] = -1
+		ms.mutations.DeltaWallets[other] = 1
+		s.Incorporate(ms, token)
+		if epoch == chain.CheckpointInterval {
+			checksum = s.Checksum()
+		}
+	}
+	if err := s.Rollback(chain.CheckpointInterval - 1); err == nil {
+		t.Fatal("rollback before checkpoint accepted")
+	}
+	if err := s.Rollback(chain.CheckpointInterval); err != nil {
+		t.Fatalf("could not rollback: %v", err)
+	}
+	if s.Checksum() != checksum {
+		t.Fatal("rollback did not restore checkpoint state")
+	}
+	if _, balance := s.Wallets.BalanceHash(other); balance != chain.CheckpointInterval {
+		t.Fatalf("unexpected balance after rollback: %v", balance)
+	}
+}
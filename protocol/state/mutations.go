@@ -5,17 +5,32 @@ import (
 	"github.com/lienkolabs/breeze/protocol/chain"
 )
 
+// Mutations are the changes to the state on a block. DeltaSequences counts
+// the sequenced actions of each account. Unbonds are withdrawals of deposit
+// entering their unbonding period and Released are the unbonds credited back
+// to wallets or confiscated by a slash. Slashed are the offenses slashed on the
+// block and Pardoned the offenses cleared by reversed mutations.
 type Mutations struct {
-	Epoch         uint64
-	DeltaWallets  map[crypto.Hash]int
-	DeltaDeposits map[crypto.Hash]int
+	Epoch          uint64
+	DeltaWallets   map[crypto.Hash]int
+	DeltaDeposits  map[crypto.Hash]int
+	DeltaSequences map[crypto.Hash]int
+	Unbonds        []Unbond
+	Released       []Unbond
+	Slashed        []Offense
+	Pardoned       []Offense
 }
 
 func NewMutations(epoch uint64) *Mutations {
 	return &Mutations{
-		Epoch:         epoch,
-		DeltaWallets:  make(map[crypto.Hash]int),
-		DeltaDeposits: make(map[crypto.Hash]int),
+		Epoch:          epoch,
+		DeltaWallets:   make(map[crypto.Hash]int),
+		DeltaDeposits:  make(map[crypto.Hash]int),
+		DeltaSequences: make(map[crypto.Hash]int),
+		Unbonds:        make([]Unbond, 0),
+		Released:       make([]Unbond, 0),
+		Slashed:        make([]Offense, 0),
+		Pardoned:       make([]Offense, 0),
 	}
 }
 
@@ -56,6 +71,34 @@ func (m *Mutations) Append(array []chain.Mutations) chain.Mutations {
 				grouped.DeltaDeposits[hash] = delta
 			}
 		}
+		for hash, delta := range mutations.DeltaSequences {
+			grouped.DeltaSequences[hash] += delta
+		}
+		grouped.Unbonds = append(grouped.Unbonds, mutations.Unbonds...)
+		grouped.Released = append(grouped.Released, mutations.Released...)
+		for _, offense := range mutations.Slashed {
+			grouped.Slashed = slash(grouped.Slashed, offense)
+		}
+		grouped.Pardoned = append(grouped.Pardoned, mutations.Pardoned...)
 	}
 	return grouped
 }
+
+// Reverse returns mutations that undo the receiver.
+func (m *Mutations) Reverse() *Mutations {
+	reverse := NewMutations(m.Epoch)
+	for hash, delta := range m.DeltaWallets {
+		reverse.DeltaWallets[hash] = -delta
+	}
+	for hash, delta := range m.DeltaDeposits {
+		reverse.DeltaDeposits[hash] = -delta
+	}
+	for hash, delta := range m.DeltaSequences {
+		reverse.DeltaSequences[hash] = -delta
+	}
+	reverse.Unbonds = append(reverse.Unbonds, m.Released...)
+	reverse.Released = append(reverse.Released, m.Unbonds...)
+	reverse.Slashed = append(reverse.Slashed, m.Pardoned...)
+	reverse.Pardoned = append(reverse.Pardoned, m.Slashed...)
+	return reverse
+}
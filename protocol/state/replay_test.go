@@ -0,0 +1,87 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+func TestReplayProtection(t *testing.T) {
+	s, key := NewGenesisState()
+	token := key.PublicKey()
+	blockchain := chain.NewChainFromGenesis(key, s, crypto.Hasher([]byte("genesis")))
+	defer blockchain.Shutdown()
+	receiver, _ := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{TimeStamp: 1, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 10}}}
+	transfer.Sign(key)
+	action := transfer.Serialize()
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		if err := blockchain.NextBlock(epoch, epoch-1, blockchain.LastCommitHash, token); err != nil {
+			t.Fatal(err)
+		}
+		accepted := blockchain.Validate(action)
+		if accepted != (epoch == 1) {
+			t.Fatalf("action accepted %v on epoch %v", accepted, epoch)
+		}
+		if epoch == 1 && blockchain.Validate(action) {
+			t.Fatal("repeated action accepted on the same block")
+		}
+		blockchain.SealOwnBlock()
+		if err := blockchain.CommitOwnBlock(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, balance := s.Wallets.Balance(receiver); balance != 10 {
+		t.Fatalf("unexpected balance: %v", balance)
+	}
+}
+
+func TestReplayProtectionOnRestart(t *testing.T) {
+	path := t.TempDir() + "/"
+	token, key := crypto.RandomAsymetricKey()
+	allocations := []Allocation{{Token: token, Wallet: 1000}}
+	genesis := crypto.Hasher([]byte("genesis"))
+	s, err := OpenState(allocations, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain, err := chain.OpenChain(key, s, genesis, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, _ := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{TimeStamp: 1, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 10}}}
+	transfer.Sign(key)
+	action := transfer.Serialize()
+	commit := func(blockchain *chain.Chain, epoch uint64) bool {
+		if err := blockchain.NextBlock(epoch, epoch-1, blockchain.LastCommitHash, token); err != nil {
+			t.Fatal(err)
+		}
+		accepted := blockchain.Validate(action)
+		blockchain.SealOwnBlock()
+		if err := blockchain.CommitOwnBlock(nil); err != nil {
+			t.Fatal(err)
+		}
+		return accepted
+	}
+	if !commit(blockchain, 1) {
+		t.Fatal("action rejected")
+	}
+	commit(blockchain, 2)
+	blockchain.Shutdown()
+
+	s, err = OpenState(allocations, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := chain.OpenChain(key, s, genesis, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Shutdown()
+	if resumed.Incorporated.IsNew(crypto.Hasher(action), 1, resumed.LastCommitEpoch) {
+		t.Fatal("action incorporated before the restart is new to the resumed chain")
+	}
+}
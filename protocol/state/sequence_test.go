@@ -0,0 +1,64 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+)
+
+func TestSequence(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	path := t.TempDir() + "/"
+	s, err := OpenState([]Allocation{{Token: token, Wallet: 1000}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := func(epoch, sequence uint64) []byte {
+		action := actions.Transfer{TimeStamp: epoch, Sequence: sequence, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 1}}}
+		action.Sign(key)
+		return action.Serialize()
+	}
+	sequenced := transfer(1, 1)
+	if parsed := actions.ParseTransfer(sequenced); parsed == nil || parsed.Sequence != 1 || parsed.TimeStamp != 1 {
+		t.Fatal("sequenced transfer not parsed")
+	}
+	tampered := append([]byte{}, sequenced...)
+	tampered[0] = 0
+	if actions.ParseAction(tampered) != nil {
+		t.Fatal("sequence stripped from a signed transfer")
+	}
+
+	validator := s.Validator(s.NewMutations(), 1)
+	if validator.Validate(transfer(1, 2)) {
+		t.Fatal("out of order sequence accepted")
+	}
+	if !validator.Validate(transfer(1, 1)) || !validator.Validate(transfer(1, 2)) {
+		t.Fatal("valid sequences rejected")
+	}
+	if validator.Validate(transfer(1, 2)) {
+		t.Fatal("reused sequence accepted")
+	}
+	if validator.Validate(transfer(1, 0)) {
+		t.Fatal("unsequenced action accepted after a sequenced one")
+	}
+	s.Incorporate(validator, token)
+	checksum := s.Checksum()
+	s.Shutdown()
+
+	resumed, err := OpenState(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Shutdown()
+	if resumed.Checksum() != checksum {
+		t.Fatal("resumed state checksum does not match")
+	}
+	if err := resumed.Rollback(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, sequence := resumed.Sequences.Balance(token); sequence != 0 {
+		t.Fatalf("unexpected sequence after rollback: %v", sequence)
+	}
+}
@@ -0,0 +1,126 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Offense is a double sign of Account on the block of Epoch for which it was
+// slashed. An offense is slashed only once, whatever the deposit of the
+// offender at the time the evidence is submitted again.
+type Offense struct {
+	Account crypto.Hash
+	Epoch   uint64
+}
+
+func (o Offense) less(other Offense) bool {
+	if cmp := bytes.Compare(o.Account[:], other.Account[:]); cmp != 0 {
+		return cmp < 0
+	}
+	return o.Epoch < other.Epoch
+}
+
+// Slashed returns true if the account with the given hash was slashed for a
+// double sign on the block of the given epoch.
+func (s *State) Slashed(hash crypto.Hash, epoch uint64) bool {
+	return containsOffense(s.slashed, Offense{Account: hash, Epoch: epoch})
+}
+
+// slashedAccount returns true if one of offenses is of the given account.
+func slashedAccount(offenses []Offense, account crypto.Hash) bool {
+	for _, offense := range offenses {
+		if offense.Account == account {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOffense(offenses []Offense, offense Offense) bool {
+	n := sort.Search(len(offenses), func(i int) bool {
+		return !offenses[i].less(offense)
+	})
+	return n < len(offenses) && offenses[n] == offense
+}
+
+// slash keeps offenses ordered by account and epoch, so that every node with
+// the same commited state has the same offenses.
+func slash(offenses []Offense, offense Offense) []Offense {
+	n := sort.Search(len(offenses), func(i int) bool {
+		return !offenses[i].less(offense)
+	})
+	if n < len(offenses) && offenses[n] == offense {
+		return offenses
+	}
+	offenses = append(offenses, Offense{})
+	copy(offenses[n+1:], offenses[n:])
+	offenses[n] = offense
+	return offenses
+}
+
+func pardon(offenses []Offense, offense Offense) []Offense {
+	for n, existing := range offenses {
+		if existing == offense {
+			return append(offenses[:n], offenses[n+1:]...)
+		}
+	}
+	return offenses
+}
+
+// withOffenses returns a copy of offenses with the given ones added.
+func withOffenses(offenses []Offense, added []Offense) []Offense {
+	all := make([]Offense, len(offenses), len(offenses)+len(added))
+	copy(all, offenses)
+	for _, offense := range added {
+		all = slash(all, offense)
+	}
+	return all
+}
+
+// stateRoot combines the root of the state tree with the checksum of the
+// slashed offenses. The root of a state without offenses is the root of its
+// tree.
+func stateRoot(tree, offenses crypto.Hash) crypto.Hash {
+	if offenses == crypto.ZeroValueHash {
+		return tree
+	}
+	data := []byte{2}
+	util.PutHash(tree, &data)
+	util.PutHash(offenses, &data)
+	return crypto.Hasher(data)
+}
+
+// offensesHash is the checksum of offenses, zero if there are none.
+func offensesHash(offenses []Offense) crypto.Hash {
+	if len(offenses) == 0 {
+		return crypto.ZeroValueHash
+	}
+	data := make([]byte, 0)
+	putOffenses(offenses, &data)
+	return crypto.Hasher(data)
+}
+
+func putOffenses(offenses []Offense, data *[]byte) {
+	util.PutUint32(uint32(len(offenses)), data)
+	for _, offense := range offenses {
+		util.PutHash(offense.Account, data)
+		util.PutUint64(offense.Epoch, data)
+	}
+}
+
+func parseOffenses(data []byte, position int) ([]Offense, int) {
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.Size+8) > len(data) {
+		return nil, len(data) + 1
+	}
+	offenses := make([]Offense, int(count))
+	for n := range offenses {
+		offenses[n].Account, position = util.ParseHash(data, position)
+		offenses[n].Epoch, position = util.ParseUint64(data, position)
+	}
+	return offenses, position
+}
@@ -0,0 +1,252 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Snapshot is a portable copy of the state commited at an epoch together with
+// the head of the chain at that epoch: the hash of the last commited block and
+// the rolling hash of every commited block up to it. A snapshot taken at a
+// checkpoint epoch is enough for a new node to join the network without
+// replaying the chain from genesis.
+type Snapshot struct {
+	Epoch     uint64
+	BlockHash crypto.Hash
+	ChainHash crypto.Hash
+	Accounts  []Leaf
+	Unbonding []Unbond
+	Slashed   []Offense
+}
+
+// Snapshot returns a snapshot of the commited state on the given chain head.
+func (s *State) Snapshot(blockHash, chainHash crypto.Hash) *Snapshot {
+	unbonding := make([]Unbond, len(s.unbonding))
+	copy(unbonding, s.unbonding)
+	slashed := make([]Offense, len(s.slashed))
+	copy(slashed, s.slashed)
+	return &Snapshot{
+		Epoch:     s.Epoch,
+		BlockHash: blockHash,
+		ChainHash: chainHash,
+		Accounts:  s.tree.Leaves(),
+		Unbonding: unbonding,
+		Slashed:   slashed,
+	}
+}
+
+// Checksum returns the checksum of the state on the snapshot, as returned by
+// the Checksum of the state it was taken from.
+func (s *Snapshot) Checksum() crypto.Hash {
+	wallets, deposits, sequences := leavesChecksums(s.Accounts)
+	return stateChecksum(wallets.Hash(), deposits.Hash(), sequences.Hash(), s.Unbonding, s.Slashed)
+}
+
+// Verify checks the snapshot against the digest of a checkpoint. It does not
+// check who signed the checkpoint: see CertifiedSnapshot for that.
+func (s *Snapshot) Verify(checkpoint *chain.Checkpoint) error {
+	if checkpoint == nil {
+		return errors.New("no checkpoint to verify snapshot against")
+	}
+	if s.Epoch != checkpoint.Epoch {
+		return fmt.Errorf("snapshot at epoch %v instead of checkpoint epoch %v", s.Epoch, checkpoint.Epoch)
+	}
+	if s.BlockHash != checkpoint.BlockHash || s.ChainHash != checkpoint.ChainHash {
+		return errors.New("snapshot chain head does not match checkpoint")
+	}
+	if s.Checksum() != checkpoint.StateHash {
+		return errors.New("snapshot state does not match checkpoint")
+	}
+	return nil
+}
+
+func (s *Snapshot) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(s.Epoch, &bytes)
+	util.PutHash(s.BlockHash, &bytes)
+	util.PutHash(s.ChainHash, &bytes)
+	util.PutUint32(uint32(len(s.Accounts)), &bytes)
+	for _, leaf := range s.Accounts {
+		putLeaf(leaf, &bytes)
+	}
+	putUnbonds(s.Unbonding, &bytes)
+	putOffenses(s.Slashed, &bytes)
+	return bytes
+}
+
+func ParseSnapshot(data []byte) *Snapshot {
+	position := 0
+	var snapshot Snapshot
+	snapshot.Epoch, position = util.ParseUint64(data, position)
+	snapshot.BlockHash, position = util.ParseHash(data, position)
+	snapshot.ChainHash, position = util.ParseHash(data, position)
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.Size+24) > len(data) {
+		return nil
+	}
+	snapshot.Accounts = make([]Leaf, int(count))
+	for n := range snapshot.Accounts {
+		snapshot.Accounts[n], position = parseLeaf(data, position)
+	}
+	snapshot.Unbonding, position = parseUnbonds(data, position)
+	snapshot.Slashed, position = parseOffenses(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &snapshot
+}
+
+// Root returns the state root of the snapshot, as returned by the Root of the
+// state it was taken from.
+func (s *Snapshot) Root() crypto.Hash {
+	tree := NewTree()
+	for _, leaf := range s.Accounts {
+		tree.Set(leaf)
+	}
+	return stateRoot(tree.Root(), offensesHash(s.Slashed))
+}
+
+// CertifiedSnapshot is a snapshot taken at a checkpoint together with the
+// proofs that the network agreed on it: the certificate of the checkpoint and
+// the certified commit of the block of the checkpoint, which proves the state
+// root of the snapshot.
+type CertifiedSnapshot struct {
+	Certificate *chain.CheckpointCertificate
+	Commit      *chain.CertifiedCommit
+	Snapshot    *Snapshot
+}
+
+// Verify checks that the checkpoint and the commit of the snapshot are
+// certified by a quorum of the committee in charge of the checkpoint epoch and
+// that the snapshot matches both the checkpoint and the certified state root.
+func (c *CertifiedSnapshot) Verify(committee chain.Committee) error {
+	if !c.Certificate.Verify(committee) {
+		return errors.New("snapshot checkpoint is not certified by a quorum of the committee")
+	}
+	if err := c.Snapshot.Verify(c.Certificate.Checkpoints[0]); err != nil {
+		return err
+	}
+	if !c.Commit.Verify(committee) {
+		return errors.New("snapshot commit is not certified by a quorum of the committee")
+	}
+	if c.Commit.Epoch != c.Snapshot.Epoch || !c.Commit.Hash.Equal(c.Snapshot.BlockHash) {
+		return errors.New("snapshot commit is not the commit of the checkpoint block")
+	}
+	if !c.Snapshot.Root().Equal(c.Commit.StateRoot) {
+		return errors.New("snapshot state does not match the certified state root")
+	}
+	return nil
+}
+
+// Serialize returns the contents of a portable snapshot file.
+func (c *CertifiedSnapshot) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutByteArray(c.Certificate.Serialize(), &bytes)
+	util.PutByteArray(c.Commit.Serialize(), &bytes)
+	return append(bytes, c.Snapshot.Serialize()...)
+}
+
+// ParseCertifiedSnapshot parses the contents of a snapshot file. It does not
+// verify the snapshot: it is up to the caller to verify it against the
+// committee it trusts.
+func ParseCertifiedSnapshot(data []byte) *CertifiedSnapshot {
+	var certified CertifiedSnapshot
+	bytes, position := util.ParseByteArray(data, 0)
+	if position > len(data) {
+		return nil
+	}
+	certified.Certificate = chain.ParseCheckpointCertificate(bytes)
+	bytes, position = util.ParseByteArray(data, position)
+	if position > len(data) {
+		return nil
+	}
+	certified.Commit = chain.ParseCertifiedCommit(bytes)
+	certified.Snapshot = ParseSnapshot(data[position:])
+	if certified.Certificate == nil || certified.Commit == nil || certified.Snapshot == nil {
+		return nil
+	}
+	return &certified
+}
+
+// WriteSnapshotFile exports a certified snapshot to a file.
+func WriteSnapshotFile(filePath string, certified *CertifiedSnapshot) error {
+	if err := os.WriteFile(filePath, certified.Serialize(), 0644); err != nil {
+		return fmt.Errorf("could not write snapshot: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshotFile reads a file written by WriteSnapshotFile.
+func ReadSnapshotFile(filePath string) (*CertifiedSnapshot, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read snapshot: %v", err)
+	}
+	certified := ParseCertifiedSnapshot(data)
+	if certified == nil {
+		return nil, errors.New("corrupted snapshot file")
+	}
+	return certified, nil
+}
+
+// ImportSnapshot creates on filePath the state of a snapshot certified by the
+// committee in charge of its checkpoint. filePath must not hold a state. Once
+// imported the state is resumed by OpenState as any other persisted state, and
+// can be rolled back no further than the epoch of the snapshot.
+func ImportSnapshot(certified *CertifiedSnapshot, committee chain.Committee, filePath string) (*State, error) {
+	if err := certified.Verify(committee); err != nil {
+		return nil, err
+	}
+	snapshot := certified.Snapshot
+	headPath := fmt.Sprintf("%vstate.dat", filePath)
+	if _, err := os.Stat(headPath); !os.IsNotExist(err) {
+		return nil, errors.New("a state already exists on the path")
+	}
+	state := &State{
+		Epoch:     snapshot.Epoch,
+		Wallets:   NewFileWalletStore(fmt.Sprintf("%vwallet.dat", filePath), 0, 8),
+		Deposits:  NewFileWalletStore(fmt.Sprintf("%vdeposit.dat", filePath), 0, 8),
+		Sequences: NewFileWalletStore(fmt.Sprintf("%vsequence.dat", filePath), 0, 8),
+		tree:      NewTree(),
+		treePath:  fmt.Sprintf("%vtree.dat", filePath),
+	}
+	for _, leaf := range snapshot.Accounts {
+		if leaf.Wallet > 0 {
+			state.Wallets.CreditHash(leaf.Account, leaf.Wallet)
+		}
+		if leaf.Deposit > 0 {
+			state.Deposits.CreditHash(leaf.Account, leaf.Deposit)
+		}
+		if leaf.Sequence > 0 {
+			state.Sequences.CreditHash(leaf.Account, leaf.Sequence)
+		}
+		state.tree.Set(leaf)
+	}
+	for _, unbond := range snapshot.Unbonding {
+		state.bond(unbond)
+	}
+	for _, offense := range snapshot.Slashed {
+		state.slashed = slash(state.slashed, offense)
+	}
+	var err error
+	if state.journal, err = newJournal(fmt.Sprintf("%vjournal.dat", filePath)); err != nil {
+		return nil, err
+	}
+	state.journal.checkpoint = snapshot.Epoch
+	if err := state.journal.persist(); err != nil {
+		return nil, err
+	}
+	state.saveTree()
+	file, err := os.Create(headPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create state head: %v", err)
+	}
+	state.head = &head{file: file}
+	return state, state.head.save(state)
+}
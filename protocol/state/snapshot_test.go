@@ -0,0 +1,137 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+	"github.com/lienkolabs/breeze/protocol/chain"
+)
+
+func TestSnapshot(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	s := NewGenesisStateWithAllocations([]Allocation{{Token: token, Wallet: 1000, Deposit: 100}}, "")
+	s.UnbondingPeriod = 10
+	validator := s.Validator(s.NewMutations(), chain.CheckpointInterval)
+	transfer := actions.Transfer{TimeStamp: chain.CheckpointInterval, Sequence: 1, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 10}}}
+	transfer.Sign(key)
+	withdraw := actions.Withdraw{TimeStamp: chain.CheckpointInterval, Sequence: 2, Token: token, Value: 50}
+	withdraw.Sign(key)
+	if !validator.Validate(transfer.Serialize()) || !validator.Validate(withdraw.Serialize()) {
+		t.Fatal("actions rejected")
+	}
+	s.Incorporate(validator, token)
+	if s.Epoch != chain.CheckpointInterval || len(s.unbonding) == 0 {
+		t.Fatal("unexpected state at checkpoint")
+	}
+	_, credentials := crypto.RandomAsymetricKey()
+	checkpoint := &chain.Checkpoint{
+		Epoch:     s.Epoch,
+		BlockHash: crypto.Hasher([]byte("block")),
+		ChainHash: crypto.Hasher([]byte("chain")),
+		StateHash: s.Checksum(),
+	}
+	checkpoint.Sign(credentials)
+
+	snapshot := s.Snapshot(checkpoint.BlockHash, checkpoint.ChainHash)
+	if err := snapshot.Verify(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Root() != s.Root() {
+		t.Fatal("snapshot root does not match state root")
+	}
+	certify := func(root crypto.Hash) *chain.CertifiedCommit {
+		commit := &chain.CertifiedCommit{Epoch: s.Epoch, Hash: checkpoint.BlockHash, StateRoot: root}
+		hash := chain.CommitHash(commit.PreviousHash, commit.Invalidate, root)
+		commit.Certificate = chain.NewQuorumCertificate(commit.Epoch, commit.Hash, hash)
+		commit.Certificate.Append(chain.NewVote(commit.Epoch, commit.Hash, hash, credentials))
+		return commit
+	}
+	certified := &CertifiedSnapshot{
+		Certificate: chain.NewCheckpointCertificate(checkpoint),
+		Commit:      certify(s.Root()),
+		Snapshot:    snapshot,
+	}
+	committee := chain.StaticCommittee{credentials.PublicKey()}
+	if err := certified.Verify(committee); err != nil {
+		t.Fatal(err)
+	}
+	stranger, _ := crypto.RandomAsymetricKey()
+	if certified.Verify(chain.StaticCommittee{stranger}) == nil {
+		t.Fatal("snapshot verified against another committee")
+	}
+	forged := *certified
+	forged.Commit = certify(crypto.Hasher([]byte("root")))
+	if forged.Verify(committee) == nil {
+		t.Fatal("snapshot verified against another state root")
+	}
+	file := t.TempDir() + "/snapshot.dat"
+	if err := WriteSnapshotFile(file, certified); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSnapshotFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := read.Verify(committee); err != nil {
+		t.Fatal(err)
+	}
+	parsed := read.Snapshot
+	if !read.Certificate.Checkpoints[0].Matches(checkpoint) || len(parsed.Accounts) != len(snapshot.Accounts) {
+		t.Fatal("snapshot file does not match snapshot")
+	}
+	tampered := *parsed
+	tampered.Accounts = append([]Leaf{}, parsed.Accounts...)
+	tampered.Accounts[0].Wallet++
+	if tampered.Verify(checkpoint) == nil {
+		t.Fatal("tampered snapshot verified")
+	}
+	if ParseSnapshot(snapshot.Serialize()[1:]) != nil {
+		t.Fatal("truncated snapshot parsed")
+	}
+
+	path := t.TempDir() + "/"
+	if _, err := ImportSnapshot(&forged, committee, path); err == nil {
+		t.Fatal("snapshot imported against another state root")
+	}
+	imported, err := ImportSnapshot(read, committee, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Checksum() != s.Checksum() || imported.Root() != s.Root() {
+		t.Fatal("imported state does not match exported state")
+	}
+	if _, sequence := imported.Sequences.Balance(token); sequence != 2 {
+		t.Fatalf("unexpected imported sequence: %v", sequence)
+	}
+	if imported.Unbonding(crypto.HashToken(token)) != 50 {
+		t.Fatal("unbonding not imported")
+	}
+	if imported.Rollback(checkpoint.Epoch-1) == nil {
+		t.Fatal("imported state rolled back before the snapshot")
+	}
+	imported.Shutdown()
+	if _, err := ImportSnapshot(read, committee, path); err == nil {
+		t.Fatal("snapshot imported over an existing state")
+	}
+	if err := chain.ImportCheckpoint(checkpoint, path); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := OpenState(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Checksum() != s.Checksum() || resumed.Epoch != checkpoint.Epoch {
+		t.Fatal("resumed state does not match snapshot")
+	}
+	resumedChain, err := chain.OpenChain(credentials, resumed, crypto.ZeroHash, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumedChain.Shutdown()
+	if resumedChain.LastCommitEpoch != checkpoint.Epoch || resumedChain.RollingHash != checkpoint.ChainHash || !resumedChain.LastCheckpoint.Matches(checkpoint) {
+		t.Fatal("resumed chain head does not match checkpoint")
+	}
+}
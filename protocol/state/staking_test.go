@@ -0,0 +1,87 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+)
+
+func TestStaking(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	hash := crypto.HashToken(token)
+	s := NewGenesisStateWithAllocations([]Allocation{{Token: token, Wallet: 1000}}, "")
+	s.UnbondingPeriod = 5
+
+	deposit := actions.Deposit{TimeStamp: 1, Token: token, Value: 600, Fee: 1}
+	deposit.Sign(key)
+	validator := s.Validator(s.NewMutations(), 1)
+	if !validator.Validate(deposit.Serialize()) {
+		t.Fatal("valid deposit rejected")
+	}
+	s.Incorporate(validator, token)
+	if _, balance := s.Wallets.Balance(token); balance != 399 {
+		t.Fatalf("unexpected wallet after deposit: %v", balance)
+	}
+	if _, balance := s.Deposits.Balance(token); balance != 600 {
+		t.Fatalf("unexpected deposit: %v", balance)
+	}
+
+	withdraw := actions.Withdraw{TimeStamp: 2, Token: token, Value: 601, Fee: 1}
+	withdraw.Sign(key)
+	validator = s.Validator(s.NewMutations(), 2)
+	if validator.Validate(withdraw.Serialize()) {
+		t.Fatal("withdraw beyond deposit accepted")
+	}
+	withdraw.Value = 400
+	withdraw.Sign(key)
+	if !validator.Validate(withdraw.Serialize()) {
+		t.Fatal("valid withdraw rejected")
+	}
+	s.Incorporate(validator, token)
+	if _, balance := s.Deposits.Balance(token); balance != 200 || s.Unbonding(hash) != 400 {
+		t.Fatalf("unexpected deposit after withdraw: %v", balance)
+	}
+
+	for epoch := uint64(3); epoch <= 7; epoch++ {
+		s.Incorporate(s.Validator(s.NewMutations(), epoch), token)
+	}
+	if _, balance := s.Wallets.Balance(token); balance != 398+400 || s.Unbonding(hash) != 0 {
+		t.Fatalf("unexpected wallet after unbonding: %v", balance)
+	}
+	if err := s.Rollback(6); err != nil {
+		t.Fatal(err)
+	}
+	if _, balance := s.Wallets.Balance(token); balance != 398 || s.Unbonding(hash) != 400 {
+		t.Fatalf("unexpected wallet after rollback: %v", balance)
+	}
+}
+
+func TestUnbondingResume(t *testing.T) {
+	token, _ := crypto.RandomAsymetricKey()
+	hash := crypto.HashToken(token)
+	path := t.TempDir() + "/"
+	s, err := OpenState([]Allocation{{Token: token, Deposit: 1000}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UnbondingPeriod = 10
+	validator := s.Validator(s.NewMutations(), 1).(*MutatingState)
+	if !validator.Unbond(hash, 300) || validator.Unbond(hash, 701) {
+		t.Fatal("unexpected unbond of deposit")
+	}
+	s.Incorporate(validator, token)
+	checksum := s.Checksum()
+	s.Shutdown()
+	resumed, err := OpenState(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Shutdown()
+	if resumed.Unbonding(hash) != 300 || resumed.Checksum() != checksum {
+		t.Fatal("unbonding not resumed")
+	}
+	if len(resumed.journal.entries) != 1 || len(resumed.journal.entries[0].Unbonds) != 1 {
+		t.Fatal("unbond not journaled")
+	}
+}
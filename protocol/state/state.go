@@ -1,16 +1,33 @@
 package state
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"os"
 
 	"github.com/lienkolabs/breeze/crypto"
 	"github.com/lienkolabs/breeze/protocol/chain"
 )
 
 type State struct {
-	Epoch    uint64
-	Wallets  *Wallet // Available tokens per hash of crypto key
-	Deposits *Wallet // Available stakes per hash of crypto key
+	Epoch           uint64
+	Wallets         *Wallet  // Available tokens per hash of crypto key
+	Deposits        *Wallet  // Available stakes per hash of crypto key
+	Sequences       *Wallet  // Last sequence number per hash of crypto key
+	UnbondingPeriod uint64   // epochs from a withdrawal to the credit of its value
+	History         *History // if set balances are kept for every epoch, see OpenHistory
+	unbonding       []Unbond
+	slashed         []Offense
+	tree            *Tree  // balances of every account, see Root
+	treePath        string // file where the tree at the last checkpoint is kept
+	journal         *journal
+	head            *head
+
+	// Scheduled returns true if token was entitled to propose the block of the
+	// given epoch. If set, evidence of a double sign is only valid against a
+	// scheduled proposer.
+	Scheduled func(epoch uint64, token crypto.Token) bool
 }
 
 func (s *State) NewMutations() chain.Mutations {
@@ -23,6 +40,7 @@ func (s *State) Validator(mutations chain.Mutations, epoch uint64) chain.Mutatin
 		return nil
 	}
 	return &MutatingState{
+		Epoch:     epoch,
 		State:     s,
 		mutations: m,
 	}
@@ -33,54 +51,248 @@ func (s *State) Incorporate(v chain.MutatingState, publisher crypto.Token) {
 	if !ok {
 		return
 	}
-	publisherHash := crypto.HashToken(publisher)
-	if delta, ok := ms.mutations.DeltaWallets[publisherHash]; ok {
-		ms.mutations.DeltaWallets[publisherHash] = delta + int(ms.FeesCollected)
-	} else {
-		ms.mutations.DeltaWallets[publisherHash] = int(ms.FeesCollected)
-	}
+	s.settle(ms.mutations, ms.Epoch, ms.FeesCollected, publisher)
 	s.IncorporateMutations(ms.mutations)
+	if ms.Epoch > s.Epoch {
+		s.Epoch = ms.Epoch
+	}
+	if s.History != nil {
+		if err := s.History.append(ms.Epoch, ms.mutations.DeltaWallets, ms.mutations.DeltaDeposits); err != nil {
+			log.Printf("state: %v", err)
+		}
+	}
+	if s.journal != nil {
+		ms.mutations.Epoch = ms.Epoch
+		if err := s.journal.append(ms.mutations); err != nil {
+			log.Printf("state: %v", err)
+		}
+	}
+	if chain.IsCheckpoint(ms.Epoch) {
+		s.saveTree()
+	}
+	s.saveHead()
+}
+
+// settle credits the fees of the block of the given epoch to its publisher and
+// releases the withdrawals due on the epoch.
+func (s *State) settle(m *Mutations, epoch, fees uint64, publisher crypto.Token) {
+	m.DeltaWallets[crypto.HashToken(publisher)] += int(fees)
+	for _, unbond := range s.release(epoch) {
+		if slashedAccount(m.Slashed, unbond.Account) {
+			// confiscated by the slash
+			continue
+		}
+		m.DeltaWallets[unbond.Account] += int(unbond.Value)
+		m.Released = append(m.Released, unbond)
+	}
+}
+
+// RootAfter returns the state root once the validator is incorporated on
+// behalf of the publisher. The state is left unchanged.
+func (s *State) RootAfter(v chain.MutatingState, publisher crypto.Token) crypto.Hash {
+	ms, ok := v.(*MutatingState)
+	if !ok {
+		return s.Root()
+	}
+	m := ms.mutations.Append(nil).(*Mutations)
+	s.settle(m, ms.Epoch, ms.FeesCollected, publisher)
+	touched := make(map[crypto.Hash]Leaf)
+	for _, deltas := range []map[crypto.Hash]int{m.DeltaWallets, m.DeltaDeposits, m.DeltaSequences} {
+		for hash := range deltas {
+			touched[hash] = s.tree.Leaf(hash)
+		}
+	}
+	s.updateTree(m)
+	root := stateRoot(s.tree.Root(), offensesHash(withOffenses(s.slashed, m.Slashed)))
+	for _, leaf := range touched {
+		s.tree.Set(leaf)
+	}
+	return root
+}
+
+// Root is the root of the sparse Merkle tree over the wallet and deposit
+// balances of every account, combined with the offenses slashed if any.
+func (s *State) Root() crypto.Hash {
+	return stateRoot(s.tree.Root(), offensesHash(s.slashed))
+}
+
+// Proof returns the proof of the balances of the account with the given hash
+// against the state root.
+func (s *State) Proof(hash crypto.Hash) *BalanceProof {
+	proof := s.tree.Proof(hash)
+	proof.Slashed = offensesHash(s.slashed)
+	return proof
+}
+
+// Checksum returns a digest over every wallet and deposit balance, every
+// account sequence number, every withdrawal on its unbonding period and every
+// offense slashed. Nodes with the same commited state have the same checksum.
+func (s *State) Checksum() crypto.Hash {
+	return stateChecksum(s.Wallets.Checksum(), s.Deposits.Checksum(), s.Sequences.Checksum(), s.unbonding, s.slashed)
+}
+
+func stateChecksum(wallets, deposits, sequences crypto.Hash, unbonding []Unbond, slashed []Offense) crypto.Hash {
+	data := append(wallets[:], deposits[:]...)
+	if sequences != crypto.ZeroValueHash {
+		data = append(data, sequences[:]...)
+	}
+	if len(unbonding) > 0 {
+		hash := unbondingChecksum(unbonding)
+		data = append(data, hash[:]...)
+	}
+	if len(slashed) > 0 {
+		hash := offensesHash(slashed)
+		data = append(data, hash[:]...)
+	}
+	return crypto.Hasher(data)
+}
+
+// Rollback reverts the mutations incorporated after the given epoch. Only
+// epochs since the last checkpoint can be restored.
+func (s *State) Rollback(epoch uint64) error {
+	if s.journal == nil {
+		return errors.New("state keeps no journal")
+	}
+	reverted, err := s.journal.revert(epoch)
+	if err != nil {
+		return err
+	}
+	for _, m := range reverted {
+		s.IncorporateMutations(m.Reverse())
+	}
+	s.Epoch = epoch
+	s.saveHead()
+	if s.History != nil {
+		return s.History.truncate(epoch)
+	}
+	return nil
+}
+
+// Replay incorporates a commited block into the state as the chain commits it:
+// every action on the block not invalidated is validated in order, and fees
+// are credited to the proposer. If the block carries a state root the state
+// must match it, otherwise the block is reverted.
+func (s *State) Replay(block *chain.Block) error {
+	if block.Epoch != s.Epoch+1 {
+		return fmt.Errorf("block %v does not follow state epoch %v", block.Epoch, s.Epoch)
+	}
+	skip := make(map[crypto.Hash]struct{})
+	for _, hash := range block.Invalidate {
+		skip[hash] = struct{}{}
+	}
+	validator := s.Validator(s.NewMutations(), block.Epoch)
+	for _, action := range block.Actions {
+		hash := crypto.Hasher(action)
+		if _, skipped := skip[hash]; !skipped {
+			validator.Validate(action)
+			skip[hash] = struct{}{}
+		}
+	}
+	s.Incorporate(validator, block.Proposer)
+	if block.StateRoot != crypto.ZeroValueHash && block.StateRoot != s.Root() {
+		if err := s.Rollback(block.Epoch - 1); err != nil {
+			return err
+		}
+		return fmt.Errorf("state after block %v does not match its state root", block.Epoch)
+	}
+	return nil
+}
+
+func (s *State) saveHead() {
+	if s.head == nil {
+		return
+	}
+	if err := s.head.save(s); err != nil {
+		log.Printf("state: %v", err)
+	}
 }
 
 func (s *State) Shutdown() {
 	s.Wallets.Close()
+	s.Deposits.Close()
+	s.Sequences.Close()
+	if s.journal != nil {
+		s.journal.close()
+	}
+	if s.head != nil {
+		s.head.file.Close()
+	}
+	if s.History != nil {
+		s.History.close()
+	}
 }
 
 func NewGenesisState() (*State, crypto.PrivateKey) {
 	pubKey, prvKey := crypto.RandomAsymetricKey()
 	state := State{
-		Epoch:    0,
-		Wallets:  NewMemoryWalletStore(0, 8),
-		Deposits: NewMemoryWalletStore(0, 8),
+		Epoch:     0,
+		Wallets:   NewMemoryWalletStore(0, 8),
+		Deposits:  NewMemoryWalletStore(0, 8),
+		Sequences: NewMemoryWalletStore(0, 8),
+		tree:      NewTree(),
 	}
+	state.journal, _ = newJournal("")
 	state.Wallets.Credit(pubKey, 1e6)
 	state.Deposits.Credit(pubKey, 1e6)
+	state.tree.Add(crypto.HashToken(pubKey), 1e6, 1e6, 0)
 	return &state, prvKey
 }
 
 func NewGenesisStateWithToken(token crypto.Token, filePath string) *State {
+	return NewGenesisStateWithAllocations([]Allocation{{Token: token, Wallet: 1e9, Deposit: 1e9}}, filePath)
+}
+
+// Allocation is a balance credited at genesis to the wallet and to the deposit
+// of a token.
+type Allocation struct {
+	Token   crypto.Token
+	Wallet  uint64
+	Deposit uint64
+}
+
+func NewGenesisStateWithAllocations(allocations []Allocation, filePath string) *State {
 	var state State
 	if filePath == "" {
 		state = State{
-			Epoch:    0,
-			Wallets:  NewMemoryWalletStore(0, 8),
-			Deposits: NewMemoryWalletStore(0, 8),
+			Epoch:     0,
+			Wallets:   NewMemoryWalletStore(0, 8),
+			Deposits:  NewMemoryWalletStore(0, 8),
+			Sequences: NewMemoryWalletStore(0, 8),
 		}
 	} else {
 		state = State{
-			Epoch:    0,
-			Wallets:  NewFileWalletStore(fmt.Sprintf("%vwallet.dat", filePath), 0, 8),
-			Deposits: NewFileWalletStore(fmt.Sprintf("%vdeposit.dat", filePath), 0, 8),
+			Epoch:     0,
+			Wallets:   NewFileWalletStore(fmt.Sprintf("%vwallet.dat", filePath), 0, 8),
+			Deposits:  NewFileWalletStore(fmt.Sprintf("%vdeposit.dat", filePath), 0, 8),
+			Sequences: NewFileWalletStore(fmt.Sprintf("%vsequence.dat", filePath), 0, 8),
 		}
 
 	}
-
-	state.Wallets.Credit(token, 1e9)
-	state.Deposits.Credit(token, 1e9)
+	state.tree = NewTree()
+	journalPath := ""
+	if filePath != "" {
+		journalPath = fmt.Sprintf("%vjournal.dat", filePath)
+		state.treePath = fmt.Sprintf("%vtree.dat", filePath)
+	}
+	var err error
+	if state.journal, err = newJournal(journalPath); err != nil {
+		log.Printf("state: %v", err)
+	}
+	for _, allocation := range allocations {
+		if allocation.Wallet > 0 {
+			state.Wallets.Credit(allocation.Token, allocation.Wallet)
+		}
+		if allocation.Deposit > 0 {
+			state.Deposits.Credit(allocation.Token, allocation.Deposit)
+		}
+		state.tree.Add(crypto.HashToken(allocation.Token), int(allocation.Wallet), int(allocation.Deposit), 0)
+	}
+	state.saveTree()
 	return &state
 }
 
 func (s *State) IncorporateMutations(m *Mutations) {
+	s.updateTree(m)
 	for hash, delta := range m.DeltaWallets {
 		if delta > 0 {
 			s.Wallets.CreditHash(hash, uint64(delta))
@@ -95,4 +307,68 @@ func (s *State) IncorporateMutations(m *Mutations) {
 			s.Deposits.DebitHash(hash, uint64(-delta))
 		}
 	}
+	for hash, delta := range m.DeltaSequences {
+		if delta > 0 {
+			s.Sequences.CreditHash(hash, uint64(delta))
+		} else if delta < 0 {
+			s.Sequences.DebitHash(hash, uint64(-delta))
+		}
+	}
+	for _, unbond := range m.Released {
+		s.unbond(unbond)
+	}
+	for _, unbond := range m.Unbonds {
+		s.bond(unbond)
+	}
+	for _, offense := range m.Pardoned {
+		s.slashed = pardon(s.slashed, offense)
+	}
+	for _, offense := range m.Slashed {
+		s.slashed = slash(s.slashed, offense)
+	}
+}
+
+// updateTree applies the balance and sequence changes of mutations to the
+// state tree.
+func (s *State) updateTree(m *Mutations) {
+	for hash, delta := range m.DeltaWallets {
+		s.tree.Add(hash, delta, 0, 0)
+	}
+	for hash, delta := range m.DeltaDeposits {
+		s.tree.Add(hash, 0, delta, 0)
+	}
+	for hash, delta := range m.DeltaSequences {
+		s.tree.Add(hash, 0, 0, delta)
+	}
+}
+
+// saveTree persists the tree as of the last checkpoint. Together with the
+// journal it restores the tree of a resumed state.
+func (s *State) saveTree() {
+	if s.treePath == "" {
+		return
+	}
+	if err := os.WriteFile(s.treePath, s.tree.serializeLeaves(), 0644); err != nil {
+		log.Printf("state: could not persist state tree: %v", err)
+	}
+}
+
+// loadTree restores the tree out of the tree at the last checkpoint and the
+// journal, and checks it against the checksums of the wallet stores.
+func (s *State) loadTree() error {
+	data, err := os.ReadFile(s.treePath)
+	if err != nil {
+		return fmt.Errorf("could not read state tree: %v", err)
+	}
+	if s.tree, err = parseLeaves(data); err != nil {
+		return err
+	}
+	for _, m := range s.journal.entries {
+		s.updateTree(m)
+	}
+	wallets, deposits, sequences := leavesChecksums(s.tree.Leaves())
+	if wallets != s.Wallets.checksum || deposits != s.Deposits.checksum || sequences != s.Sequences.checksum {
+		return errors.New("state tree does not match wallets")
+	}
+	return nil
 }
@@ -0,0 +1,312 @@
+package state
+
+import (
+	"errors"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Leaf is the wallet and deposit balance and the last sequence number of an
+// account on the state tree.
+type Leaf struct {
+	Account  crypto.Hash
+	Wallet   uint64
+	Deposit  uint64
+	Sequence uint64
+}
+
+func (l Leaf) empty() bool {
+	return l.Wallet == 0 && l.Deposit == 0 && l.Sequence == 0
+}
+
+func (l Leaf) hash() crypto.Hash {
+	data := []byte{0}
+	util.PutHash(l.Account, &data)
+	util.PutUint64(l.Wallet, &data)
+	util.PutUint64(l.Deposit, &data)
+	util.PutUint64(l.Sequence, &data)
+	return crypto.Hasher(data)
+}
+
+func putLeaf(l Leaf, data *[]byte) {
+	util.PutHash(l.Account, data)
+	util.PutUint64(l.Wallet, data)
+	util.PutUint64(l.Deposit, data)
+	util.PutUint64(l.Sequence, data)
+}
+
+func parseLeaf(data []byte, position int) (Leaf, int) {
+	var l Leaf
+	l.Account, position = util.ParseHash(data, position)
+	l.Wallet, position = util.ParseUint64(data, position)
+	l.Deposit, position = util.ParseUint64(data, position)
+	l.Sequence, position = util.ParseUint64(data, position)
+	return l, position
+}
+
+func branchHash(left, right crypto.Hash) crypto.Hash {
+	data := []byte{1}
+	util.PutHash(left, &data)
+	util.PutHash(right, &data)
+	return crypto.Hasher(data)
+}
+
+// bit returns the bit of the account at the given depth of the tree.
+func bit(account crypto.Hash, depth int) int {
+	return int(account[depth/8]>>(7-depth%8)) & 1
+}
+
+type treeNode struct {
+	children [2]*treeNode // both nil for leaves
+	leaf     Leaf
+	hash     crypto.Hash
+	stale    bool // hash of a branch must be recomputed
+}
+
+func (n *treeNode) isLeaf() bool {
+	return n.children[0] == nil && n.children[1] == nil
+}
+
+func nodeHash(n *treeNode) crypto.Hash {
+	if n == nil {
+		return crypto.ZeroValueHash
+	}
+	if n.stale {
+		n.hash = branchHash(nodeHash(n.children[0]), nodeHash(n.children[1]))
+		n.stale = false
+	}
+	return n.hash
+}
+
+// Tree is a sparse Merkle tree over the balances and sequence numbers of every
+// account, indexed by the bits of the account hash. A subtree with a single
+// account is the leaf of the account itself and an empty subtree hashes to
+// zero, so that the tree is as deep as needed to tell accounts apart and its
+// root depends only on the balances and sequence numbers.
+type Tree struct {
+	root   *treeNode
+	leaves map[crypto.Hash]Leaf
+}
+
+func NewTree() *Tree {
+	return &Tree{leaves: make(map[crypto.Hash]Leaf)}
+}
+
+// Root commits to the balances and sequence numbers of every account.
+func (t *Tree) Root() crypto.Hash {
+	return nodeHash(t.root)
+}
+
+// Leaf returns the balances of an account, zero if it has none.
+func (t *Tree) Leaf(account crypto.Hash) Leaf {
+	if leaf, ok := t.leaves[account]; ok {
+		return leaf
+	}
+	return Leaf{Account: account}
+}
+
+// Leaves returns every account on the tree in path order.
+func (t *Tree) Leaves() []Leaf {
+	leaves := make([]Leaf, 0, len(t.leaves))
+	var walk func(n *treeNode)
+	walk = func(n *treeNode) {
+		if n == nil {
+			return
+		}
+		if n.isLeaf() {
+			leaves = append(leaves, n.leaf)
+			return
+		}
+		walk(n.children[0])
+		walk(n.children[1])
+	}
+	walk(t.root)
+	return leaves
+}
+
+// Set replaces the leaf of an account. Accounts with no balance and no sequence
+// number are removed from the tree.
+func (t *Tree) Set(leaf Leaf) {
+	if leaf.empty() {
+		if _, ok := t.leaves[leaf.Account]; ok {
+			delete(t.leaves, leaf.Account)
+			t.root = remove(t.root, 0, leaf.Account)
+		}
+		return
+	}
+	t.leaves[leaf.Account] = leaf
+	t.root = insert(t.root, 0, &treeNode{leaf: leaf, hash: leaf.hash()})
+}
+
+// Add credits or debits the balances and the sequence number of an account. As
+// on wallet stores, a debit beyond the balance is ignored.
+func (t *Tree) Add(account crypto.Hash, wallet, deposit, sequence int) {
+	leaf := t.Leaf(account)
+	if wallet < 0 && uint64(-wallet) > leaf.Wallet || deposit < 0 && uint64(-deposit) > leaf.Deposit || sequence < 0 && uint64(-sequence) > leaf.Sequence {
+		return
+	}
+	leaf.Wallet = uint64(int(leaf.Wallet) + wallet)
+	leaf.Deposit = uint64(int(leaf.Deposit) + deposit)
+	leaf.Sequence = uint64(int(leaf.Sequence) + sequence)
+	t.Set(leaf)
+}
+
+func insert(n *treeNode, depth int, leaf *treeNode) *treeNode {
+	if n == nil {
+		return leaf
+	}
+	if n.isLeaf() {
+		if n.leaf.Account == leaf.leaf.Account {
+			return leaf
+		}
+		branch := &treeNode{stale: true}
+		branch.children[bit(n.leaf.Account, depth)] = n
+		return insert(branch, depth, leaf)
+	}
+	side := bit(leaf.leaf.Account, depth)
+	n.children[side] = insert(n.children[side], depth+1, leaf)
+	n.stale = true
+	return n
+}
+
+func remove(n *treeNode, depth int, account crypto.Hash) *treeNode {
+	if n == nil {
+		return nil
+	}
+	if n.isLeaf() {
+		if n.leaf.Account == account {
+			return nil
+		}
+		return n
+	}
+	side := bit(account, depth)
+	n.children[side] = remove(n.children[side], depth+1, account)
+	n.stale = true
+	left, right := n.children[0], n.children[1]
+	if left == nil && (right == nil || right.isLeaf()) {
+		return right
+	}
+	if right == nil && left.isLeaf() {
+		return left
+	}
+	return n
+}
+
+// BalanceProof proves the balances of an account against a state root. For an
+// account without balances the path ends either on an empty subtree or on the
+// leaf of Other, another account sharing the path. Slashed is the checksum of
+// the offenses combined with the root of the tree into the state root.
+type BalanceProof struct {
+	Leaf     Leaf
+	Siblings []crypto.Hash // from the root down to the end of the path
+	Other    *Leaf
+	Slashed  crypto.Hash
+}
+
+// Proof returns the proof of the balances of an account against the root.
+func (t *Tree) Proof(account crypto.Hash) *BalanceProof {
+	proof := &BalanceProof{Leaf: t.Leaf(account), Siblings: make([]crypto.Hash, 0)}
+	n := t.root
+	for depth := 0; n != nil && !n.isLeaf(); depth++ {
+		side := bit(account, depth)
+		proof.Siblings = append(proof.Siblings, nodeHash(n.children[1-side]))
+		n = n.children[side]
+	}
+	if n != nil && n.leaf.Account != account {
+		other := n.leaf
+		proof.Other = &other
+	}
+	return proof
+}
+
+// Verify checks the proof against a state root.
+func (p *BalanceProof) Verify(root crypto.Hash) bool {
+	depth := len(p.Siblings)
+	if depth > 8*crypto.Size {
+		return false
+	}
+	account := p.Leaf.Account
+	terminal := crypto.ZeroValueHash
+	if !p.Leaf.empty() {
+		if p.Other != nil {
+			return false
+		}
+		terminal = p.Leaf.hash()
+	} else if p.Other != nil {
+		if p.Other.Account == account || p.Other.empty() {
+			return false
+		}
+		for n := 0; n < depth; n++ {
+			if bit(p.Other.Account, n) != bit(account, n) {
+				return false
+			}
+		}
+		terminal = p.Other.hash()
+	}
+	for n := depth - 1; n >= 0; n-- {
+		if bit(account, n) == 0 {
+			terminal = branchHash(terminal, p.Siblings[n])
+		} else {
+			terminal = branchHash(p.Siblings[n], terminal)
+		}
+	}
+	return stateRoot(terminal, p.Slashed) == root
+}
+
+func (p *BalanceProof) Serialize() []byte {
+	bytes := make([]byte, 0)
+	putLeaf(p.Leaf, &bytes)
+	util.PutHashArray(p.Siblings, &bytes)
+	util.PutBool(p.Other != nil, &bytes)
+	if p.Other != nil {
+		putLeaf(*p.Other, &bytes)
+	}
+	util.PutHash(p.Slashed, &bytes)
+	return bytes
+}
+
+func ParseBalanceProof(data []byte) *BalanceProof {
+	position := 0
+	var proof BalanceProof
+	proof.Leaf, position = parseLeaf(data, position)
+	proof.Siblings, position = util.ParseHashArray(data, position)
+	var other bool
+	if other, position = util.ParseBool(data, position); other {
+		var leaf Leaf
+		leaf, position = parseLeaf(data, position)
+		proof.Other = &leaf
+	}
+	proof.Slashed, position = util.ParseHash(data, position)
+	if position != len(data) {
+		return nil
+	}
+	return &proof
+}
+
+// serializeLeaves serializes the leaves of the tree in path order.
+func (t *Tree) serializeLeaves() []byte {
+	bytes := make([]byte, 0)
+	leaves := t.Leaves()
+	util.PutUint32(uint32(len(leaves)), &bytes)
+	for _, leaf := range leaves {
+		putLeaf(leaf, &bytes)
+	}
+	return bytes
+}
+
+func parseLeaves(data []byte) (*Tree, error) {
+	position := 0
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.Size+24) != len(data) {
+		return nil, errors.New("corrupted state tree")
+	}
+	tree := NewTree()
+	for n := 0; n < int(count); n++ {
+		var leaf Leaf
+		leaf, position = parseLeaf(data, position)
+		tree.Set(leaf)
+	}
+	return tree, nil
+}
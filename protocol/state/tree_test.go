@@ -0,0 +1,124 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/protocol/actions"
+)
+
+func TestTree(t *testing.T) {
+	leaves := make([]Leaf, 20)
+	for n := range leaves {
+		leaves[n] = Leaf{Account: crypto.Hasher([]byte{byte(n)}), Wallet: uint64(n + 1), Deposit: uint64(n % 3)}
+	}
+	forward, backward := NewTree(), NewTree()
+	if forward.Root() != crypto.ZeroValueHash {
+		t.Fatal("empty tree root is not zero")
+	}
+	for n := range leaves {
+		forward.Set(leaves[n])
+		backward.Set(leaves[len(leaves)-1-n])
+	}
+	if forward.Root() != backward.Root() {
+		t.Fatal("root depends on insertion order")
+	}
+	root := forward.Root()
+	for _, leaf := range leaves {
+		proof := forward.Proof(leaf.Account)
+		if proof.Leaf != leaf || !proof.Verify(root) {
+			t.Fatal("inclusion proof not verified")
+		}
+		parsed := ParseBalanceProof(proof.Serialize())
+		if parsed == nil || !parsed.Verify(root) {
+			t.Fatal("parsed inclusion proof not verified")
+		}
+		forged := *proof
+		forged.Leaf.Wallet++
+		if forged.Verify(root) {
+			t.Fatal("forged balance verified")
+		}
+	}
+	others := 0
+	for n := 100; n < 150; n++ {
+		proof := forward.Proof(crypto.Hasher([]byte{byte(n)}))
+		if !proof.Leaf.empty() || !proof.Verify(root) {
+			t.Fatal("non-inclusion proof not verified")
+		}
+		if proof.Other != nil {
+			others++
+			forged := *proof
+			forged.Leaf.Wallet = 1
+			forged.Other = nil
+			if forged.Verify(root) {
+				t.Fatal("balance of absent account verified")
+			}
+		}
+	}
+	if others == 0 {
+		t.Fatal("no non-inclusion proof ending on another account")
+	}
+
+	extra := Leaf{Account: crypto.Hasher([]byte("extra")), Wallet: 7}
+	forward.Set(extra)
+	if forward.Root() == root {
+		t.Fatal("root unchanged by a new account")
+	}
+	forward.Add(extra.Account, -7, 0, 0)
+	if forward.Root() != root {
+		t.Fatal("root not restored after the account is emptied")
+	}
+	forward.Add(leaves[0].Account, -100, 0, 0)
+	if forward.Root() != root {
+		t.Fatal("over-debit changed the tree")
+	}
+}
+
+func TestStateRoot(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	path := t.TempDir() + "/"
+	s, err := OpenState([]Allocation{{Token: token, Wallet: 1000, Deposit: 100}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := s.Root()
+	validator := s.Validator(s.NewMutations(), 1)
+	transfer := actions.Transfer{TimeStamp: 1, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 10}}}
+	transfer.Sign(key)
+	if !validator.Validate(transfer.Serialize()) {
+		t.Fatal("transfer rejected")
+	}
+	prospective := s.RootAfter(validator, token)
+	if s.Root() != genesis {
+		t.Fatal("state root changed before the commit")
+	}
+	s.Incorporate(validator, token)
+	root := s.Root()
+	if root == genesis {
+		t.Fatal("state root unchanged by transfer")
+	}
+	if root != prospective {
+		t.Fatal("state root differs from the root announced before the commit")
+	}
+	proof := s.Proof(crypto.HashToken(receiver))
+	if proof.Leaf.Wallet != 10 || !proof.Verify(root) {
+		t.Fatal("receiver balance not proven")
+	}
+	s.Shutdown()
+
+	resumed, err := OpenState(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Shutdown()
+	if resumed.Root() != root {
+		t.Fatal("resumed state root does not match")
+	}
+	if err := resumed.Rollback(0); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Root() != genesis {
+		t.Fatal("state root not restored by rollback")
+	}
+}
@@ -0,0 +1,102 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/util"
+)
+
+// Unbond is a withdrawal of deposit on its unbonding period. Value leaves the
+// deposit of Account at the withdrawal and is credited to its wallet on the
+// commit of the first block at or after the Release epoch.
+type Unbond struct {
+	Account crypto.Hash
+	Value   uint64
+	Release uint64
+}
+
+func (u Unbond) less(other Unbond) bool {
+	if u.Release != other.Release {
+		return u.Release < other.Release
+	}
+	if cmp := bytes.Compare(u.Account[:], other.Account[:]); cmp != 0 {
+		return cmp < 0
+	}
+	return u.Value < other.Value
+}
+
+// Unbonding returns the value withdrawn by the account with the given hash
+// still on its unbonding period.
+func (s *State) Unbonding(hash crypto.Hash) uint64 {
+	value := uint64(0)
+	for _, unbond := range s.unbonding {
+		if unbond.Account == hash {
+			value += unbond.Value
+		}
+	}
+	return value
+}
+
+// release returns the unbonds due at the given epoch.
+func (s *State) release(epoch uint64) []Unbond {
+	released := make([]Unbond, 0)
+	for _, unbond := range s.unbonding {
+		if unbond.Release > epoch {
+			break
+		}
+		released = append(released, unbond)
+	}
+	return released
+}
+
+// bond keeps unbonding ordered by release epoch, account and value, so that
+// every node with the same commited state has the same unbonding.
+func (s *State) bond(unbond Unbond) {
+	n := sort.Search(len(s.unbonding), func(i int) bool {
+		return unbond.less(s.unbonding[i])
+	})
+	s.unbonding = append(s.unbonding, Unbond{})
+	copy(s.unbonding[n+1:], s.unbonding[n:])
+	s.unbonding[n] = unbond
+}
+
+func (s *State) unbond(unbond Unbond) {
+	for n, existing := range s.unbonding {
+		if existing == unbond {
+			s.unbonding = append(s.unbonding[:n], s.unbonding[n+1:]...)
+			return
+		}
+	}
+}
+
+func unbondingChecksum(unbonding []Unbond) crypto.Hash {
+	data := make([]byte, 0)
+	putUnbonds(unbonding, &data)
+	return crypto.Hasher(data)
+}
+
+func putUnbonds(unbonds []Unbond, data *[]byte) {
+	util.PutUint32(uint32(len(unbonds)), data)
+	for _, unbond := range unbonds {
+		util.PutHash(unbond.Account, data)
+		util.PutUint64(unbond.Value, data)
+		util.PutUint64(unbond.Release, data)
+	}
+}
+
+func parseUnbonds(data []byte, position int) ([]Unbond, int) {
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.Size+16) > len(data) {
+		return nil, len(data) + 1
+	}
+	unbonds := make([]Unbond, int(count))
+	for n := range unbonds {
+		unbonds[n].Account, position = util.ParseHash(data, position)
+		unbonds[n].Value, position = util.ParseUint64(data, position)
+		unbonds[n].Release, position = util.ParseUint64(data, position)
+	}
+	return unbonds, position
+}
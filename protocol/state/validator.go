@@ -11,6 +11,11 @@ import (
 
 const MaxEpochDifference = 100
 
+// Offenders proven to have double signed lose their whole deposit. The reporter
+// of the evidence is rewarded with 1/SlashRewardDivisor of it, the remainder is
+// burned.
+const SlashRewardDivisor = 2
+
 type MutatingState struct {
 	Epoch         uint64
 	State         *State
@@ -36,12 +41,28 @@ func (c *MutatingState) Validate(data []byte) bool {
 		return false
 	}
 	util.PrintJson(action)
+	signer, sequence := action.Sequenced()
+	if !c.InSequence(crypto.HashToken(signer), sequence) {
+		return false
+	}
 	payments := action.Payments()
 	if !c.CanPay(payments) {
 		fmt.Println("cant pay")
 		return false
 	}
+	if evidence, ok := action.(*actions.DoubleSign); ok && !c.Slash(evidence.Offender, evidence.Reporter, evidence.BlockEpoch) {
+		return false
+	}
+	if withdraw, ok := action.(*actions.Withdraw); ok && !c.Unbond(crypto.HashToken(withdraw.Token), withdraw.Value) {
+		return false
+	}
 	c.TransferPayments(payments)
+	if deposit, ok := action.(*actions.Deposit); ok {
+		c.Deposit(crypto.HashToken(deposit.Token), deposit.Value)
+	}
+	if sequence > 0 {
+		c.mutations.DeltaSequences[crypto.HashToken(signer)] += 1
+	}
 	return true
 }
 
@@ -59,6 +80,105 @@ func (c *MutatingState) Balance(hash crypto.Hash) uint64 {
 	return balance
 }
 
+// DepositBalance returns the deposit of the account with the given hash.
+func (c *MutatingState) DepositBalance(hash crypto.Hash) uint64 {
+	_, balance := c.State.Deposits.BalanceHash(hash)
+	if c.mutations == nil {
+		return balance
+	}
+	delta := c.mutations.DeltaDeposits[hash]
+	if delta < 0 {
+		balance = balance - uint64(-delta)
+	} else {
+		balance = balance + uint64(delta)
+	}
+	return balance
+}
+
+// Sequence returns the last sequence number of the account with the given
+// hash, zero if it never signed a version 1 action.
+func (c *MutatingState) Sequence(hash crypto.Hash) uint64 {
+	_, sequence := c.State.Sequences.BalanceHash(hash)
+	if c.mutations == nil {
+		return sequence
+	}
+	return uint64(int(sequence) + c.mutations.DeltaSequences[hash])
+}
+
+// InSequence returns true if an action of the account with the given hash and
+// sequence number can be incorporated: a sequenced action must follow the last
+// sequence number of the account, and accounts that signed a sequenced action
+// no longer sign unsequenced ones.
+func (c *MutatingState) InSequence(hash crypto.Hash, sequence uint64) bool {
+	return sequence == c.Sequence(hash)+1 || (sequence == 0 && c.Sequence(hash) == 0)
+}
+
+// Slash confiscates the deposit of offender for a double sign on the block of
+// the given epoch, together with its withdrawals on their unbonding period,
+// and credits reporter with its reward. It returns false if offender was not
+// scheduled to propose the block, has nothing left to confiscate or was
+// already slashed for the offense.
+func (b *MutatingState) Slash(offender, reporter crypto.Token, epoch uint64) bool {
+	if b.State.Scheduled != nil && !b.State.Scheduled(epoch, offender) {
+		return false
+	}
+	hash := crypto.HashToken(offender)
+	offense := Offense{Account: hash, Epoch: epoch}
+	if b.State.Slashed(hash, epoch) || containsOffense(b.mutations.Slashed, offense) {
+		return false
+	}
+	deposit := b.DepositBalance(hash)
+	unbonding := b.confiscate(hash)
+	if deposit+unbonding == 0 {
+		return false
+	}
+	b.Withdraw(hash, deposit)
+	b.mutations.Slashed = slash(b.mutations.Slashed, offense)
+	reward := &actions.Payment{Credit: []actions.Wallet{{Account: crypto.HashToken(reporter), FungibleTokens: (deposit + unbonding) / SlashRewardDivisor}}}
+	b.TransferPayments(reward)
+	return true
+}
+
+// confiscate releases the withdrawals of the account with the given hash on
+// their unbonding period, commited or on the block, without crediting them.
+// It returns their value.
+func (b *MutatingState) confiscate(hash crypto.Hash) uint64 {
+	if slashedAccount(b.mutations.Slashed, hash) {
+		// already confiscated on the block
+		return 0
+	}
+	value := uint64(0)
+	for _, unbond := range b.State.unbonding {
+		if unbond.Account == hash {
+			b.mutations.Released = append(b.mutations.Released, unbond)
+			value += unbond.Value
+		}
+	}
+	kept := b.mutations.Unbonds[:0]
+	for _, unbond := range b.mutations.Unbonds {
+		if unbond.Account == hash {
+			value += unbond.Value
+		} else {
+			kept = append(kept, unbond)
+		}
+	}
+	b.mutations.Unbonds = kept
+	return value
+}
+
+// Unbond withdraws value from the deposit of the account with the given hash
+// and schedules its credit to the wallet after the unbonding period of the
+// state. It returns false if the deposit does not cover value.
+func (b *MutatingState) Unbond(hash crypto.Hash, value uint64) bool {
+	if value == 0 || b.DepositBalance(hash) < value {
+		return false
+	}
+	b.Withdraw(hash, value)
+	unbond := Unbond{Account: hash, Value: value, Release: b.Epoch + b.State.UnbondingPeriod}
+	b.mutations.Unbonds = append(b.mutations.Unbonds, unbond)
+	return true
+}
+
 func (b *MutatingState) CanPay(payments *actions.Payment) bool {
 	for _, debit := range payments.Debit {
 		existingBalance := b.Balance(debit.Account)
@@ -7,6 +7,9 @@ import (
 	"github.com/lienkolabs/papirus"
 )
 
+// creditOrDebit credits or debits the account of a wallet store. Whenever the
+// balance changes the new account data is returned, with a zero balance for
+// accounts deleted.
 func creditOrDebit(found bool, hash crypto.Hash, b *papirus.Bucket, item int64, param []byte) papirus.OperationResult {
 	sign := int64(1)
 	if param[0] == 1 {
@@ -33,6 +36,8 @@ func creditOrDebit(found bool, hash crypto.Hash, b *papirus.Bucket, item int64,
 			}
 		} else if newbalance == 0 {
 			// account is market to be deleted
+			acc := make([]byte, crypto.Size+8)
+			copy(acc[0:crypto.Size], hash[:])
 			return papirus.OperationResult{
 				Deleted: &papirus.Item{Bucket: b, Item: item},
 				Result:  papirus.QueryResult{Ok: true, Data: acc},
@@ -62,18 +67,32 @@ func creditOrDebit(found bool, hash crypto.Hash, b *papirus.Bucket, item int64,
 	}
 }
 
+// Wallet is a store of balances indexed by the hash of a token. It keeps a
+// checksum of every balance on the store, updated on each credit and debit out
+// of the new balance returned by the store.
 type Wallet struct {
-	hs *papirus.HashStore[crypto.Hash]
+	hs       *papirus.HashStore[crypto.Hash]
+	checksum checksum
 }
 
 func (w *Wallet) CreditHash(hash crypto.Hash, value uint64) bool {
 	response := make(chan papirus.QueryResult)
 	param := make([]byte, 9)
 	binary.LittleEndian.PutUint64(param[1:], value)
-	ok, _ := w.hs.Query(papirus.Query[crypto.Hash]{Hash: hash, Param: param, Response: response})
+	ok, data := w.hs.Query(papirus.Query[crypto.Hash]{Hash: hash, Param: param, Response: response})
+	if len(data) == crypto.Size+8 {
+		after := binary.LittleEndian.Uint64(data[crypto.Size:])
+		w.checksum.update(hash, after-value, after)
+	}
 	return ok
 }
 
+// Checksum returns an order independent digest over every balance on the
+// wallet.
+func (w *Wallet) Checksum() crypto.Hash {
+	return w.checksum.Hash()
+}
+
 func (w *Wallet) Credit(token crypto.Token, value uint64) bool {
 	hash := crypto.HashToken(token)
 	return w.CreditHash(hash, value)
@@ -99,7 +118,11 @@ func (w *Wallet) DebitHash(hash crypto.Hash, value uint64) bool {
 	param := make([]byte, 9)
 	param[0] = 1
 	binary.LittleEndian.PutUint64(param[1:], value)
-	ok, _ := w.hs.Query(papirus.Query[crypto.Hash]{Hash: hash, Param: param, Response: response})
+	ok, data := w.hs.Query(papirus.Query[crypto.Hash]{Hash: hash, Param: param, Response: response})
+	if len(data) == crypto.Size+8 {
+		after := binary.LittleEndian.Uint64(data[crypto.Size:])
+		w.checksum.update(hash, after+value, after)
+	}
 	return ok
 }
 
@@ -0,0 +1,346 @@
+package simulation
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/lienkolabs/breeze/consensus"
+	"github.com/lienkolabs/breeze/consensus/poa"
+	"github.com/lienkolabs/breeze/consensus/swell"
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/network/trusted"
+	"github.com/lienkolabs/breeze/protocol/actions"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/state"
+	"github.com/lienkolabs/breeze/store"
+)
+
+// digest of a commited epoch: the rolling hash of the chain and the checksum
+// of the state.
+type digest struct {
+	chain crypto.Hash
+	state crypto.Hash
+}
+
+// Validator is a round robin or swell validator of the simulation.
+type Validator struct {
+	Token     crypto.Token
+	Engine    *consensus.Engine
+	Chain     *chain.Chain
+	State     *state.State
+	sim       *Simulation
+	index     int
+	crashed   bool
+	committed uint64
+	digests   map[uint64]digest
+}
+
+func newValidator(s *Simulation, index int, credentials crypto.PrivateKey) (*Validator, error) {
+	commitState := state.NewGenesisStateWithAllocations(s.Genesis.StateAllocations(), "")
+	commitState.UnbondingPeriod = s.Genesis.Unbonding()
+	blockchain := chain.NewChainFromGenesis(credentials, commitState, s.Genesis.Hash())
+	blockchain.Clock = s.Now
+	v := &Validator{
+		Token:   credentials.PublicKey(),
+		Chain:   blockchain,
+		State:   commitState,
+		sim:     s,
+		index:   index,
+		digests: make(map[uint64]digest),
+	}
+	pool := &transport{sim: s, from: v, credentials: credentials}
+	var engine *consensus.Engine
+	var err error
+	if s.config.Swell {
+		candidates := make([]swell.Candidate, len(s.Genesis.Validators))
+		for n, validator := range s.Genesis.Validators {
+			candidates[n] = swell.Candidate{Token: crypto.TokenFromString(validator.Token)}
+		}
+		engine, err = swell.NewStakeWeightedEngine(credentials, candidates, s.Genesis.Hash(), blockchain, pool)
+	} else {
+		authorities := make([]poa.Authority, len(s.Genesis.Validators))
+		for n, validator := range s.Genesis.Validators {
+			authorities[n] = poa.Authority{Token: crypto.TokenFromString(validator.Token)}
+		}
+		engine, err = poa.NewRoundRobinEngine(credentials, authorities, s.Genesis.SetRule(), blockchain, pool)
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Engine = engine
+	v.digests[0] = digest{chain: blockchain.RollingHash, state: commitState.Checksum()}
+	return v, nil
+}
+
+func (v *Validator) id() int {
+	return v.index
+}
+
+func (v *Validator) deliver(from crypto.Token, data []byte) {
+	if v.crashed {
+		return
+	}
+	v.step(func() { v.Engine.Deliver(trusted.Message{Token: from, Data: data}) })
+}
+
+// step runs f on the engine and records the digest of a new commit. Digests of
+// epochs discarded by a recovery are forgotten.
+func (v *Validator) step(f func()) {
+	f()
+	epoch := v.Chain.LastCommitEpoch
+	if epoch < v.committed {
+		for discarded := range v.digests {
+			if discarded > epoch {
+				delete(v.digests, discarded)
+			}
+		}
+	} else if epoch > v.committed {
+		v.digests[epoch] = digest{chain: v.Chain.RollingHash, state: v.State.Checksum()}
+	}
+	v.committed = epoch
+}
+
+// transport is the broadcaster of a validator on the in-memory network.
+type transport struct {
+	sim         *Simulation
+	from        *Validator
+	credentials crypto.PrivateKey
+}
+
+func (t *transport) BroadcastAction(data []byte) {
+	t.sim.send(t.from, echo.NewActionMessage(data))
+}
+
+func (t *transport) BrodcastNextBlock(epoch, checkpoint uint64, checkpointHash crypto.Hash, publisher crypto.Token) {
+	header := echo.BlockHeader{Epoch: epoch, Checkpoint: checkpoint, CheckpointHash: checkpointHash, Publisher: publisher}
+	t.sim.send(t.from, header.Serialize())
+}
+
+func (t *transport) BrodcastSealBlock(timestamp time.Time, actionsRoot, hash crypto.Hash, signature crypto.Signature) {
+	seal := echo.BlockTail{Timestamp: timestamp, ActionsRoot: actionsRoot, Hash: hash, Signature: signature}
+	t.sim.send(t.from, seal.Serialize())
+}
+
+func (t *transport) BrodcastCommitBlock(epoch uint64, hash, parent crypto.Hash, invalidated []crypto.Hash, certificate *chain.QuorumCertificate, root crypto.Hash) {
+	commit := echo.CommitBlock{Epoch: epoch, Hash: hash, ParentHash: parent, Invalidate: invalidated, Certificate: certificate, StateRoot: root}
+	t.sim.send(t.from, commit.Serialize())
+}
+
+func (t *transport) BroadcastRollover(epoch uint64) {
+	rollover := echo.NewRolloverBlock(epoch, t.credentials)
+	t.sim.send(t.from, rollover.Serialize())
+}
+
+func (t *transport) BroadcastVote(vote *chain.Vote) {
+	t.sim.send(t.from, echo.NewVoteMessage(vote))
+}
+
+func (t *transport) BroadcastCheckpoint(checkpoint *chain.Checkpoint) {
+	t.sim.send(t.from, echo.NewCheckpointMessage(checkpoint))
+}
+
+func (t *transport) BroadcastCheckpointCertificate(certificate *chain.CheckpointCertificate) {
+	t.sim.send(t.from, echo.NewCheckpointCertificateMessage(certificate))
+}
+
+func (t *transport) BroadcastRecoveryRequest(request *chain.RecoveryRequest) {
+	t.sim.send(t.from, echo.NewRecoveryRequestMessage(request))
+}
+
+func (t *transport) BroadcastRecovery(certificate *chain.RecoveryCertificate) {
+	t.sim.send(t.from, echo.NewRecoveryMessage(certificate))
+}
+
+func (t *transport) BroadcastValidatorSet(certificate *chain.SetCertificate) {
+	t.sim.send(t.from, echo.NewValidatorSetMessage(certificate))
+}
+
+func (t *transport) BroadcastSetEndorsement(endorsement *chain.SetEndorsement) {
+	t.sim.send(t.from, echo.NewSetEndorsementMessage(endorsement))
+}
+
+func (t *transport) BroadcastViewChange(change *chain.ViewChange) {
+	t.sim.send(t.from, echo.NewViewChangeMessage(change))
+}
+
+func (t *transport) BroadcastNewView(certificate *chain.ViewCertificate) {
+	t.sim.send(t.from, echo.NewViewMessage(certificate))
+}
+
+// UpdateLiveness is a no-op: there are no liveness requests to answer.
+func (t *transport) UpdateLiveness(report *chain.LivenessReport) {}
+
+func (t *transport) BroadcastLiveness(report *chain.LivenessReport) {
+	t.sim.send(t.from, echo.NewLivenessMessage(report))
+}
+
+// UpdateSnapshot is a no-op: there are no syncing nodes to stream snapshots to.
+func (t *transport) UpdateSnapshot(certified *state.CertifiedSnapshot) {}
+
+// Append is a no-op: there are no late subscribers to serve cached blocks to.
+func (t *transport) Append(block *chain.Block) {}
+
+// Book is a book instance of the simulation: it assembles the blocks commited
+// by its provider and incorporates them into a database. Blocks are replayed
+// on its own state to keep the balance history. A block failing to replay is
+// recorded as an error of the book.
+type Book struct {
+	DB        *store.DB
+	State     *state.State
+	sim       *Simulation
+	index     int
+	provider  int
+	assembler *echo.Assembler
+	committee chain.Committee
+	certified uint64 // epoch of the last certified checkpoint
+	recovered uint64 // epoch of the last checkpoint recovered to
+	digests   map[uint64]crypto.Hash
+	err       error
+}
+
+func newBook(s *Simulation, index, provider int) (*Book, error) {
+	db, err := store.NewDB(filepath.Join(s.config.DataPath, fmt.Sprintf("book_%v_%%v.dat", index)), actions.GetTokens)
+	if err != nil {
+		return nil, err
+	}
+	commitState := state.NewGenesisStateWithAllocations(s.Genesis.StateAllocations(), "")
+	commitState.UnbondingPeriod = s.Genesis.Unbonding()
+	if err := commitState.OpenHistory(""); err != nil {
+		return nil, err
+	}
+	return &Book{
+		DB:        db,
+		State:     commitState,
+		sim:       s,
+		index:     index,
+		provider:  provider,
+		assembler: echo.NewAssembler(s.Validators[provider].Chain.Committee, true),
+		committee: s.Validators[provider].Chain.Committee,
+		digests:   map[uint64]crypto.Hash{0: s.Genesis.Hash()},
+	}, nil
+}
+
+func (b *Book) id() int {
+	return len(b.sim.Validators) + b.index
+}
+
+func (b *Book) deliver(from crypto.Token, data []byte) {
+	if certificate := echo.ParseCheckpointCertificateMessage(data); certificate != nil {
+		if certificate.Epoch > b.certified && certificate.Verify(b.committee) {
+			b.certified = certificate.Epoch
+		}
+		return
+	}
+	if certificate := echo.ParseRecoveryMessage(data); certificate != nil {
+		if certificate.Epoch < b.certified || certificate.Epoch <= b.recovered || !certificate.Verify(b.committee) {
+			return
+		}
+		b.certified = certificate.Epoch
+		b.recovered = certificate.Epoch
+		b.assembler.Reset()
+		b.DB.Truncate(certificate.Epoch)
+		if certificate.Epoch < b.State.Epoch && b.err == nil {
+			b.err = b.State.Rollback(certificate.Epoch)
+		}
+		for epoch := range b.digests {
+			if epoch > certificate.Epoch {
+				delete(b.digests, epoch)
+			}
+		}
+		return
+	}
+	block := b.assembler.Message(data)
+	if block == nil || b.DB.IncorporateBlock(block) != nil {
+		return
+	}
+	if block.Epoch > b.State.Epoch && b.err == nil {
+		b.err = b.State.Replay(block)
+	}
+	if previous, ok := b.digests[block.Epoch-1]; ok {
+		b.digests[block.Epoch] = chain.RollingHash(previous, block.Hash)
+	}
+}
+
+// SocialNode is a social node of the simulation: it receives the actions of
+// its protocol and publishes the commited blocks of its provider filtered
+// down to them.
+type SocialNode struct {
+	Credentials crypto.PrivateKey
+	Published   []*chain.Block
+	sim         *Simulation
+	index       int
+	provider    int
+	code        echo.ProtocolCode
+	assembler   *echo.Assembler
+	committee   chain.Committee
+	certified   uint64 // epoch of the last certified checkpoint
+	recovered   uint64 // epoch of the last checkpoint recovered to
+	digests     map[uint64]crypto.Hash
+	err         error
+}
+
+func newSocialNode(s *Simulation, index int, config SocialNodeConfig) *SocialNode {
+	return &SocialNode{
+		Credentials: key(s.config.Seed, "social", index),
+		Published:   make([]*chain.Block, 0),
+		sim:         s,
+		index:       index,
+		provider:    config.Provider,
+		code:        config.Code,
+		assembler:   echo.NewAssembler(s.Validators[config.Provider].Chain.Committee, false),
+		committee:   s.Validators[config.Provider].Chain.Committee,
+		digests:     map[uint64]crypto.Hash{0: crypto.ZeroHash},
+	}
+}
+
+func (l *SocialNode) id() int {
+	return len(l.sim.Validators) + len(l.sim.Books) + l.index
+}
+
+// accepts returns true if the message is to be delivered to the node: actions
+// of other protocols are filtered out as for a subscription to its code.
+func (l *SocialNode) accepts(data []byte) bool {
+	action := echo.ParseAction(data)
+	return action == nil || l.code.Matches(action)
+}
+
+// deliver publishes commited blocks. The digest of an epoch chains the actions
+// roots of the published blocks. A published block failing to parse is
+// recorded as an error of the node.
+func (l *SocialNode) deliver(from crypto.Token, data []byte) {
+	if certificate := echo.ParseCheckpointCertificateMessage(data); certificate != nil {
+		if certificate.Epoch > l.certified && certificate.Verify(l.committee) {
+			l.certified = certificate.Epoch
+		}
+		return
+	}
+	if certificate := echo.ParseRecoveryMessage(data); certificate != nil {
+		if certificate.Epoch < l.certified || certificate.Epoch <= l.recovered || !certificate.Verify(l.committee) {
+			return
+		}
+		l.certified = certificate.Epoch
+		l.recovered = certificate.Epoch
+		l.assembler.Reset()
+		for epoch := range l.digests {
+			if epoch > certificate.Epoch {
+				delete(l.digests, epoch)
+			}
+		}
+		return
+	}
+	block := l.assembler.Message(data)
+	if block == nil {
+		return
+	}
+	published := chain.NewPublishedBlock(block, l.code.Code(), l.code.Matches, l.Credentials)
+	if chain.ParseBlock(published.Serialize()) == nil && l.err == nil {
+		l.err = fmt.Errorf("invalid published block %v", block.Epoch)
+	}
+	l.Published = append(l.Published, published)
+	if previous, ok := l.digests[block.Epoch-1]; ok {
+		root := chain.ActionsRoot(published.Actions)
+		l.digests[block.Epoch] = crypto.Hasher(append(previous[:], root[:]...))
+	}
+}
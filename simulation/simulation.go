@@ -0,0 +1,366 @@
+// Package simulation runs proof-of-authority or swell validators, social nodes
+// and book instances over an in-memory transport driven by a virtual clock.
+//
+// A simulation is deterministic: every random choice is drawn from the seed of
+// its configuration and events happening at the same virtual time run in the
+// order they were scheduled. Messages between two participants are delivered
+// in order, after the configured latency plus a random jitter, unless dropped
+// or cut by a partition. Crashed validators neither tick nor receive messages.
+//
+// Every participant records a digest of each epoch it commits, so that
+// Agreement can check that commited chains and states never diverge.
+package simulation
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/genesis"
+)
+
+// Config of a simulation. Stakes are the genesis deposits of validators, which
+// rotate by them at checkpoints if Rotation is set. If Swell is set validators
+// follow the stake weighted schedule of swell, with every genesis validator as a
+// candidate, instead of a round robin. Books lists the validator each
+// book instance follows and SocialNodes the provider and protocol code of each
+// social node. DataPath is the directory of the book databases and is required
+// if there are books.
+type Config struct {
+	Validators    int
+	Stakes        []uint64
+	Rotation      *genesis.Rotation
+	Swell         bool
+	Seed          int64
+	BlockInterval time.Duration // genesis default if zero
+	Latency       time.Duration // delay of every message
+	Jitter        time.Duration // maximum random delay added to Latency
+	DropRate      float64       // probability that a message is lost
+	Books         []int
+	SocialNodes   []SocialNodeConfig
+	DataPath      string
+}
+
+// SocialNodeConfig is the validator a social node follows and the code of its
+// protocol.
+type SocialNodeConfig struct {
+	Provider int
+	Code     echo.ProtocolCode
+}
+
+// Simulation is a network of validators and their listeners.
+type Simulation struct {
+	Validators  []*Validator
+	Books       []*Book
+	SocialNodes []*SocialNode
+	Genesis     *genesis.Spec
+	Treasury    crypto.PrivateKey // holds every genesis balance
+	config      Config
+	rand        *rand.Rand
+	start       time.Time
+	now         time.Time
+	events      queue
+	sequence    uint64
+	partition   map[int]int
+	arrival     map[[2]int]time.Time // last scheduled delivery on each link
+}
+
+// participant is an endpoint of the in-memory transport.
+type participant interface {
+	id() int
+	deliver(from crypto.Token, data []byte)
+}
+
+// key derives the credentials of a participant from the seed.
+func key(seed int64, kind string, n int) crypto.PrivateKey {
+	return crypto.PrivateKeyFromSeed([32]byte(crypto.Hasher([]byte(fmt.Sprintf("%v:%v:%v", seed, kind, n)))))
+}
+
+// New creates a simulation at virtual time zero. Validators propose their first
+// blocks as soon as Run is called.
+func New(config Config) (*Simulation, error) {
+	if config.Validators < 1 {
+		return nil, errors.New("simulation needs at least one validator")
+	}
+	if len(config.Books) > 0 && config.DataPath == "" {
+		return nil, errors.New("books need a data path")
+	}
+	s := &Simulation{
+		Treasury:  key(config.Seed, "treasury", 0),
+		config:    config,
+		rand:      rand.New(rand.NewSource(config.Seed)),
+		start:     time.Unix(0, 0),
+		partition: make(map[int]int),
+		arrival:   make(map[[2]int]time.Time),
+	}
+	s.now = s.start
+	s.Genesis = genesis.Default(s.Treasury.PublicKey())
+	s.Genesis.Rotation = config.Rotation
+	if config.BlockInterval > 0 {
+		s.Genesis.BlockInterval = int(config.BlockInterval / time.Millisecond)
+	}
+	credentials := make([]crypto.PrivateKey, config.Validators)
+	s.Genesis.Validators = make([]genesis.Validator, config.Validators)
+	for n := range credentials {
+		credentials[n] = key(config.Seed, "validator", n)
+		s.Genesis.Validators[n] = genesis.Validator{Token: credentials[n].PublicKey().String()}
+		if n < len(config.Stakes) && config.Stakes[n] > 0 {
+			allocation := genesis.Allocation{Token: credentials[n].PublicKey().String(), Deposit: config.Stakes[n]}
+			s.Genesis.Allocations = append(s.Genesis.Allocations, allocation)
+		}
+	}
+	if err := s.Genesis.Validate(); err != nil {
+		return nil, err
+	}
+	chain.MaxProtocolEpoch = s.Genesis.MaxProtocolEpoch
+	for n, key := range credentials {
+		validator, err := newValidator(s, n, key)
+		if err != nil {
+			return nil, err
+		}
+		s.Validators = append(s.Validators, validator)
+	}
+	for n, provider := range config.Books {
+		if provider < 0 || provider >= config.Validators {
+			return nil, fmt.Errorf("book %v follows unknown validator %v", n, provider)
+		}
+		book, err := newBook(s, n, provider)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.Books = append(s.Books, book)
+	}
+	for n, social := range config.SocialNodes {
+		if social.Provider < 0 || social.Provider >= config.Validators {
+			s.Close()
+			return nil, fmt.Errorf("social node %v follows unknown validator %v", n, social.Provider)
+		}
+		s.SocialNodes = append(s.SocialNodes, newSocialNode(s, n, social))
+	}
+	interval := s.Genesis.Interval()
+	for _, validator := range s.Validators {
+		v := validator
+		s.schedule(0, func() {
+			if !v.crashed {
+				v.step(v.Engine.Resume)
+			}
+		})
+		var tick func()
+		tick = func() {
+			if !v.crashed {
+				v.step(v.Engine.Tick)
+			}
+			s.schedule(interval, tick)
+		}
+		s.schedule(interval, tick)
+	}
+	return s, nil
+}
+
+// Now returns the virtual time of the simulation.
+func (s *Simulation) Now() time.Time {
+	return s.now
+}
+
+// Elapsed returns the virtual time since the start of the simulation.
+func (s *Simulation) Elapsed() time.Duration {
+	return s.now.Sub(s.start)
+}
+
+// At schedules f to run once the simulation reaches the given virtual time
+// since its start. Faults are injected this way.
+func (s *Simulation) At(elapsed time.Duration, f func()) {
+	s.schedule(elapsed-s.Elapsed(), f)
+}
+
+// Run processes events for the given virtual duration.
+func (s *Simulation) Run(duration time.Duration) {
+	end := s.now.Add(duration)
+	for len(s.events) > 0 && !s.events[0].at.After(end) {
+		next := heap.Pop(&s.events).(*event)
+		s.now = next.at
+		next.run()
+	}
+	s.now = end
+}
+
+// Submit delivers an action to the gateway of a validator.
+func (s *Simulation) Submit(validator int, action []byte) {
+	v := s.Validators[validator]
+	s.schedule(s.config.Latency, func() {
+		if !v.crashed {
+			v.step(func() { v.Engine.Receive(action) })
+		}
+	})
+}
+
+// Partition splits validators into groups that cannot reach each other.
+// Validators left out of every group form a group of their own. Listeners keep
+// following their providers. Messages already in flight are delivered.
+func (s *Simulation) Partition(groups ...[]int) {
+	s.partition = make(map[int]int)
+	for n, group := range groups {
+		for _, validator := range group {
+			s.partition[validator] = n + 1
+		}
+	}
+}
+
+// Heal removes every partition.
+func (s *Simulation) Heal() {
+	s.partition = make(map[int]int)
+}
+
+// Crash stops a validator. Messages to it are lost until it restarts.
+func (s *Simulation) Crash(validator int) {
+	s.Validators[validator].crashed = true
+}
+
+// Restart brings a crashed validator back with its commited chain and state,
+// as a restart from persisted files would. Blocks not yet commited are lost.
+func (s *Simulation) Restart(validator int) {
+	v := s.Validators[validator]
+	if !v.crashed {
+		return
+	}
+	v.crashed = false
+	v.step(func() {
+		v.Chain.RolloverBlock(v.Chain.LastCommitEpoch)
+		v.Engine.Resume()
+	})
+}
+
+// Close releases the book databases.
+func (s *Simulation) Close() {
+	for _, book := range s.Books {
+		book.DB.Close()
+	}
+}
+
+func (s *Simulation) schedule(delay time.Duration, f func()) {
+	s.sequence++
+	heap.Push(&s.events, &event{at: s.now.Add(delay), sequence: s.sequence, run: f})
+}
+
+// reachable returns true if a validator can reach another.
+func (s *Simulation) reachable(from, to int) bool {
+	return s.partition[from] == s.partition[to]
+}
+
+// send broadcasts data from a validator to every other validator and to its
+// listeners. Each delivery is subject to drop, latency and jitter. Deliveries
+// on a link never overtake each other.
+func (s *Simulation) send(from *Validator, data []byte) {
+	destinations := make([]participant, 0)
+	for _, validator := range s.Validators {
+		if validator != from && s.reachable(from.index, validator.index) {
+			destinations = append(destinations, validator)
+		}
+	}
+	for _, book := range s.Books {
+		if book.provider == from.index {
+			destinations = append(destinations, book)
+		}
+	}
+	for _, social := range s.SocialNodes {
+		if social.provider == from.index && social.accepts(data) {
+			destinations = append(destinations, social)
+		}
+	}
+	for _, destination := range destinations {
+		if s.config.DropRate > 0 && s.rand.Float64() < s.config.DropRate {
+			continue
+		}
+		delay := s.config.Latency
+		if s.config.Jitter > 0 {
+			delay += time.Duration(s.rand.Int63n(int64(s.config.Jitter)))
+		}
+		link := [2]int{from.id(), destination.id()}
+		at := s.now.Add(delay)
+		if last, ok := s.arrival[link]; ok && at.Before(last) {
+			at = last
+		}
+		s.arrival[link] = at
+		to := destination
+		s.schedule(at.Sub(s.now), func() { to.deliver(from.Token, data) })
+	}
+}
+
+// Agreement returns an error if two participants recorded different digests
+// for the same epoch: validators are compared by chain and state, books by
+// chain against validators, and social nodes among those of the same code. A
+// book or social node that failed to follow the chain is also an error.
+func (s *Simulation) Agreement() error {
+	for n, validator := range s.Validators {
+		for _, other := range s.Validators[n+1:] {
+			for epoch, digest := range validator.digests {
+				if another, ok := other.digests[epoch]; ok && another != digest {
+					return fmt.Errorf("validators %v and %v diverge at epoch %v", validator.index, other.index, epoch)
+				}
+			}
+		}
+	}
+	for _, book := range s.Books {
+		if book.err != nil {
+			return fmt.Errorf("book %v: %v", book.index, book.err)
+		}
+		for epoch, hash := range book.digests {
+			for _, validator := range s.Validators {
+				if digest, ok := validator.digests[epoch]; ok && !digest.chain.Equal(hash) {
+					return fmt.Errorf("book %v diverges from validator %v at epoch %v", book.index, validator.index, epoch)
+				}
+			}
+		}
+	}
+	for n, social := range s.SocialNodes {
+		if social.err != nil {
+			return fmt.Errorf("social node %v: %v", social.index, social.err)
+		}
+		for _, other := range s.SocialNodes[n+1:] {
+			if other.code != social.code {
+				continue
+			}
+			for epoch, hash := range social.digests {
+				if another, ok := other.digests[epoch]; ok && !another.Equal(hash) {
+					return fmt.Errorf("social nodes %v and %v diverge at epoch %v", social.index, other.index, epoch)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type event struct {
+	at       time.Time
+	sequence uint64
+	run      func()
+}
+
+// queue is a priority queue of events by time and order of scheduling.
+type queue []*event
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].sequence < q[j].sequence
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q queue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *queue) Push(x any) { *q = append(*q, x.(*event)) }
+
+func (q *queue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
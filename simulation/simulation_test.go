@@ -0,0 +1,279 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lienkolabs/breeze/crypto"
+	"github.com/lienkolabs/breeze/network/echo"
+	"github.com/lienkolabs/breeze/protocol/actions"
+	"github.com/lienkolabs/breeze/protocol/chain"
+	"github.com/lienkolabs/breeze/protocol/genesis"
+)
+
+func transfer(s *Simulation, epoch, value uint64) []byte {
+	receiver, _ := crypto.RandomAsymetricKey()
+	action := actions.Transfer{TimeStamp: epoch, From: s.Treasury.PublicKey(), To: []crypto.TokenValue{{Token: receiver, Value: value}}}
+	action.Sign(s.Treasury)
+	return action.Serialize()
+}
+
+func newSimulation(t *testing.T, config Config) *Simulation {
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestAgreement(t *testing.T) {
+	all := echo.ProtocolCode{255, 255, 255, 255}
+	s := newSimulation(t, Config{
+		Validators:  4,
+		Seed:        1,
+		Latency:     10 * time.Millisecond,
+		Jitter:      50 * time.Millisecond,
+		Books:       []int{1, 2},
+		SocialNodes: []SocialNodeConfig{{Provider: 0, Code: all}, {Provider: 3, Code: all}},
+		DataPath:    t.TempDir(),
+	})
+	submitted := make([]crypto.Hash, 0)
+	for n := 1; n <= 10; n++ {
+		epoch := uint64(n)
+		action := transfer(s, epoch, epoch)
+		submitted = append(submitted, crypto.Hasher(action))
+		s.At(time.Duration(n)*time.Second-500*time.Millisecond, func() {
+			s.Submit(int(epoch)%4, action)
+		})
+	}
+	s.Run(20 * time.Second)
+	for _, validator := range s.Validators {
+		if validator.Chain.LastCommitEpoch < 15 {
+			t.Fatalf("validator %v commited only %v epochs", validator.index, validator.Chain.LastCommitEpoch)
+		}
+	}
+	if _, balance := s.Validators[0].State.Wallets.Balance(s.Treasury.PublicKey()); balance != 1e9-55 {
+		t.Fatalf("unexpected treasury balance: %v", balance)
+	}
+	for _, book := range s.Books {
+		if len(book.digests) < 15 {
+			t.Fatalf("book %v incorporated only %v blocks", book.index, len(book.digests))
+		}
+		_, last := book.State.History.Epochs()
+		if wallet, _, err := book.State.History.Balance(crypto.HashToken(s.Treasury.PublicKey()), last); err != nil || wallet != 1e9-55 {
+			t.Fatalf("unexpected treasury balance on book %v history: %v %v", book.index, wallet, err)
+		}
+		committee := s.Validators[book.provider].Chain.Committee
+		for _, action := range submitted {
+			receipts := 0
+			for epoch := uint64(1); epoch <= last; epoch++ {
+				receipt := echo.ParseActionProof(book.DB.Proof(epoch, action).Serialize())
+				if receipt == nil {
+					t.Fatalf("unparseable receipt on book %v", book.index)
+				}
+				if receipt.Verify(committee) != nil {
+					receipts++
+					if receipt.Verify(chain.StaticCommittee{s.Treasury.PublicKey()}) != nil {
+						t.Fatalf("receipt on book %v verified against another committee", book.index)
+					}
+				}
+			}
+			if receipts != 1 {
+				t.Fatalf("%v receipts of an action on book %v", receipts, book.index)
+			}
+		}
+	}
+	if err := s.Agreement(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	run := func() crypto.Hash {
+		s := newSimulation(t, Config{Validators: 3, Seed: 7, Latency: 5 * time.Millisecond, Jitter: 100 * time.Millisecond, DropRate: 0.01})
+		s.Run(10 * time.Second)
+		return s.Validators[0].Chain.RollingHash
+	}
+	if first, second := run(), run(); !first.Equal(second) {
+		t.Fatal("simulations with the same seed diverge")
+	}
+}
+
+// Round robin validators cannot catch up once they miss a block. View changes
+// route around them, but faults slow the chain down to a crawl: only agreement
+// of what was commited is checked.
+func TestFaults(t *testing.T) {
+	s := newSimulation(t, Config{Validators: 4, Seed: 3, Latency: 10 * time.Millisecond, Jitter: 20 * time.Millisecond, DropRate: 0.02})
+	s.At(3*time.Second, func() { s.Crash(2) })
+	s.At(6*time.Second, func() { s.Restart(2) })
+	s.At(8*time.Second, func() { s.Partition([]int{0, 1}, []int{2, 3}) })
+	s.At(12*time.Second, s.Heal)
+	s.Run(20 * time.Second)
+	if err := s.Agreement(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	rotation := &genesis.Rotation{MinStake: 100, MaxSize: 2}
+	s := newSimulation(t, Config{Validators: 4, Stakes: []uint64{100, 300, 200, 50}, Rotation: rotation, Seed: 5, Latency: 10 * time.Millisecond})
+	sets := s.Validators[0].Chain.Committee.(*chain.Rotation)
+	if members := sets.Members(1); len(members) != 2 || !members[0].Equal(s.Validators[1].Token) || !members[1].Equal(s.Validators[2].Token) {
+		t.Fatal("genesis set not ranked by deposits")
+	}
+	// validator 1 is slashed for sealing two blocks of the same epoch
+	offender := key(s.config.Seed, "validator", 1)
+	first := &chain.Block{Epoch: 2, Proposer: offender.PublicKey(), Actions: [][]byte{[]byte("first")}}
+	first.Seal(offender)
+	second := &chain.Block{Epoch: 2, Proposer: offender.PublicKey(), Actions: [][]byte{[]byte("second")}}
+	second.Seal(offender)
+	evidence := chain.DoubleSign(first, second)
+	evidence.TimeStamp = 2
+	evidence.Reporter = s.Treasury.PublicKey()
+	evidence.Sign(s.Treasury)
+	s.At(2500*time.Millisecond, func() { s.Submit(2, evidence.Serialize()) })
+	s.Run((chain.CheckpointInterval + 10) * time.Second)
+	for _, validator := range s.Validators {
+		if validator.Chain.LastCommitEpoch <= chain.CheckpointInterval {
+			t.Fatalf("validator %v did not reach the checkpoint", validator.index)
+		}
+	}
+	if members := sets.Members(chain.CheckpointInterval + 1); len(members) != 2 || !members[0].Equal(s.Validators[2].Token) || !members[1].Equal(s.Validators[0].Token) {
+		t.Fatal("slashed validator not rotated out at the checkpoint")
+	}
+	for epoch := uint64(chain.CheckpointInterval + 1); epoch <= s.Validators[0].Chain.LastCommitEpoch; epoch++ {
+		if proposer := s.Validators[0].Chain.SealedBlocks[epoch].Proposer; !proposer.Equal(s.Validators[0].Token) && !proposer.Equal(s.Validators[2].Token) {
+			t.Fatalf("block %v proposed out of the validator set", epoch)
+		}
+	}
+	if err := s.Agreement(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestViewChange(t *testing.T) {
+	s := newSimulation(t, Config{Validators: 4, Seed: 11, Latency: 10 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	s.At(1500*time.Millisecond, func() { s.Crash(1) })
+	s.Run(60 * time.Second)
+	blockchain := s.Validators[0].Chain
+	if blockchain.LastCommitEpoch < 20 {
+		t.Fatalf("chain stalled at epoch %v", blockchain.LastCommitEpoch)
+	}
+	replaced := 0
+	for epoch := uint64(5); epoch <= blockchain.LastCommitEpoch; epoch++ {
+		if block, ok := blockchain.SealedBlocks[epoch]; ok && epoch%4 == 1 {
+			if block.Proposer.Equal(s.Validators[1].Token) {
+				t.Fatalf("block %v proposed by crashed validator", epoch)
+			}
+			replaced += 1
+		}
+	}
+	if replaced == 0 {
+		t.Fatal("no block of the crashed validator was replaced")
+	}
+	report := blockchain.LivenessReport(chain.CheckpointWindow(blockchain.LastCommitEpoch))
+	if report == nil {
+		t.Fatal("no liveness recorded")
+	}
+	for n, token := range report.Validators {
+		liveness := report.Liveness[n]
+		if token.Equal(s.Validators[1].Token) {
+			if liveness.Missed == 0 {
+				t.Fatal("missed epochs of the crashed validator not recorded")
+			}
+		} else if liveness.Proposed == 0 || liveness.Sealed == 0 {
+			t.Fatalf("blocks of validator %v not recorded", token)
+		}
+	}
+	if err := s.Agreement(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEquivocation(t *testing.T) {
+	s := newSimulation(t, Config{
+		Validators: 4,
+		Seed:       17,
+		Latency:    10 * time.Millisecond,
+		Jitter:     20 * time.Millisecond,
+		Books:      []int{1, 2},
+		DataPath:   t.TempDir(),
+	})
+	// the proposer of the block under formation seals a second one for its epoch
+	var competing *chain.Block
+	s.At(2200*time.Millisecond, func() {
+		for _, validator := range s.Validators {
+			live := validator.Chain.LiveBlock
+			if live == nil || !live.Proposer.Equal(validator.Token) {
+				continue
+			}
+			competing = &chain.Block{Epoch: live.Epoch, CheckPoint: live.CheckPoint, CheckpointHash: live.CheckpointHash, Proposer: validator.Token}
+			competing.Seal(key(s.config.Seed, "validator", validator.index))
+			header := echo.BlockHeader{Epoch: competing.Epoch, Checkpoint: competing.CheckPoint, CheckpointHash: competing.CheckpointHash, Publisher: validator.Token}
+			seal := echo.BlockTail{Timestamp: competing.ProposedAt, ActionsRoot: competing.ActionsRoot, Hash: competing.Hash, Signature: competing.SealSignature}
+			s.send(validator, header.Serialize())
+			s.send(validator, seal.Serialize())
+			return
+		}
+	})
+	candidates := 0
+	s.At(2300*time.Millisecond, func() {
+		for _, validator := range s.Validators {
+			if competing != nil && validator.Chain.Candidates[competing.Epoch][competing.Hash] != nil {
+				candidates++
+			}
+		}
+	})
+	s.Run(20 * time.Second)
+	if competing == nil {
+		t.Fatal("no block under formation to compete with")
+	}
+	if candidates == 0 {
+		t.Fatal("competing block not added to the candidates")
+	}
+	for _, validator := range s.Validators {
+		if validator.Chain.LastCommitEpoch < 15 {
+			t.Fatalf("validator %v commited only %v epochs", validator.index, validator.Chain.LastCommitEpoch)
+		}
+	}
+	for _, book := range s.Books {
+		if _, ok := book.digests[competing.Epoch]; !ok {
+			t.Fatalf("book %v did not follow the commit of epoch %v", book.index, competing.Epoch)
+		}
+	}
+	if err := s.Agreement(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSwellViewChange(t *testing.T) {
+	s := newSimulation(t, Config{Validators: 4, Swell: true, Seed: 13, Latency: 10 * time.Millisecond, Jitter: 20 * time.Millisecond})
+	s.At(1500*time.Millisecond, func() { s.Crash(1) })
+	s.Run(60 * time.Second)
+	blockchain := s.Validators[0].Chain
+	if blockchain.LastCommitEpoch < 20 {
+		t.Fatalf("chain stalled at epoch %v", blockchain.LastCommitEpoch)
+	}
+	for epoch := uint64(5); epoch <= blockchain.LastCommitEpoch; epoch++ {
+		if block, ok := blockchain.SealedBlocks[epoch]; ok && block.Proposer.Equal(s.Validators[1].Token) {
+			t.Fatalf("block %v proposed by crashed validator", epoch)
+		}
+	}
+	report := blockchain.LivenessReport(chain.CheckpointWindow(blockchain.LastCommitEpoch))
+	if report == nil {
+		t.Fatal("no liveness recorded")
+	}
+	missed := uint64(0)
+	for n, token := range report.Validators {
+		if token.Equal(s.Validators[1].Token) {
+			missed = report.Liveness[n].Missed
+		}
+	}
+	if missed == 0 {
+		t.Fatal("missed epochs of the crashed validator not recorded")
+	}
+	if err := s.Agreement(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -14,6 +14,10 @@ import (
 
 const maxFileLength = 1 << 32
 
+// anchorInterval is the number of epochs between blocks located by the receipt
+// index. Other blocks are found by reading forward from the preceding anchor.
+const anchorInterval = 64
+
 //const fileNameTemaplate = "breeze_rawdb_%v.dat"
 
 type Tokenizer func([]byte) []crypto.Token
@@ -36,6 +40,15 @@ type DB struct {
 	tokeninzer       Tokenizer
 	jobs             map[crypto.Token]*echo.NewIndexJob
 	runningJob       map[*echo.NewIndexJob]struct{}
+	committee        chain.Committee
+	anchors          []DBMessage // receipt index: sparse commited blocks in epoch order
+	truncated        bool        // the next block is an anchor
+}
+
+// SetCommittee instructs the database to refuse blocks without a valid quorum
+// certificate of the given committee.
+func (db *DB) SetCommittee(committee chain.Committee) {
+	db.committee = committee
 }
 
 func (db *DB) Close() {
@@ -44,6 +57,9 @@ func (db *DB) Close() {
 	}
 }
 
+// NewDB opens the database on the files of the given template. Blocks on
+// existing files are indexed again, so that a restarted database answers for
+// every block it stored.
 func NewDB(fileNameTemplate string, tokenizer Tokenizer) (*DB, error) {
 	if tokenizer == nil {
 		return nil, errors.New("a valid tokenizer function must be provided")
@@ -59,11 +75,84 @@ func NewDB(fileNameTemplate string, tokenizer Tokenizer) (*DB, error) {
 		tokeninzer:       tokenizer,
 		jobs:             make(map[crypto.Token]*echo.NewIndexJob),
 		runningJob:       make(map[*echo.NewIndexJob]struct{}),
+		anchors:          make([]DBMessage, 0),
+	}
+	if err := db.open(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if len(db.files) == 0 {
+		db.CreateNewFile()
 	}
-	db.CreateNewFile()
 	return db, nil
 }
 
+// open indexes the blocks of the existing files of the database. A block with
+// an epoch not after the previous one follows a truncation of the database. A
+// block cut short on the last file is discarded.
+func (db *DB) open() error {
+	for {
+		name := fmt.Sprintf(db.fileNameTemplate, len(db.files)+1)
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return nil
+		}
+		file, err := os.OpenFile(name, os.O_RDWR, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open database file: %v", err)
+		}
+		if len(db.files) > 0 {
+			// reopen previous file as readonly
+			previous := db.files[len(db.files)-1]
+			previous.Close()
+			if db.files[len(db.files)-1], err = os.Open(previous.Name()); err != nil {
+				file.Close()
+				return fmt.Errorf("could not open database file: %v", err)
+			}
+		}
+		db.files = append(db.files, file)
+		db.current = len(db.files)
+		db.length = 0
+		for {
+			msg, block := db.readBlock(db.current-1, db.length)
+			if block == nil {
+				break
+			}
+			if len(db.anchors) > 0 && block.Epoch <= db.epoch {
+				db.Truncate(block.Epoch - 1)
+			}
+			db.indexBlock(block, msg)
+			db.length += msg.size
+		}
+		if err := file.Truncate(int64(db.length)); err != nil {
+			return fmt.Errorf("could not open database file: %v", err)
+		}
+		if _, err := file.Seek(int64(db.length), 0); err != nil {
+			return fmt.Errorf("could not open database file: %v", err)
+		}
+	}
+}
+
+// readBlock reads the block stored at the given position of a file. It returns
+// a nil block if there is no complete block at the position.
+func (db *DB) readBlock(file, position int) (DBMessage, *chain.Block) {
+	msg := DBMessage{file: file, position: position, size: 4}
+	data := db.ReadMessage(msg)
+	if data == nil {
+		return msg, nil
+	}
+	size, _ := util.ParseUint32(data, 0)
+	msg.size = 4 + int(size)
+	data = db.ReadMessage(msg)
+	if data == nil {
+		return msg, nil
+	}
+	block := chain.ParseBlock(data[4:])
+	if block != nil {
+		msg.block = block.Epoch
+	}
+	return msg, block
+}
+
 func (db *DB) AppendJob(job *echo.NewIndexJob) {
 	if job.KeepAlive {
 		db.mu.Lock()
@@ -119,16 +208,38 @@ func (db *DB) AppendBlock(block *chain.Block) (*DBMessage, error) {
 }
 
 func (db *DB) IncorporateBlock(block *chain.Block) error {
+	if db.committee != nil && !block.Certificate.Certifies(block.Epoch, block.Hash, block.CommitHash(), db.committee) {
+		return errors.New("block without a valid quorum certificate")
+	}
+	file := db.current - 1
 	blockMessage, err := db.AppendBlock(block)
 	if err != nil {
 		return err
 	}
+	blockMessage.file = file
+	blockMessage.block = block.Epoch
+	db.indexBlock(block, *blockMessage)
+	return nil
+}
+
+// indexBlock incorporates a block stored at the given message into the receipt
+// index and the actions of the block into the token index. The first block of
+// a file and the first block after a truncation are anchors of the receipt
+// index.
+func (db *DB) indexBlock(block *chain.Block, blockMessage DBMessage) {
+	db.mu.Lock()
+	last := len(db.anchors) - 1
+	if last < 0 || db.truncated || blockMessage.file != db.anchors[last].file || block.Epoch >= db.anchors[last].block+anchorInterval {
+		db.anchors = append(db.anchors, blockMessage)
+		db.truncated = false
+	}
 	db.epoch = block.Epoch
+	db.mu.Unlock()
 	head := block.Header()
 	position := blockMessage.position + len(head) + 4
 	for _, action := range block.Actions {
 		dbMessage := DBMessage{
-			file:     db.current - 1,
+			file:     blockMessage.file,
 			block:    block.Epoch,
 			position: position + 2, // 2 for the size of the action
 			size:     len(action),
@@ -145,7 +256,97 @@ func (db *DB) IncorporateBlock(block *chain.Block) error {
 		}
 		position += len(action) + 2
 	}
-	return nil
+}
+
+// Truncate discards from the index every action of blocks after the given
+// epoch. Raw data of discarded blocks is kept on file but is no longer
+// reachable.
+func (db *DB) Truncate(epoch uint64) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for token, messages := range db.index {
+		kept := make([]DBMessage, 0, len(messages))
+		for _, message := range messages {
+			if message.block <= epoch {
+				kept = append(kept, message)
+			}
+		}
+		if len(kept) == 0 {
+			delete(db.index, token)
+		} else {
+			db.index[token] = kept
+		}
+	}
+	kept := len(db.anchors)
+	for kept > 0 && db.anchors[kept-1].block > epoch {
+		kept--
+	}
+	db.anchors = db.anchors[:kept]
+	db.truncated = true
+	if db.epoch > epoch {
+		db.epoch = epoch
+	}
+}
+
+// Proof returns the receipt of inclusion of the action on the commited block
+// of the given epoch. If the block, the action on the block or the certificate
+// of the block is unknown, or if the action was invalidated by the commit of
+// the block, the receipt carries no header.
+func (db *DB) Proof(epoch uint64, action crypto.Hash) *echo.ActionProof {
+	receipt := &echo.ActionProof{Epoch: epoch, Action: action}
+	block := db.block(epoch)
+	if block == nil || block.Certificate == nil {
+		return receipt
+	}
+	for _, invalidated := range block.Invalidate {
+		if invalidated.Equal(action) {
+			return receipt
+		}
+	}
+	if proof := block.ProofFor(action); proof != nil {
+		receipt.Header = block.Header()
+		receipt.Signature = block.SealSignature
+		receipt.Proof = proof
+		receipt.Commit = chain.NewCertifiedCommit(block)
+	}
+	return receipt
+}
+
+// block returns the commited block of the given epoch, or nil if it is not
+// stored. Blocks are read forward from the last anchor at or before the epoch:
+// blocks of a file after the anchor are in epoch order up to blocks discarded
+// by a truncation, which are followed by the anchor of the next block.
+func (db *DB) block(epoch uint64) *chain.Block {
+	db.mu.Lock()
+	if epoch > db.epoch {
+		db.mu.Unlock()
+		return nil
+	}
+	n := len(db.anchors) - 1
+	for n >= 0 && db.anchors[n].block > epoch {
+		n--
+	}
+	if n < 0 {
+		db.mu.Unlock()
+		return nil
+	}
+	anchor := db.anchors[n]
+	db.mu.Unlock()
+	for position := anchor.position; ; {
+		msg, block := db.readBlock(anchor.file, position)
+		if block == nil || block.Epoch > epoch {
+			return nil
+		}
+		if block.Epoch == epoch {
+			return block
+		}
+		position += msg.size
+	}
+}
+
+// AnswerProof sends the receipt requested by the job on its connection.
+func (db *DB) AnswerProof(job *echo.ProofJob) {
+	go job.Connection.Send(db.Proof(job.Request.Epoch, job.Request.Action).Serialize())
 }
 
 func (db *DB) ReadMessage(msg DBMessage) []byte {